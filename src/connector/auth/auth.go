@@ -0,0 +1,307 @@
+// Package auth authenticates requests to the REST API using static API keys, HTTP basic
+// authentication with bcrypt hashed passwords, JWT bearer tokens or TLS client certificates
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MethodAPIKey      = models.AuthMethodAPIKey
+	MethodBasic       = models.AuthMethodBasic
+	MethodJWT         = models.AuthMethodJWT
+	MethodCertificate = models.AuthMethodCertificate
+
+	apiKeyHeader = "X-API-Key"
+)
+
+// DefaultPublicPaths are the paths that can be requested without authentication
+// when no public paths are configured
+var DefaultPublicPaths = []string{"/health", "/health/live", "/health/ready"}
+
+// ErrInvalidCredentials is returned when a request contains credentials that are not valid
+var ErrInvalidCredentials = errors.New("Invalid credentials")
+
+type contextKey int
+
+const (
+	identityKey contextKey = iota
+	anonymousKey
+)
+
+// Authenticator checks the credentials of a request, when the request does not contain
+// credentials for the authenticator nil is returned without error
+type Authenticator interface {
+	Authenticate(r *http.Request) (*models.Identity, error)
+	// Challenge returns the value for the WWW-Authenticate header
+	Challenge() string
+}
+
+// Auth holds the configured authenticators and public paths
+type Auth struct {
+	authenticators []Authenticator
+	publicPaths    map[string]bool
+	defaultRole    models.Role
+}
+
+// CreateAuth creates the authenticators from the given config
+func CreateAuth(config models.AuthConfig) (*Auth, error) {
+	a := &Auth{
+		authenticators: make([]Authenticator, 0),
+		publicPaths:    make(map[string]bool),
+		defaultRole:    config.DefaultRole,
+	}
+
+	if err := checkRoles(config); err != nil {
+		return nil, err
+	}
+
+	if len(config.APIKeys) > 0 {
+		a.authenticators = append(a.authenticators, &apiKeyAuthenticator{keys: config.APIKeys})
+	}
+
+	if len(config.Users) > 0 {
+		a.authenticators = append(a.authenticators, &basicAuthenticator{users: config.Users})
+	}
+
+	if config.JWT != nil {
+		jwt, err := createJWTAuthenticator(*config.JWT)
+		if err != nil {
+			return nil, err
+		}
+
+		a.authenticators = append(a.authenticators, jwt)
+	}
+
+	// client certificates are tried last so credentials in the request take precedence
+	if config.ClientCertificate != nil {
+		a.authenticators = append(a.authenticators, &certificateAuthenticator{roles: config.ClientCertificate.Roles})
+	}
+
+	publicPaths := config.PublicPaths
+	if publicPaths == nil {
+		publicPaths = DefaultPublicPaths
+	}
+
+	for _, p := range publicPaths {
+		a.publicPaths[p] = true
+	}
+
+	return a, nil
+}
+
+// checkRoles checks if all roles in the config are known roles
+func checkRoles(config models.AuthConfig) error {
+	roles := []models.Role{config.DefaultRole}
+	for _, k := range config.APIKeys {
+		roles = append(roles, k.Role)
+	}
+
+	for _, u := range config.Users {
+		roles = append(roles, u.Role)
+	}
+
+	if config.ClientCertificate != nil {
+		for _, r := range config.ClientCertificate.Roles {
+			roles = append(roles, r)
+		}
+	}
+
+	for _, r := range roles {
+		if len(r) > 0 && !r.IsValid() {
+			return fmt.Errorf("Unknown role %s", r)
+		}
+	}
+
+	return nil
+}
+
+// IsEnabled returns true when at least one authentication method is configured
+func (a *Auth) IsEnabled() bool {
+	return len(a.authenticators) > 0
+}
+
+// Methods returns the names of the configured authentication methods
+func (a *Auth) Methods() []string {
+	methods := make([]string, 0, len(a.authenticators))
+	for _, authenticator := range a.authenticators {
+		switch authenticator.(type) {
+		case *apiKeyAuthenticator:
+			methods = append(methods, MethodAPIKey)
+		case *basicAuthenticator:
+			methods = append(methods, MethodBasic)
+		case *jwtAuthenticator:
+			methods = append(methods, MethodJWT)
+		case *certificateAuthenticator:
+			methods = append(methods, MethodCertificate)
+		}
+	}
+
+	return methods
+}
+
+// IsPublic checks if the route with the given path is on the allow-list
+func (a *Auth) IsPublic(path string) bool {
+	return a.publicPaths[path]
+}
+
+// Authenticate tries all configured authenticators on the request, an error is returned when
+// the request has invalid credentials or none at all
+func (a *Auth) Authenticate(r *http.Request) (*models.Identity, error) {
+	for _, authenticator := range a.authenticators {
+		identity, err := authenticator.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if identity != nil {
+			return identity, nil
+		}
+	}
+
+	return nil, errors.New("Authentication required")
+}
+
+// Authorize sets the role of the identity, the role assigned in the database takes precedence over
+// the role from the config or token and the default role is used when neither is available. An
+// error is returned when the role does not grant the permission
+func (a *Auth) Authorize(identity *models.Identity, assigned *models.RoleAssignment, permission models.Permission) error {
+	if assigned != nil {
+		identity.Role = assigned.Role
+	}
+
+	if len(identity.Role) == 0 {
+		identity.Role = a.defaultRole
+	}
+
+	if len(permission) == 0 || identity.Role.HasPermission(permission) {
+		return nil
+	}
+
+	if len(identity.Role) == 0 {
+		return fmt.Errorf("%s has no role", identity.Name)
+	}
+
+	return fmt.Errorf("Role %s of %s does not have the %s permission", identity.Role, identity.Name, permission)
+}
+
+// Challenges returns the WWW-Authenticate values of all authenticators
+func (a *Auth) Challenges() []string {
+	challenges := make([]string, 0)
+	for _, authenticator := range a.authenticators {
+		if c := authenticator.Challenge(); len(c) > 0 {
+			challenges = append(challenges, c)
+		}
+	}
+
+	return challenges
+}
+
+// WithIdentity returns a copy of the request with the identity stored in its context
+func WithIdentity(r *http.Request, identity *models.Identity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey, identity))
+}
+
+// GetIdentity returns the identity of an authenticated request, nil when authentication
+// is disabled or the route is public
+func GetIdentity(r *http.Request) *models.Identity {
+	identity, _ := r.Context().Value(identityKey).(*models.Identity)
+	return identity
+}
+
+// WithAnonymous returns a copy of the request marked as a request without identity while
+// authentication is enabled, used for requests on public routes
+func WithAnonymous(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), anonymousKey, true))
+}
+
+// HasPermission checks if the caller of a request has a permission, when authentication is disabled
+// every caller has all permissions and an anonymous caller on a public route has none
+func HasPermission(r *http.Request, permission models.Permission) bool {
+	if identity := GetIdentity(r); identity != nil {
+		return identity.Role.HasPermission(permission)
+	}
+
+	anonymous, _ := r.Context().Value(anonymousKey).(bool)
+	return !anonymous
+}
+
+// HashPassword creates a bcrypt hash to use as PasswordHash of a user
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+type apiKeyAuthenticator struct {
+	keys []models.APIKeyConfig
+}
+
+func (a *apiKeyAuthenticator) Authenticate(r *http.Request) (*models.Identity, error) {
+	key := r.Header.Get(apiKeyHeader)
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			return &models.Identity{Name: k.Name, Method: MethodAPIKey, Role: k.Role}, nil
+		}
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+func (a *apiKeyAuthenticator) Challenge() string {
+	return ""
+}
+
+type basicAuthenticator struct {
+	users []models.UserConfig
+}
+
+func (a *basicAuthenticator) Authenticate(r *http.Request) (*models.Identity, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+
+	for _, u := range a.users {
+		if u.Name != name {
+			continue
+		}
+
+		if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+			return nil, ErrInvalidCredentials
+		}
+
+		return &models.Identity{Name: u.Name, Method: MethodBasic, Role: u.Role}, nil
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+func (a *basicAuthenticator) Challenge() string {
+	return `Basic realm="sensorthings-connector"`
+}
+
+// bearerToken returns the token of a bearer Authorization header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+
+	return ""
+}
+
+func invalidToken(reason string) error {
+	return fmt.Errorf("Invalid token: %s", reason)
+}
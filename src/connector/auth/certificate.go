@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// certificateAuthenticator authenticates requests with a client certificate verified during the TLS
+// handshake, the common name of the subject is the identity
+type certificateAuthenticator struct {
+	roles map[string]models.Role
+}
+
+func (a *certificateAuthenticator) Authenticate(r *http.Request) (*models.Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if len(name) == 0 {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &models.Identity{Name: name, Method: MethodCertificate, Role: a.roles[name]}, nil
+}
+
+func (a *certificateAuthenticator) Challenge() string {
+	return ""
+}
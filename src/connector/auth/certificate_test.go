@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+func TestCertificateAuthenticate(t *testing.T) {
+	a := &certificateAuthenticator{roles: map[string]models.Role{"dashboard": models.RoleViewer}}
+
+	tests := []struct {
+		name     string
+		request  *http.Request
+		identity *models.Identity
+		success  bool
+	}{
+		{"without TLS", httptest.NewRequest("GET", "/Connectors", nil), nil, true},
+		{"without client certificate", certificateRequest(nil), nil, true},
+		{"certificate that is not verified", unverifiedCertificateRequest("dashboard"), nil, true},
+		{"configured common name", certificateRequest(certificate("dashboard")),
+			&models.Identity{Name: "dashboard", Method: MethodCertificate, Role: models.RoleViewer}, true},
+		{"other common name", certificateRequest(certificate("sensor-1")),
+			&models.Identity{Name: "sensor-1", Method: MethodCertificate}, true},
+		{"empty common name", certificateRequest(certificate("")), nil, false},
+	}
+
+	for _, test := range tests {
+		identity, err := a.Authenticate(test.request)
+		if test.success && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if !test.success && err == nil {
+			t.Errorf("%s: the certificate should be rejected", test.name)
+		}
+
+		if (identity == nil) != (test.identity == nil) || (identity != nil && *identity != *test.identity) {
+			t.Errorf("%s: identity = %+v, expected %+v", test.name, identity, test.identity)
+		}
+	}
+}
+
+func TestCreateAuthClientCertificate(t *testing.T) {
+	a, err := CreateAuth(models.AuthConfig{
+		APIKeys:           []models.APIKeyConfig{{Name: "dashboard", Key: "key", Role: models.RoleAdmin}},
+		ClientCertificate: &models.ClientCertificateConfig{Roles: map[string]models.Role{"dashboard": models.RoleViewer}},
+	})
+	if err != nil {
+		t.Fatalf("CreateAuth returned error: %v", err)
+	}
+
+	if methods := a.Methods(); len(methods) != 2 || methods[1] != MethodCertificate {
+		t.Errorf("Methods() = %v, expected the certificate method last", methods)
+	}
+
+	// an API key takes precedence over the client certificate
+	r := certificateRequest(certificate("dashboard"))
+	r.Header.Set(apiKeyHeader, "key")
+	if identity, err := a.Authenticate(r); err != nil || identity.Method != MethodAPIKey {
+		t.Errorf("Authenticate = %+v, %v, expected the API key identity", identity, err)
+	}
+
+	if _, err := CreateAuth(models.AuthConfig{ClientCertificate: &models.ClientCertificateConfig{Roles: map[string]models.Role{"a": "owner"}}}); err == nil {
+		t.Error("CreateAuth should return an error for an unknown role")
+	}
+}
+
+func certificate(commonName string) *x509.Certificate {
+	return &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+}
+
+// certificateRequest returns a request over TLS with the given client certificate as verified chain
+func certificateRequest(cert *x509.Certificate) *http.Request {
+	r := httptest.NewRequest("GET", "/Connectors", nil)
+	r.TLS = &tls.ConnectionState{}
+	if cert != nil {
+		r.TLS.PeerCertificates = []*x509.Certificate{cert}
+		r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+
+	return r
+}
+
+func unverifiedCertificateRequest(commonName string) *http.Request {
+	r := certificateRequest(nil)
+	r.TLS.PeerCertificates = []*x509.Certificate{certificate(commonName)}
+	return r
+}
@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// jwtLeeway is the allowed clock difference when checking the exp and nbf claims
+const jwtLeeway = 30 * time.Second
+
+// jwtClaims holds the registered claims that are validated, aud can be a string or an array
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+}
+
+type jwtAuthenticator struct {
+	config    models.JWTConfig
+	hash      func() hash.Hash
+	cryptoAlg crypto.Hash
+	publicKey *rsa.PublicKey
+}
+
+func createJWTAuthenticator(config models.JWTConfig) (*jwtAuthenticator, error) {
+	if len(config.Algorithm) == 0 {
+		config.Algorithm = "HS256"
+	}
+
+	a := &jwtAuthenticator{config: config}
+	switch config.Algorithm {
+	case "HS256":
+		a.hash = sha256.New
+	case "HS384":
+		a.hash = sha512.New384
+	case "HS512":
+		a.hash = sha512.New
+	case "RS256":
+		a.cryptoAlg = crypto.SHA256
+	default:
+		return nil, fmt.Errorf("Unsupported JWT algorithm %s", config.Algorithm)
+	}
+
+	if a.hash != nil && len(config.Secret) == 0 {
+		return nil, fmt.Errorf("JWT algorithm %s requires a secret", config.Algorithm)
+	}
+
+	if a.cryptoAlg != 0 {
+		key, err := readPublicKey(config.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		a.publicKey = key
+	}
+
+	return a, nil
+}
+
+// readPublicKey reads a PEM encoded RSA public key or certificate
+func readPublicKey(file string) (*rsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read JWT public key: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("Unable to decode JWT public key")
+	}
+
+	var key interface{}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = cert.PublicKey
+	} else if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("JWT public key is not an RSA key")
+	}
+
+	return rsaKey, nil
+}
+
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (*models.Identity, error) {
+	token := bearerToken(r)
+	if len(token) == 0 {
+		return nil, nil
+	}
+
+	payload, err := a.verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &jwtClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, invalidToken("unable to parse claims")
+	}
+
+	if err := a.validate(claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	identity := &models.Identity{Name: claims.Subject, Method: MethodJWT}
+	if len(a.config.RoleClaim) > 0 {
+		identity.Role = roleClaim(payload, a.config.RoleClaim)
+	}
+
+	return identity, nil
+}
+
+func (a *jwtAuthenticator) Challenge() string {
+	return `Bearer realm="sensorthings-connector"`
+}
+
+// verify checks the header and signature of a token and returns the decoded payload
+func (a *jwtAuthenticator) verify(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed")
+	}
+
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, invalidToken("malformed header")
+	}
+
+	header := struct {
+		Algorithm string `json:"alg"`
+	}{}
+	if err := json.Unmarshal(headerData, &header); err != nil || header.Algorithm != a.config.Algorithm {
+		return nil, invalidToken("unexpected algorithm")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	if a.hash != nil {
+		mac := hmac.New(a.hash, []byte(a.config.Secret))
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return nil, invalidToken("signature mismatch")
+		}
+	} else {
+		h := a.cryptoAlg.New()
+		h.Write(signed)
+		if rsa.VerifyPKCS1v15(a.publicKey, a.cryptoAlg, h.Sum(nil), signature) != nil {
+			return nil, invalidToken("signature mismatch")
+		}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, invalidToken("malformed payload")
+	}
+
+	return payload, nil
+}
+
+// validate checks the time, issuer and audience claims of a token, a token without exp claim is
+// only accepted when the config allows it
+func (a *jwtAuthenticator) validate(claims *jwtClaims, now time.Time) error {
+	if claims.ExpiresAt == nil && !a.config.AllowMissingExpiry {
+		return invalidToken("missing expiry")
+	}
+
+	if claims.ExpiresAt != nil && now.Add(-jwtLeeway).After(unixTime(*claims.ExpiresAt)) {
+		return invalidToken("expired")
+	}
+
+	if claims.NotBefore != nil && now.Add(jwtLeeway).Before(unixTime(*claims.NotBefore)) {
+		return invalidToken("not yet valid")
+	}
+
+	if len(a.config.Issuer) > 0 && claims.Issuer != a.config.Issuer {
+		return invalidToken("unexpected issuer")
+	}
+
+	if len(a.config.Audience) > 0 && !hasAudience(claims.Audience, a.config.Audience) {
+		return invalidToken("unexpected audience")
+	}
+
+	if len(claims.Subject) == 0 {
+		return invalidToken("missing subject")
+	}
+
+	return nil
+}
+
+// roleClaim reads the role from the claim with the given name, when the claim is an array
+// the first known role is used
+func roleClaim(payload []byte, name string) models.Role {
+	claims := make(map[string]json.RawMessage)
+	if json.Unmarshal(payload, &claims) != nil {
+		return ""
+	}
+
+	var role models.Role
+	if json.Unmarshal(claims[name], &role) == nil {
+		return role
+	}
+
+	var roles []models.Role
+	json.Unmarshal(claims[name], &roles)
+	for _, r := range roles {
+		if r.IsValid() {
+			return r
+		}
+	}
+
+	return ""
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(int64(seconds), 0)
+}
+
+// hasAudience checks if the aud claim, a string or an array of strings, contains the audience
+func hasAudience(aud json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(aud, &single) == nil {
+		return single == audience
+	}
+
+	var list []string
+	if json.Unmarshal(aud, &list) == nil {
+		for _, a := range list {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
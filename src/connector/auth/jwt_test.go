@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+const testSecret = "test-secret"
+
+func TestJWTAuthenticateHS256(t *testing.T) {
+	a := createTestJWTAuthenticator(t, models.JWTConfig{Secret: testSecret, Issuer: "issuer", Audience: "connector", RoleClaim: "role"})
+	now := time.Now().Unix()
+	valid := map[string]interface{}{"sub": "alice", "iss": "issuer", "aud": "connector", "exp": now + 60, "role": "operator"}
+
+	tests := []struct {
+		name    string
+		token   string
+		success bool
+	}{
+		{"valid", signHS256(t, "HS256", testSecret, valid), true},
+		{"audience in array", signHS256(t, "HS256", testSecret, with(valid, "aud", []string{"other", "connector"})), true},
+		{"expired within leeway", signHS256(t, "HS256", testSecret, with(valid, "exp", now-20)), true},
+		{"not yet valid within leeway", signHS256(t, "HS256", testSecret, with(valid, "nbf", now+20)), true},
+		{"expired", signHS256(t, "HS256", testSecret, with(valid, "exp", now-40)), false},
+		{"not yet valid", signHS256(t, "HS256", testSecret, with(valid, "nbf", now+40)), false},
+		{"missing expiry", signHS256(t, "HS256", testSecret, without(valid, "exp")), false},
+		{"wrong issuer", signHS256(t, "HS256", testSecret, with(valid, "iss", "other")), false},
+		{"missing issuer", signHS256(t, "HS256", testSecret, without(valid, "iss")), false},
+		{"wrong audience", signHS256(t, "HS256", testSecret, with(valid, "aud", "other")), false},
+		{"audience not in array", signHS256(t, "HS256", testSecret, with(valid, "aud", []string{"a", "b"})), false},
+		{"missing subject", signHS256(t, "HS256", testSecret, without(valid, "sub")), false},
+		{"bad signature", signHS256(t, "HS256", "other-secret", valid), false},
+		{"other HMAC algorithm", signHS256(t, "HS384", testSecret, valid), false},
+		{"algorithm none", unsigned(t, "none", valid), false},
+		{"algorithm none with signature", unsigned(t, "none", valid) + "c2lnbmF0dXJl", false},
+		{"malformed", "abc.def", false},
+		{"malformed payload", "eyJhbGciOiJIUzI1NiJ9.!!!.c2ln", false},
+	}
+
+	for _, test := range tests {
+		identity, err := a.Authenticate(bearerRequest(test.token))
+		if test.success {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			} else if identity.Name != "alice" || identity.Method != MethodJWT || identity.Role != models.RoleOperator {
+				t.Errorf("%s: unexpected identity %+v", test.name, identity)
+			}
+		} else if err == nil {
+			t.Errorf("%s: token should be rejected", test.name)
+		}
+	}
+}
+
+func TestJWTAllowMissingExpiry(t *testing.T) {
+	a := createTestJWTAuthenticator(t, models.JWTConfig{Secret: testSecret, AllowMissingExpiry: true})
+	token := signHS256(t, "HS256", testSecret, map[string]interface{}{"sub": "alice"})
+	if _, err := a.Authenticate(bearerRequest(token)); err != nil {
+		t.Errorf("token without exp should be accepted when allowed: %v", err)
+	}
+
+	expired := signHS256(t, "HS256", testSecret, map[string]interface{}{"sub": "alice", "exp": time.Now().Unix() - 60})
+	if _, err := a.Authenticate(bearerRequest(expired)); err == nil {
+		t.Error("an expired token should be rejected when missing expiry is allowed")
+	}
+}
+
+func TestJWTRoleClaimArray(t *testing.T) {
+	a := createTestJWTAuthenticator(t, models.JWTConfig{Secret: testSecret, RoleClaim: "roles"})
+	claims := map[string]interface{}{"sub": "alice", "exp": time.Now().Unix() + 60, "roles": []string{"unknown", "viewer", "admin"}}
+	identity, err := a.Authenticate(bearerRequest(signHS256(t, "HS256", testSecret, claims)))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if identity.Role != models.RoleViewer {
+		t.Errorf("role = %q, expected the first known role %q", identity.Role, models.RoleViewer)
+	}
+}
+
+func TestJWTAuthenticateRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: mustMarshalPKIX(t, &key.PublicKey)})
+	keyFile := filepath.Join(t.TempDir(), "public.pem")
+	if err := ioutil.WriteFile(keyFile, publicKeyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a := createTestJWTAuthenticator(t, models.JWTConfig{Algorithm: "RS256", PublicKeyFile: keyFile})
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]interface{}{"sub": "alice", "exp": time.Now().Unix() + 60}
+	tests := []struct {
+		name    string
+		token   string
+		success bool
+	}{
+		{"valid", signRS256(t, key, claims), true},
+		{"other key", signRS256(t, otherKey, claims), false},
+		// alg confusion, an HS256 token signed with the public key as HMAC secret
+		{"HS256 signed with public key", signHS256(t, "HS256", string(publicKeyPEM), claims), false},
+		{"RS256 header with HMAC signature", signHS256(t, "RS256", string(publicKeyPEM), claims), false},
+		{"algorithm none", unsigned(t, "none", claims), false},
+	}
+
+	for _, test := range tests {
+		_, err := a.Authenticate(bearerRequest(test.token))
+		if test.success && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if !test.success && err == nil {
+			t.Errorf("%s: token should be rejected", test.name)
+		}
+	}
+}
+
+func TestCreateJWTAuthenticatorErrors(t *testing.T) {
+	configs := []models.JWTConfig{
+		{Algorithm: "none"},
+		{Algorithm: "ES256"},
+		{Algorithm: "HS256"},
+		{Algorithm: "RS256", PublicKeyFile: filepath.Join(os.TempDir(), "missing-jwt-key.pem")},
+	}
+
+	for _, config := range configs {
+		if _, err := createJWTAuthenticator(config); err == nil {
+			t.Errorf("createJWTAuthenticator(%+v) should return an error", config)
+		}
+	}
+}
+
+func TestNoBearerToken(t *testing.T) {
+	a := createTestJWTAuthenticator(t, models.JWTConfig{Secret: testSecret})
+	r := httptest.NewRequest("GET", "/Connectors", nil)
+	r.SetBasicAuth("alice", "password")
+	if identity, err := a.Authenticate(r); identity != nil || err != nil {
+		t.Errorf("a request without bearer token should be ignored, got %+v, %v", identity, err)
+	}
+}
+
+func createTestJWTAuthenticator(t *testing.T, config models.JWTConfig) *jwtAuthenticator {
+	a, err := createJWTAuthenticator(config)
+	if err != nil {
+		t.Fatalf("createJWTAuthenticator returned error: %v", err)
+	}
+
+	return a
+}
+
+func bearerRequest(token string) *http.Request {
+	r := httptest.NewRequest("GET", "/Connectors", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func signHS256(t *testing.T, alg string, secret string, claims map[string]interface{}) string {
+	signed := unsigned(t, alg, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed[:len(signed)-1]))
+	return signed + encode(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	signed := unsigned(t, "RS256", claims)
+	h := sha256.Sum256([]byte(signed[:len(signed)-1]))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + encode(signature)
+}
+
+// unsigned returns the header and payload of a token followed by a dot
+func unsigned(t *testing.T, alg string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encode(header) + "." + encode(payload) + "."
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func mustMarshalPKIX(t *testing.T, key *rsa.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return der
+}
+
+func with(claims map[string]interface{}, name string, value interface{}) map[string]interface{} {
+	c := without(claims, name)
+	c[name] = value
+	return c
+}
+
+func without(claims map[string]interface{}, name string) map[string]interface{} {
+	c := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		if k != name {
+			c[k] = v
+		}
+	}
+
+	return c
+}
@@ -10,11 +10,29 @@ import (
 //   HttpHost: the host were the rest interface should run on
 //   PubClient: te publish client, see PubClient
 //   PubBroker: te publish broker, see PubBroker
+//   ExternalModules: modules that run as a separate process, see ExternalModuleConfig
+//   Auth: authentication of the REST API, see AuthConfig
+//   ConnectorFiles: directory of connector definitions, see ConnectorFilesConfig
+//   CORS: origins allowed to use the REST API from a browser, see CORSConfig
+//   TLS: HTTPS for the REST API, see TLSConfig
+//   Audit: retention of the audit log, see AuditConfig
+//   Encryption: key to encrypt the connectors in the database, see EncryptionConfig
+//   Log: level and format of the log, see LogConfig
+//   Health: conditions that make the connector not ready, see HealthConfig
 type Config struct {
-	HttpHost  string           `json:"httpHost"`
-	PubClient models.PubClient `json:"publishClient"`
-	PubBroker models.PubBroker `json:"publishBroker"`
-	Database  string           `json:"database"`
+	HttpHost        string                        `json:"httpHost"`
+	PubClient       models.PubClient              `json:"publishClient"`
+	PubBroker       models.PubBroker              `json:"publishBroker"`
+	Database        string                        `json:"database"`
+	ExternalModules []models.ExternalModuleConfig `json:"externalModules"`
+	Auth            models.AuthConfig             `json:"auth"`
+	ConnectorFiles  models.ConnectorFilesConfig   `json:"connectorFiles"`
+	CORS            models.CORSConfig             `json:"cors"`
+	TLS             models.TLSConfig              `json:"tls"`
+	Audit           models.AuditConfig            `json:"audit"`
+	Encryption      models.EncryptionConfig       `json:"encryption"`
+	Log             models.LogConfig              `json:"log"`
+	Health          models.HealthConfig           `json:"health"`
 }
 
 // readFile reads the bytes from a given file
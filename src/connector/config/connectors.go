@@ -0,0 +1,140 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+	"gopkg.in/yaml.v2"
+)
+
+// ConnectorFile is a connector definition read from a file, Err is set when the file could not be read
+type ConnectorFile struct {
+	Path       string
+	Definition models.ConnectorDefinition
+	Err        error
+}
+
+// ReadConnectorFiles reads all connector definitions from the .json, .yaml and .yml files in the given
+// directory ordered by file name, a definition without id gets the file name without extension as id
+func ReadConnectorFiles(dir string) ([]ConnectorFile, error) {
+	paths, err := connectorFilePaths(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]ConnectorFile, 0, len(paths))
+	for _, path := range paths {
+		file := ConnectorFile{Path: path}
+		file.Definition, file.Err = readConnectorFile(path)
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// ConnectorFilesState returns a description of the connector files in a directory which changes when
+// a file is added, changed or removed
+func ConnectorFilesState(dir string) (string, error) {
+	paths, err := connectorFilePaths(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var state strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		fmt.Fprintf(&state, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+	}
+
+	return state.String(), nil
+}
+
+// YAMLToJSON converts a YAML document into JSON
+func YAMLToJSON(b []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jsonValue(doc))
+}
+
+// connectorFilePaths returns the sorted paths of the connector files in a directory
+func connectorFilePaths(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml":
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// readConnectorFile parses a single connector definition file
+func readConnectorFile(path string) (models.ConnectorDefinition, error) {
+	def := models.ConnectorDefinition{}
+	content, err := readFile(path)
+	if err != nil {
+		return def, err
+	}
+
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".json" {
+		if content, err = YAMLToJSON(content); err != nil {
+			return def, err
+		}
+	}
+
+	if err := json.Unmarshal(content, &def); err != nil {
+		return def, err
+	}
+
+	if len(def.ID) == 0 {
+		def.ID = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	if len(def.Name) == 0 {
+		def.Name = def.ID
+	}
+
+	return def, nil
+}
+
+// jsonValue converts the maps decoded by yaml, which can have any key type, into maps with string keys
+func jsonValue(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			m[fmt.Sprint(k)] = jsonValue(v)
+		}
+		return m
+	case []interface{}:
+		for i, v := range n {
+			n[i] = jsonValue(v)
+		}
+	}
+
+	return node
+}
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"crypto/cipher"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -12,9 +14,13 @@ import (
 
 var open bool
 var connectorBucketName = "connectors"
+var templateBucketName = "templates"
+var roleBucketName = "roles"
+var auditBucketName = "audit"
 
 type Database struct {
 	bolt *bolt.DB
+	aead cipher.AEAD
 }
 
 func (db *Database) Open(dbPath string) error {
@@ -28,9 +34,17 @@ func (db *Database) Open(dbPath string) error {
 
 	db.bolt.Update(func(tx *bolt.Tx) error {
 		tx.CreateBucketIfNotExists([]byte(connectorBucketName))
+		tx.CreateBucketIfNotExists([]byte(templateBucketName))
+		tx.CreateBucketIfNotExists([]byte(roleBucketName))
+		tx.CreateBucketIfNotExists([]byte(auditBucketName))
 		return nil
 	})
 
+	if err = db.migrate(); err != nil {
+		db.bolt.Close()
+		return err
+	}
+
 	open = true
 	return nil
 }
@@ -40,6 +54,40 @@ func (db *Database) Close() {
 	db.bolt.Close()
 }
 
+// Check returns an error when the database is not opened or can not be read
+func (db *Database) Check() error {
+	if !open {
+		return fmt.Errorf("db is not opened")
+	}
+
+	return db.bolt.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(connectorBucketName)) == nil {
+			return fmt.Errorf("db is missing bucket %s", connectorBucketName)
+		}
+
+		return nil
+	})
+}
+
+// connectorRecord is the stored form of a connector, the definition with the revision and source of
+// the connector. The runtime state added to the JSON of a ConnectorBase is not stored
+type connectorRecord struct {
+	models.ConnectorDefinition
+	Revision int64  `json:"revision"`
+	Source   string `json:"source,omitempty"`
+}
+
+func newConnectorRecord(connector *models.ConnectorBase) *connectorRecord {
+	return &connectorRecord{ConnectorDefinition: connector.GetDefinition(), Revision: connector.Revision, Source: connector.Source}
+}
+
+func (r *connectorRecord) toConnector() *models.ConnectorBase {
+	connector := r.ToConnector()
+	connector.Revision = r.Revision
+	connector.Source = r.Source
+	return connector
+}
+
 // InsertConnector inserts or updates a connector in the database
 func (db *Database) InsertConnector(connector *models.ConnectorBase) error {
 	if !open {
@@ -47,17 +95,79 @@ func (db *Database) InsertConnector(connector *models.ConnectorBase) error {
 	}
 	err := db.bolt.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(connectorBucketName))
-		enc, err := json.Marshal(connector)
+		enc, err := json.Marshal(newConnectorRecord(connector))
 		if err != nil {
 			return fmt.Errorf("could not encode module %s: %s", connector.GetName(), err)
 		}
 
+		if enc, err = db.encodeRecord(connectorBucketName, []byte(connector.GetID()), enc); err != nil {
+			return fmt.Errorf("could not encrypt module %s: %s", connector.GetName(), err)
+		}
+
 		err = b.Put([]byte(connector.GetID()), enc)
 		return err
 	})
 	return err
 }
 
+// RevisionError is returned by UpdateConnector when the stored connector does not have the expected revision
+type RevisionError struct {
+	ID      string
+	Current int64
+}
+
+func (e *RevisionError) Error() string {
+	return fmt.Sprintf("connector %s has been changed, the stored revision is %d", e.ID, e.Current)
+}
+
+// UpdateConnector replaces a connector in the database when the stored connector still has the given
+// revision, the revision is checked in the transaction that saves the connector. A RevisionError is
+// returned when the stored revision differs, connectors stored without revision have revision 1
+func (db *Database) UpdateConnector(connector *models.ConnectorBase, revision int64) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving!")
+	}
+
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(connectorBucketName))
+		key := []byte(connector.GetID())
+		c, err := db.decode(connectorBucketName, key, b.Get(key))
+		if err != nil {
+			return err
+		}
+
+		if c == nil {
+			return fmt.Errorf("connector %s not found in db", connector.GetID())
+		}
+
+		stored := &connectorRecord{}
+		if err := json.Unmarshal(c, stored); err != nil {
+			return err
+		}
+
+		current := stored.Revision
+		if current == 0 {
+			current = 1
+		}
+
+		if current != revision {
+			return &RevisionError{ID: connector.GetID(), Current: current}
+		}
+
+		enc, err := json.Marshal(newConnectorRecord(connector))
+		if err != nil {
+			return fmt.Errorf("could not encode module %s: %s", connector.GetName(), err)
+		}
+
+		if enc, err = db.encodeRecord(connectorBucketName, key, enc); err != nil {
+			return fmt.Errorf("could not encrypt module %s: %s", connector.GetName(), err)
+		}
+
+		return b.Put(key, enc)
+	})
+	return err
+}
+
 // GetConnectors loads all connectors from the database
 func (db *Database) GetConnectors() ([]*models.ConnectorBase, error) {
 	if !open {
@@ -70,14 +180,18 @@ func (db *Database) GetConnectors() ([]*models.ConnectorBase, error) {
 		c := b.Cursor()
 
 		for k, v := c.First(); k != nil; k, v = c.Next() {
-			con := &models.ConnectorBase{}
-			err := json.Unmarshal(v, &con)
+			record := &connectorRecord{}
+			v, err := db.decode(connectorBucketName, k, v)
+			if err == nil {
+				err = json.Unmarshal(v, record)
+			}
+
 			if err != nil {
 				log.Printf("Error loading connector fro db: %v", string(k[:]))
 				continue
 			}
 
-			connectors = append(connectors, con)
+			connectors = append(connectors, record.toConnector())
 		}
 
 		return nil
@@ -114,15 +228,23 @@ func (db *Database) SaveConnectorState(id string, running bool) error {
 
 	err := db.bolt.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(connectorBucketName))
-		c := b.Get([]byte(id))
+		c, err := db.decode(connectorBucketName, []byte(id), b.Get([]byte(id)))
+		if err != nil {
+			return err
+		}
+
 		if c != nil {
-			con := &models.ConnectorBase{}
-			if err := json.Unmarshal(c, &con); err != nil {
+			record := &connectorRecord{}
+			if err := json.Unmarshal(c, record); err != nil {
 				return err
 			} else {
-				con.Running = running
-				enc, _ := json.Marshal(con)
-				if err = b.Put([]byte(con.GetID()), enc); err != nil {
+				record.Running = running
+				enc, _ := json.Marshal(record)
+				if enc, err = db.encodeRecord(connectorBucketName, []byte(id), enc); err != nil {
+					return err
+				}
+
+				if err = b.Put([]byte(id), enc); err != nil {
 					return err
 				}
 
@@ -134,3 +256,259 @@ func (db *Database) SaveConnectorState(id string, running bool) error {
 
 	return err
 }
+
+// InsertTemplate inserts or updates a connector template in the database
+func (db *Database) InsertTemplate(template *models.ConnectorTemplate) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving!")
+	}
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(templateBucketName))
+		enc, err := json.Marshal(template)
+		if err != nil {
+			return fmt.Errorf("could not encode template %s: %s", template.Name, err)
+		}
+
+		if enc, err = db.encodeRecord(templateBucketName, []byte(template.ID), enc); err != nil {
+			return fmt.Errorf("could not encrypt template %s: %s", template.Name, err)
+		}
+
+		err = b.Put([]byte(template.ID), enc)
+		return err
+	})
+	return err
+}
+
+// GetTemplates loads all connector templates from the database
+func (db *Database) GetTemplates() ([]*models.ConnectorTemplate, error) {
+	if !open {
+		return nil, fmt.Errorf("db must be opened before reading!")
+	}
+
+	templates := make([]*models.ConnectorTemplate, 0)
+	err := db.bolt.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(templateBucketName))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			template := &models.ConnectorTemplate{}
+			v, err := db.decode(templateBucketName, k, v)
+			if err == nil {
+				err = json.Unmarshal(v, template)
+			}
+
+			if err != nil {
+				log.Printf("Error loading template from db: %v", string(k[:]))
+				continue
+			}
+
+			templates = append(templates, template)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// DeleteTemplate removes a connector template from the database
+func (db *Database) DeleteTemplate(id string) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving!")
+	}
+
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(templateBucketName))
+		return b.Delete([]byte(id))
+	})
+
+	return err
+}
+
+// InsertRoleAssignment inserts or updates the role assignment of an identity in the database
+func (db *Database) InsertRoleAssignment(assignment *models.RoleAssignment) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving!")
+	}
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(roleBucketName))
+		enc, err := json.Marshal(assignment)
+		if err != nil {
+			return fmt.Errorf("could not encode role assignment %s: %s", assignment.Identity, err)
+		}
+
+		err = b.Put([]byte(assignment.Key()), enc)
+		return err
+	})
+	return err
+}
+
+// GetRoleAssignments loads all role assignments from the database
+func (db *Database) GetRoleAssignments() ([]*models.RoleAssignment, error) {
+	if !open {
+		return nil, fmt.Errorf("db must be opened before reading!")
+	}
+
+	assignments := make([]*models.RoleAssignment, 0)
+	err := db.bolt.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(roleBucketName))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			assignment := &models.RoleAssignment{}
+			if err := json.Unmarshal(v, assignment); err != nil {
+				log.Printf("Error loading role assignment from db: %v", string(k[:]))
+				continue
+			}
+
+			assignments = append(assignments, assignment)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return assignments, nil
+}
+
+// DeleteRoleAssignment removes the role assignment of an identity authenticated with method from the database
+func (db *Database) DeleteRoleAssignment(method string, identity string) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving!")
+	}
+
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(roleBucketName))
+		return b.Delete([]byte(models.RoleAssignmentKey(method, identity)))
+	})
+
+	return err
+}
+
+// InsertAuditEvent appends an audit event to the database, the event is given the next sequence number
+// as id. Events older than retention and the oldest events exceeding maxEvents are removed, a retention
+// or maxEvents of 0 keeps the events
+func (db *Database) InsertAuditEvent(event *models.AuditEvent, retention time.Duration, maxEvents int) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving!")
+	}
+
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(auditBucketName))
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		event.ID = id
+		enc, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("could not encode audit event %d: %s", id, err)
+		}
+
+		if err = b.Put(auditKey(id), enc); err != nil {
+			return err
+		}
+
+		return purgeAuditEvents(b, event.Time.Add(-retention), retention > 0, maxEvents)
+	})
+
+	return err
+}
+
+// purgeAuditEvents removes the events before cutoff when expire is true and the oldest events
+// when there are more than maxEvents events
+func purgeAuditEvents(b *bolt.Bucket, cutoff time.Time, expire bool, maxEvents int) error {
+	c := b.Cursor()
+	first, _ := c.First()
+	last, _ := c.Last()
+	if first == nil {
+		return nil
+	}
+
+	// events are only removed from the start so the ids of the stored events are consecutive
+	excess := 0
+	if maxEvents > 0 {
+		excess = int(binary.BigEndian.Uint64(last)-binary.BigEndian.Uint64(first)) + 1 - maxEvents
+	}
+
+	expired := make([][]byte, 0)
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if len(expired) >= excess {
+			if !expire {
+				break
+			}
+
+			event := &models.AuditEvent{}
+			if err := json.Unmarshal(v, event); err == nil && !event.Time.Before(cutoff) {
+				break
+			}
+		}
+
+		expired = append(expired, k)
+	}
+
+	for _, k := range expired {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAuditEvents loads the audit events matching the query from the database, newest first
+func (db *Database) GetAuditEvents(query *models.AuditQuery) ([]*models.AuditEvent, error) {
+	if !open {
+		return nil, fmt.Errorf("db must be opened before reading!")
+	}
+
+	events := make([]*models.AuditEvent, 0)
+	err := db.bolt.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(auditBucketName))
+		c := b.Cursor()
+
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			event := &models.AuditEvent{}
+			if err := json.Unmarshal(v, event); err != nil {
+				log.Printf("Error loading audit event from db: %d", binary.BigEndian.Uint64(k))
+				continue
+			}
+
+			if !query.Since.IsZero() && event.Time.Before(query.Since) {
+				break
+			}
+
+			if !query.Matches(event) {
+				continue
+			}
+
+			events = append(events, event)
+			if query.Limit > 0 && len(events) >= query.Limit {
+				break
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// auditKey encodes the id of an audit event as key, big endian keeps the events ordered by id
+func auditKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
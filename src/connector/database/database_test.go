@@ -0,0 +1,58 @@
+package database
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+func TestConnectorRecord(t *testing.T) {
+	db := openTestDatabase(t, filepath.Join(t.TempDir(), "connector.db"), nil)
+	defer db.Close()
+
+	connector := &models.ConnectorBase{ID: "1", Name: "connector", ModuleName: "MQTT", Settings: json.RawMessage(`{}`),
+		Labels: map[string]string{"site": "a"}, Revision: 3, Source: "/etc/connectors/1.json"}
+	if err := db.InsertConnector(connector); err != nil {
+		t.Fatalf("InsertConnector returned error: %v", err)
+	}
+
+	if err := db.SaveConnectorState("1", true); err != nil {
+		t.Fatalf("SaveConnectorState returned error: %v", err)
+	}
+
+	// only the definition, revision and source are stored, not the runtime state
+	var record map[string]interface{}
+	if err := json.Unmarshal(rawRecord(t, db, connectorBucketName, "1"), &record); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make([]string, 0, len(record))
+	for k := range record {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	if got := strings.Join(keys, ","); got != "description,id,labels,module,name,revision,running,settings,source" {
+		t.Errorf("stored fields = %s", got)
+	}
+
+	connectors, err := db.GetConnectors()
+	if err != nil || len(connectors) != 1 {
+		t.Fatalf("GetConnectors = %v, %v, expected one connector", connectors, err)
+	}
+
+	c := connectors[0]
+	if c.Name != "connector" || !c.Running || c.Revision != 3 || c.Source != connector.Source || c.Labels["site"] != "a" {
+		t.Errorf("unexpected connector %+v", c)
+	}
+
+	if err := db.UpdateConnector(connector, 2); err == nil {
+		t.Error("UpdateConnector with another revision should return an error")
+	} else if revisionErr, ok := err.(*RevisionError); !ok || revisionErr.Current != 3 {
+		t.Errorf("UpdateConnector returned %v, expected a RevisionError with revision 3", err)
+	}
+}
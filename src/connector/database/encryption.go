@@ -0,0 +1,249 @@
+package database
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// keySize is the size of an encryption key, 32 bytes selects AES-256
+const keySize = 32
+
+// encryptedPrefix starts every encrypted record, records without the prefix are plain JSON
+var encryptedPrefix = []byte("\x00aes-gcm:")
+
+// encryptedBuckets are the buckets holding records with settings, the records in these buckets
+// are encrypted when an encryption key is set
+var encryptedBuckets = []string{connectorBucketName, templateBucketName}
+
+// GenerateKey creates a random base64 encoded encryption key
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// LoadKey reads the encryption key from the key file or environment variable of the config,
+// nil is returned when no key is configured
+func LoadKey(config models.EncryptionConfig) ([]byte, error) {
+	if len(config.KeyFile) > 0 {
+		return ReadKeyFile(config.KeyFile)
+	}
+
+	if len(config.KeyEnv) > 0 {
+		value, ok := os.LookupEnv(config.KeyEnv)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", config.KeyEnv)
+		}
+
+		return decodeKey(value)
+	}
+
+	return nil, nil
+}
+
+// ReadKeyFile reads a base64 encoded encryption key from a file
+func ReadKeyFile(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeKey(string(content))
+}
+
+func decodeKey(value string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, errors.New("encryption key is not base64 encoded")
+	}
+
+	if len(key) != keySize {
+		return nil, fmt.Errorf("encryption key should be %d bytes, got %d", keySize, len(key))
+	}
+
+	return key, nil
+}
+
+// SetEncryptionKey sets the key used to encrypt and decrypt the records, the key has to be set before the
+// database is opened. A nil key stores the records unencrypted
+func (db *Database) SetEncryptionKey(key []byte) error {
+	aead, err := createAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	db.aead = aead
+	return nil
+}
+
+// Reencrypt decrypts all records using the current key and encrypts them with the new key in a
+// single transaction, a nil key stores the records unencrypted
+func (db *Database) Reencrypt(key []byte) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving!")
+	}
+
+	aead, err := createAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	err = db.bolt.Update(func(tx *bolt.Tx) error {
+		return rewriteRecords(tx, func(bucket string, k, v []byte) ([]byte, error) {
+			plain, err := db.decode(bucket, k, v)
+			if err != nil {
+				return nil, err
+			}
+
+			return encode(aead, bucket, k, plain)
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	db.aead = aead
+	return nil
+}
+
+// migrate encrypts the unencrypted records when a key is set and checks if all encrypted records can be
+// decrypted, an error is returned when the key is missing or wrong
+func (db *Database) migrate() error {
+	migrated := 0
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		return rewriteRecords(tx, func(bucket string, k, v []byte) ([]byte, error) {
+			if isEncrypted(v) {
+				_, err := db.decode(bucket, k, v)
+				return nil, err
+			}
+
+			if db.aead == nil {
+				return nil, nil
+			}
+
+			migrated++
+			return encode(db.aead, bucket, k, v)
+		})
+	})
+
+	if err == nil && migrated > 0 {
+		log.Printf("Encrypted %d records in the database", migrated)
+	}
+
+	return err
+}
+
+// rewriteRecords calls rewrite for every record in the encrypted buckets and stores the returned
+// value, the record is left unchanged when rewrite returns nil
+func rewriteRecords(tx *bolt.Tx, rewrite func(bucket string, k, v []byte) ([]byte, error)) error {
+	for _, name := range encryptedBuckets {
+		b := tx.Bucket([]byte(name))
+		updates := make(map[string][]byte)
+		err := b.ForEach(func(k, v []byte) error {
+			value, err := rewrite(name, k, v)
+			if err != nil {
+				return fmt.Errorf("record %s in %s: %v", string(k), name, err)
+			}
+
+			if value != nil {
+				updates[string(k)] = append([]byte{}, value...)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for k, v := range updates {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// encodeRecord prepares a JSON record of a bucket for storage, the record is encrypted when a key is set
+func (db *Database) encodeRecord(bucket string, key []byte, value []byte) ([]byte, error) {
+	return encode(db.aead, bucket, key, value)
+}
+
+// decode returns the JSON of a stored record, encrypted records are decrypted using the key
+func (db *Database) decode(bucket string, key []byte, value []byte) ([]byte, error) {
+	if !isEncrypted(value) {
+		return value, nil
+	}
+
+	if db.aead == nil {
+		return nil, errors.New("the record is encrypted but no encryption key is configured")
+	}
+
+	data := value[len(encryptedPrefix):]
+	nonceSize := db.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("the encrypted record is too short")
+	}
+
+	plain, err := db.aead.Open(nil, data[:nonceSize], data[nonceSize:], additionalData(bucket, key))
+	if err != nil {
+		return nil, errors.New("unable to decrypt the record, the encryption key is wrong or the record is corrupt")
+	}
+
+	return plain, nil
+}
+
+// encode encrypts a record using aead, the record is returned as is when aead is nil. The bucket and
+// key of the record are authenticated so an encrypted record can not be moved to another key
+func encode(aead cipher.AEAD, bucket string, key []byte, value []byte) ([]byte, error) {
+	if aead == nil {
+		return value, nil
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	record := append(append([]byte{}, encryptedPrefix...), nonce...)
+	return aead.Seal(record, nonce, value, additionalData(bucket, key)), nil
+}
+
+func createAEAD(key []byte) (cipher.AEAD, error) {
+	if key == nil {
+		return nil, nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func isEncrypted(value []byte) bool {
+	return bytes.HasPrefix(value, encryptedPrefix)
+}
+
+func additionalData(bucket string, key []byte) []byte {
+	return []byte(bucket + "/" + string(key))
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+const testSecret = "s3cr3t-password"
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "connector.db")
+	key := testKey(t)
+	db := openTestDatabase(t, path, key)
+	insertTestRecords(t, db)
+
+	for _, bucket := range encryptedBuckets {
+		value := rawRecord(t, db, bucket, "1")
+		if !isEncrypted(value) || bytes.Contains(value, []byte(testSecret)) {
+			t.Errorf("record in %s should be encrypted, got %q", bucket, value)
+		}
+	}
+
+	db.Close()
+	db = openTestDatabase(t, path, key)
+	defer db.Close()
+	checkTestRecords(t, db)
+}
+
+func TestMigratePlaintextRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "connector.db")
+	db := openTestDatabase(t, path, nil)
+	insertTestRecords(t, db)
+	if value := rawRecord(t, db, connectorBucketName, "1"); isEncrypted(value) {
+		t.Fatal("record should not be encrypted without a key")
+	}
+
+	db.Close()
+	db = openTestDatabase(t, path, testKey(t))
+	defer db.Close()
+
+	for _, bucket := range encryptedBuckets {
+		if value := rawRecord(t, db, bucket, "1"); !isEncrypted(value) {
+			t.Errorf("record in %s should be encrypted when the database is opened with a key", bucket)
+		}
+	}
+
+	checkTestRecords(t, db)
+}
+
+func TestReencrypt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "connector.db")
+	oldKey, newKey := testKey(t), testKey(t)
+	db := openTestDatabase(t, path, oldKey)
+	insertTestRecords(t, db)
+	before := rawRecord(t, db, connectorBucketName, "1")
+
+	if err := db.Reencrypt(newKey); err != nil {
+		t.Fatalf("Reencrypt returned error: %v", err)
+	}
+
+	if after := rawRecord(t, db, connectorBucketName, "1"); !isEncrypted(after) || bytes.Equal(before, after) {
+		t.Error("record should be encrypted with the new key")
+	}
+
+	checkTestRecords(t, db)
+	db.Close()
+
+	if err := openDatabase(path, oldKey); err == nil {
+		t.Error("the database should not open with the old key")
+	}
+
+	db = openTestDatabase(t, path, newKey)
+	checkTestRecords(t, db)
+
+	// a nil key decrypts all records
+	if err := db.Reencrypt(nil); err != nil {
+		t.Fatalf("Reencrypt(nil) returned error: %v", err)
+	}
+
+	for _, bucket := range encryptedBuckets {
+		if value := rawRecord(t, db, bucket, "1"); isEncrypted(value) {
+			t.Errorf("record in %s should not be encrypted after Reencrypt(nil)", bucket)
+		}
+	}
+
+	checkTestRecords(t, db)
+	db.Close()
+}
+
+func TestWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "connector.db")
+	db := openTestDatabase(t, path, testKey(t))
+	insertTestRecords(t, db)
+	db.Close()
+
+	err := openDatabase(path, testKey(t))
+	if err == nil || !strings.Contains(err.Error(), "encryption key is wrong") {
+		t.Errorf("opening with a wrong key should return the wrong key error, got %v", err)
+	}
+
+	err = openDatabase(path, nil)
+	if err == nil || !strings.Contains(err.Error(), "no encryption key is configured") {
+		t.Errorf("opening without a key should return the missing key error, got %v", err)
+	}
+}
+
+func TestMovedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "connector.db")
+	db := openTestDatabase(t, path, testKey(t))
+	defer db.Close()
+	insertTestRecords(t, db)
+
+	value := rawRecord(t, db, connectorBucketName, "1")
+	if _, err := db.decode(connectorBucketName, []byte("2"), value); err == nil {
+		t.Error("an encrypted record moved to another key should not decrypt")
+	}
+
+	if _, err := db.decode(templateBucketName, []byte("1"), value); err == nil {
+		t.Error("an encrypted record moved to another bucket should not decrypt")
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := decodeKey(key + "\n"); err != nil {
+		t.Errorf("decodeKey returned error for a generated key: %v", err)
+	}
+
+	for _, value := range []string{"not base64!", "c2hvcnQ="} {
+		if _, err := decodeKey(value); err == nil {
+			t.Errorf("decodeKey(%q) should return an error", value)
+		}
+	}
+}
+
+func testKey(t *testing.T) []byte {
+	encoded, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := decodeKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// openDatabase opens and closes the database at path with a key, the error of Open is returned
+func openDatabase(path string, key []byte) error {
+	db := &Database{}
+	if err := db.SetEncryptionKey(key); err != nil {
+		return err
+	}
+
+	if err := db.Open(path); err != nil {
+		return err
+	}
+
+	db.Close()
+	return nil
+}
+
+func openTestDatabase(t *testing.T, path string, key []byte) *Database {
+	db := &Database{}
+	if err := db.SetEncryptionKey(key); err != nil {
+		t.Fatalf("SetEncryptionKey returned error: %v", err)
+	}
+
+	if err := db.Open(path); err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+
+	return db
+}
+
+func insertTestRecords(t *testing.T, db *Database) {
+	settings := json.RawMessage(`{"password":"` + testSecret + `"}`)
+	if err := db.InsertConnector(&models.ConnectorBase{ID: "1", Name: "connector", ModuleName: "MQTT", Settings: settings}); err != nil {
+		t.Fatalf("InsertConnector returned error: %v", err)
+	}
+
+	if err := db.InsertTemplate(&models.ConnectorTemplate{ID: "1", Name: "template", ModuleName: "MQTT", Settings: settings}); err != nil {
+		t.Fatalf("InsertTemplate returned error: %v", err)
+	}
+}
+
+func checkTestRecords(t *testing.T, db *Database) {
+	connectors, err := db.GetConnectors()
+	if err != nil || len(connectors) != 1 {
+		t.Fatalf("GetConnectors = %v, %v, expected one connector", connectors, err)
+	}
+
+	if c := connectors[0]; c.Name != "connector" || !bytes.Contains(c.Settings, []byte(testSecret)) {
+		t.Errorf("unexpected connector %s with settings %s", c.Name, c.Settings)
+	}
+
+	templates, err := db.GetTemplates()
+	if err != nil || len(templates) != 1 {
+		t.Fatalf("GetTemplates = %v, %v, expected one template", templates, err)
+	}
+
+	if tmpl := templates[0]; tmpl.Name != "template" || !bytes.Contains(tmpl.Settings, []byte(testSecret)) {
+		t.Errorf("unexpected template %s with settings %s", tmpl.Name, tmpl.Settings)
+	}
+}
+
+// rawRecord returns the stored bytes of a record
+func rawRecord(t *testing.T, db *Database, bucket string, key string) []byte {
+	var value []byte
+	db.bolt.View(func(tx *bolt.Tx) error {
+		value = append([]byte{}, tx.Bucket([]byte(bucket)).Get([]byte(key))...)
+		return nil
+	})
+
+	if value == nil {
+		t.Fatalf("record %s not found in %s", key, bucket)
+	}
+
+	return value
+}
@@ -45,6 +45,16 @@ func NewRequestMethodNotAllowed(err error) error {
 	return NewErrorWithStatusCode(err, http.StatusMethodNotAllowed)
 }
 
+// NewConflictError creates an apiError with status code 409.
+func NewConflictError(err error) error {
+	return NewErrorWithStatusCode(err, http.StatusConflict)
+}
+
+// NewPreconditionFailedError creates an apiError with status code 412.
+func NewPreconditionFailedError(err error) error {
+	return NewErrorWithStatusCode(err, http.StatusPreconditionFailed)
+}
+
 // NewRequestInternalServerError creates an apiError with status code 500.
 func NewRequestInternalServerError(err error) error {
 	return NewErrorWithStatusCode(err, http.StatusInternalServerError)
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+var (
+	defaultCORSMethods        = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	defaultCORSHeaders        = []string{"Content-Type", "Authorization", "X-API-Key", "If-Match"}
+	defaultCORSExposedHeaders = []string{"ETag", "Location"}
+)
+
+// defaultCORSMaxAge is the time a browser can cache a preflight when no max age is configured
+const defaultCORSMaxAge = 600 * time.Second
+
+// cors adds the CORS headers to the responses of the REST API and answers preflight requests
+type cors struct {
+	origins     []string
+	methods     string
+	headers     string
+	anyHeader   bool
+	exposed     string
+	credentials bool
+	maxAge      string
+	next        http.Handler
+}
+
+// createCORSHandler wraps a handler with the CORS handling described by the config, the response writer
+// is passed on unchanged so streaming and WebSocket upgrades keep working. Credentials can only be allowed
+// for a list of origins, allowing them for all origins would let every website use the credentials of a browser
+func createCORSHandler(config models.CORSConfig, next http.Handler) (http.Handler, error) {
+	c := &cors{
+		origins:     config.AllowedOrigins,
+		methods:     strings.Join(withDefault(config.AllowedMethods, defaultCORSMethods), ", "),
+		headers:     strings.Join(withDefault(config.AllowedHeaders, defaultCORSHeaders), ", "),
+		exposed:     strings.Join(withDefault(config.ExposedHeaders, defaultCORSExposedHeaders), ", "),
+		credentials: config.AllowCredentials,
+		next:        next,
+	}
+
+	if len(c.origins) == 0 {
+		c.origins = []string{"*"}
+	}
+
+	for _, origin := range c.origins {
+		if origin == "*" && c.credentials {
+			return nil, errors.New("allowCredentials requires a list of allowed origins, * or no origins is not allowed")
+		}
+	}
+
+	for _, h := range config.AllowedHeaders {
+		c.anyHeader = c.anyHeader || h == "*"
+	}
+
+	maxAge := config.MaxAge * time.Second
+	if maxAge <= 0 {
+		maxAge = defaultCORSMaxAge
+	}
+
+	c.maxAge = strconv.Itoa(int(maxAge.Seconds()))
+	return c, nil
+}
+
+// ServeHTTP answers preflight requests and adds the CORS headers to all other requests from an allowed origin
+func (c *cors) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		c.next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Add("Vary", "Origin")
+	allowed := c.isAllowed(origin)
+	preflight := r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0
+	if preflight {
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		if !allowed {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		c.setOrigin(w, origin)
+		w.Header().Set("Access-Control-Allow-Methods", c.methods)
+		if c.anyHeader {
+			w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+		} else {
+			w.Header().Set("Access-Control-Allow-Headers", c.headers)
+		}
+
+		w.Header().Set("Access-Control-Max-Age", c.maxAge)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if allowed {
+		c.setOrigin(w, origin)
+		w.Header().Set("Access-Control-Expose-Headers", c.exposed)
+	}
+
+	c.next.ServeHTTP(w, r)
+}
+
+// setOrigin sets the allowed origin, the origin of the request is used when credentials are allowed
+// because browsers do not accept * in that case. Nothing is set for an origin that is not allowed
+func (c *cors) setOrigin(w http.ResponseWriter, origin string) {
+	if !c.isAllowed(origin) {
+		return
+	}
+
+	if c.credentials {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	} else if c.origins[0] == "*" && len(c.origins) == 1 {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+}
+
+// isAllowed checks if an origin matches one of the allowed origins
+func (c *cors) isAllowed(origin string) bool {
+	for _, allowed := range c.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+
+		if idx := strings.Index(allowed, "*."); idx >= 0 {
+			prefix, suffix := allowed[:idx], allowed[idx+1:]
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) && len(origin) > len(prefix)+len(suffix) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func withDefault(values []string, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+
+	return values
+}
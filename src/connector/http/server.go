@@ -1,10 +1,13 @@
 package http
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/tebben/sensorthings-connector/src/connector/auth"
 	"github.com/tebben/sensorthings-connector/src/connector/models"
 )
 
@@ -14,27 +17,81 @@ type ConnectorHTTPServer struct {
 	system    *models.System
 	host      string                     // Hostname for example "localhost:8081" or "192.168.1.14:8081"
 	endpoints []models.ConnectorEndpoint // Configured endpoints for Connector HTTP
+	auth      *auth.Auth                 // Authentication of requests, every route except the public paths is protected
+	cors      models.CORSConfig          // Origins allowed to use the API from a browser
+	tls       models.TLSConfig           // HTTPS settings, the server uses HTTP when no certificate is configured
 }
 
 // CreateServer initialises a new Connector HTTPServer based on the given parameters
-func CreateServer(system *models.System, host string, endpoints []models.ConnectorEndpoint) models.HTTPServer {
+func CreateServer(system *models.System, host string, endpoints []models.ConnectorEndpoint, auth *auth.Auth, cors models.CORSConfig, tls models.TLSConfig) models.HTTPServer {
 	return &ConnectorHTTPServer{
 		system:    system,
 		host:      host,
 		endpoints: endpoints,
+		auth:      auth,
+		cors:      cors,
+		tls:       tls,
 	}
 }
 
-// Start command to start the Connector HTTPServer
+// Start command to start the Connector HTTPServer, the server uses HTTPS when a certificate is configured
+// and the effective security settings are logged
 func (c *ConnectorHTTPServer) Start() {
-	log.Printf("Started SensorThings Connector HTTP Server on %v", c.host)
-	router := createRouter(c)
-	httpError := http.ListenAndServe(c.host, router)
+	handler, err := createCORSHandler(c.cors, createRouter(c))
+	if err != nil {
+		log.Fatal("cors config error: ", err)
+		return
+	}
+
+	server := &http.Server{Addr: c.host, Handler: handler}
+	if !c.tls.IsEnabled() {
+		log.Printf("Started SensorThings Connector HTTP Server on %v", c.host)
+		log.Printf("HTTPS is disabled, configure a certificate and key to encrypt the connections")
+		c.logSecurity()
+		if httpError := server.ListenAndServe(); httpError != nil {
+			log.Fatal(httpError)
+		}
 
-	if httpError != nil {
-		log.Fatal(httpError)
 		return
 	}
+
+	certs, err := loadCertificates(c.tls)
+	if err != nil {
+		log.Fatal("tls config error: ", err)
+		return
+	}
+
+	server.TLSConfig = certs.tlsConfig()
+	go certs.watch()
+
+	log.Printf("Started SensorThings Connector HTTPS Server on %v", c.host)
+	log.Print(certs.describe())
+	if len(c.tls.RedirectAddress) > 0 {
+		log.Printf("HTTP requests on %v are redirected to HTTPS", c.tls.RedirectAddress)
+		go func() {
+			log.Fatal(http.ListenAndServe(c.tls.RedirectAddress, redirectHandler(c.host)))
+		}()
+	}
+
+	c.logSecurity()
+	if httpError := server.ListenAndServeTLS("", ""); httpError != nil {
+		log.Fatal(httpError)
+	}
+}
+
+// logSecurity logs the authentication and CORS settings of the server
+func (c *ConnectorHTTPServer) logSecurity() {
+	if !c.auth.IsEnabled() {
+		log.Printf("Authentication is disabled, configure API keys, users or JWT to protect the REST API")
+	} else {
+		log.Printf("Authentication enabled using %v", strings.Join(c.auth.Methods(), ", "))
+	}
+
+	if len(c.cors.AllowedOrigins) == 0 {
+		log.Printf("CORS allows all origins")
+	} else {
+		log.Printf("CORS allows origins %v", strings.Join(c.cors.AllowedOrigins, ", "))
+	}
 }
 
 // Stop command to stop the Connector HTTP server, currently not supported
@@ -55,32 +112,83 @@ func createRouter(c *ConnectorHTTPServer) *httprouter.Router {
 			switch operation.OperationType {
 			case models.HTTPOperationGet:
 				{
-					router.GET(operation.Path, func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-						operation.Handler(w, r, p, c.system)
-					})
+					router.GET(operation.Path, c.handle(operation))
 				}
 			case models.HTTPOperationPost:
 				{
-					router.POST(operation.Path, func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-						operation.Handler(w, r, p, c.system)
-					})
+					router.POST(operation.Path, c.handle(operation))
 				}
 			case models.HTTPOperationPatch:
 				{
-					router.PATCH(operation.Path, func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-						operation.Handler(w, r, p, c.system)
-					})
+					router.PATCH(operation.Path, c.handle(operation))
+				}
+			case models.HTTPOperationPut:
+				{
+					router.PUT(operation.Path, c.handle(operation))
 				}
 			case models.HTTPOperationDelete:
 				{
-					router.DELETE(operation.Path, func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-						operation.Handler(w, r, p, c.system)
-					})
+					router.DELETE(operation.Path, c.handle(operation))
 				}
 			}
 		}
 	}
 
-	//router.ServeFiles("/app/*filepath", http.Dir("client/app"))
+	addUI(router)
 	return router
 }
+
+// handle creates the router handle for an operation, unless the path of the operation is public
+// requests are authenticated and the role of the caller is checked before the handler is called.
+// Requests on a public path are authenticated when they hold valid credentials, other requests on
+// a public path are marked anonymous
+func (c *ConnectorHTTPServer) handle(operation models.EndpointOperation) httprouter.Handle {
+	enabled := c.auth.IsEnabled()
+	public := c.auth.IsPublic(operation.Path)
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if enabled {
+			identity, err := c.auth.Authenticate(r)
+			if err != nil && !public {
+				for _, challenge := range c.auth.Challenges() {
+					w.Header().Add("WWW-Authenticate", challenge)
+				}
+
+				sendError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			if err == nil {
+				system := *c.system
+				assigned, _ := system.GetRoleAssignment(identity.Method, identity.Name)
+				err = c.auth.Authorize(identity, assigned, operation.Permission)
+				if err != nil && !public {
+					sendError(w, http.StatusForbidden, err.Error())
+					return
+				}
+			}
+
+			if err == nil {
+				r = auth.WithIdentity(r, identity)
+			} else {
+				r = auth.WithAnonymous(r)
+			}
+		}
+
+		operation.Handler(w, r, p, c.system)
+	}
+}
+
+// sendError writes an ErrorResponse for errors that occur before a handler is called
+func sendError(w http.ResponseWriter, status int, message string) {
+	b, _ := json.MarshalIndent(models.ErrorResponse{
+		Error: models.ErrorContent{
+			StatusText: http.StatusText(status),
+			StatusCode: status,
+			Message:    message,
+		},
+	}, "", "   ")
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
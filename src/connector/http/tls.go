@@ -0,0 +1,196 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// defaultTLSReloadInterval is the interval in which the certificate files are checked for changes
+// when no interval is configured
+const defaultTLSReloadInterval = 60 * time.Second
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certificates holds the certificate, key and client CAs loaded from the files in the TLS config, the
+// files are loaded again when they change so rotated certificates are used without a restart
+type certificates struct {
+	config     models.TLSConfig
+	minVersion uint16
+	clientAuth tls.ClientAuthType
+	mutex      sync.RWMutex
+	cert       *tls.Certificate
+	clientCAs  *x509.CertPool
+	state      string
+}
+
+// loadCertificates checks the TLS config and loads the certificate files
+func loadCertificates(config models.TLSConfig) (*certificates, error) {
+	c := &certificates{config: config, minVersion: tls.VersionTLS12}
+	if len(config.MinVersion) > 0 {
+		version, ok := tlsVersions[config.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported minimum TLS version %s, use 1.2 or 1.3", config.MinVersion)
+		}
+
+		c.minVersion = version
+	}
+
+	if len(config.ClientCAFile) > 0 {
+		switch config.ClientAuth {
+		case "", "require":
+			c.clientAuth = tls.RequireAndVerifyClientCert
+		case "optional":
+			c.clientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("Unsupported client auth %s, use require or optional", config.ClientAuth)
+		}
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load reads the certificate, key and client CA files, the loaded certificates are only replaced
+// when all files could be read
+func (c *certificates) load() error {
+	cert, err := tls.LoadX509KeyPair(c.config.CertFile, c.config.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if len(c.config.ClientCAFile) > 0 {
+		pem, err := ioutil.ReadFile(c.config.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("No certificates found in " + c.config.ClientCAFile)
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cert = &cert
+	c.clientCAs = clientCAs
+	c.state = c.filesState()
+	return nil
+}
+
+// filesState returns the size and modification time of the certificate files
+func (c *certificates) filesState() string {
+	state := ""
+	for _, f := range []string{c.config.CertFile, c.config.KeyFile, c.config.ClientCAFile} {
+		if info, err := os.Stat(f); err == nil {
+			state += fmt.Sprintf("%s:%d:%d;", f, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+
+	return state
+}
+
+// watch loads the certificate files again when they change, a certificate that can not be loaded is
+// logged and the current certificate is kept
+func (c *certificates) watch() {
+	for range time.Tick(c.reloadInterval()) {
+		c.mutex.RLock()
+		changed := c.state != c.filesState()
+		c.mutex.RUnlock()
+
+		if !changed {
+			continue
+		}
+
+		if err := c.load(); err != nil {
+			log.Printf("Unable to reload TLS certificate: %v", err)
+			continue
+		}
+
+		log.Printf("TLS certificate reloaded from %v", c.config.CertFile)
+	}
+}
+
+// tlsConfig creates the TLS config of the server, the config for every connection is created from
+// the certificates that are loaded at that moment
+func (c *certificates) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: c.minVersion,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			c.mutex.RLock()
+			defer c.mutex.RUnlock()
+			return c.cert, nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mutex.RLock()
+			defer c.mutex.RUnlock()
+			return &tls.Config{
+				MinVersion:   c.minVersion,
+				Certificates: []tls.Certificate{*c.cert},
+				ClientAuth:   c.clientAuth,
+				ClientCAs:    c.clientCAs,
+			}, nil
+		},
+	}
+}
+
+// describe returns a description of the TLS settings for the startup log
+func (c *certificates) describe() string {
+	description := fmt.Sprintf("HTTPS enabled with %v, minimum version %v, certificates checked for changes every %v",
+		c.config.CertFile, tls.VersionName(c.minVersion), c.reloadInterval())
+
+	switch c.clientAuth {
+	case tls.RequireAndVerifyClientCert:
+		description += fmt.Sprintf(", client certificates signed by %v required", c.config.ClientCAFile)
+	case tls.VerifyClientCertIfGiven:
+		description += fmt.Sprintf(", client certificates signed by %v verified when given", c.config.ClientCAFile)
+	}
+
+	return description
+}
+
+func (c *certificates) reloadInterval() time.Duration {
+	if c.config.ReloadInterval <= 0 {
+		return defaultTLSReloadInterval
+	}
+
+	return c.config.ReloadInterval * time.Second
+}
+
+// redirectHandler redirects all requests to the same path on the HTTPS server listening on httpsAddress
+func redirectHandler(httpsAddress string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddress)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+
+		if len(port) > 0 && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
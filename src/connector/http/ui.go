@@ -0,0 +1,31 @@
+package http
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// uiPath is the path the web interface is served on
+const uiPath = "/app/"
+
+// uiFiles holds the web interface, it is embedded so the interface works without internet access
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// addUI serves the embedded web interface on uiPath and redirects the root to it, the files are
+// public, the interface uses the REST API which handles authentication
+func addUI(router *httprouter.Router) {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		return
+	}
+
+	router.ServeFiles(uiPath+"*filepath", http.FS(files))
+	router.GET("/", func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		http.Redirect(w, r, uiPath, http.StatusFound)
+	})
+}
@@ -0,0 +1,693 @@
+// Web interface of the SensorThings Connector, the interface only uses the REST API and has no
+// external dependencies so it works without internet access
+(function () {
+  "use strict";
+
+  var base = location.pathname.replace(/app\/.*$/, "");
+  var view = document.getElementById("view");
+  var message = document.getElementById("message");
+  var apiKey = sessionStorage.getItem("apiKey") || "";
+  var refreshTimer = null;
+  var openAPI = null;
+
+  // api sends a request to the REST API, the parsed body and the ETag are returned. Failed requests
+  // are rejected with the message of the ErrorResponse
+  function api(method, path, body, headers) {
+    var init = { method: method, headers: headers || {}, credentials: "same-origin" };
+    if (apiKey) {
+      init.headers["X-API-Key"] = apiKey;
+    }
+
+    if (body !== undefined) {
+      init.headers["Content-Type"] = "application/json";
+      init.body = JSON.stringify(body);
+    }
+
+    return fetch(base + path, init).then(function (res) {
+      return res.text().then(function (text) {
+        var data = null;
+        if (text) {
+          try {
+            data = JSON.parse(text);
+          } catch (e) {
+            data = text;
+          }
+        }
+
+        if (!res.ok) {
+          var err = new Error(data && data.error ? data.error.message : res.status + " " + res.statusText);
+          err.status = res.status;
+          throw err;
+        }
+
+        return { data: data, etag: res.headers.get("ETag") };
+      });
+    });
+  }
+
+  // el creates an element, text is set as text content so values from the API are never parsed as HTML
+  function el(tag, attrs, children) {
+    var e = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (k) {
+      var v = attrs[k];
+      if (v === undefined || v === null || v === false) {
+        return;
+      }
+
+      if (k === "text") {
+        e.textContent = v;
+      } else if (k === "class") {
+        e.className = v;
+      } else if (k === "value" || k === "checked" || k === "disabled") {
+        e[k] = v;
+      } else if (k.indexOf("on") === 0) {
+        e.addEventListener(k.substring(2), v);
+      } else {
+        e.setAttribute(k, v === true ? "" : v);
+      }
+    });
+
+    (children || []).forEach(function (c) {
+      if (c) {
+        e.appendChild(typeof c === "string" ? document.createTextNode(c) : c);
+      }
+    });
+
+    return e;
+  }
+
+  function show() {
+    view.textContent = "";
+    Array.prototype.forEach.call(arguments, function (e) {
+      if (e) {
+        view.appendChild(e);
+      }
+    });
+  }
+
+  function showMessage(text, type) {
+    message.textContent = text;
+    message.className = type;
+    message.hidden = false;
+  }
+
+  function showError(err) {
+    if (err.status === 401) {
+      showMessage("Authentication required, enter an API key or sign in: " + err.message, "error");
+    } else {
+      showMessage(err.message, "error");
+    }
+  }
+
+  function clearMessage() {
+    message.hidden = true;
+  }
+
+  function toolbar(title, buttons) {
+    return el("div", { class: "toolbar" }, [el("h2", { text: title }), el("span", { class: "spacer" })].concat(buttons || []));
+  }
+
+  function status(c) {
+    if (c.running && c.failure) {
+      return el("span", { class: "status failed", text: "failed" });
+    }
+
+    return el("span", { class: "status " + (c.running ? "running" : "stopped"), text: c.running ? "running" : "stopped" });
+  }
+
+  function labels(c) {
+    return el("span", {}, Object.keys(c.labels || {}).sort().map(function (k) {
+      return el("span", { class: "label", text: k + "=" + c.labels[k] });
+    }));
+  }
+
+  function loadOpenAPI() {
+    if (openAPI) {
+      return Promise.resolve(openAPI);
+    }
+
+    return api("GET", "openapi.json").then(function (res) {
+      openAPI = res.data;
+      return openAPI;
+    });
+  }
+
+  // settingsSchema returns the schema of the settings of a module, modules without a schema return null
+  function settingsSchema(module) {
+    var schemas = openAPI && openAPI.components ? openAPI.components.schemas : {};
+    return schemas[module.replace(/[^a-zA-Z0-9_.-]/g, "") + "Settings"] || null;
+  }
+
+  function setState(c, running) {
+    return api("POST", "Connectors/" + encodeURIComponent(c.id) + (running ? "/Start" : "/Stop"));
+  }
+
+  function deleteConnector(c) {
+    if (!confirm("Delete connector " + c.name + "?")) {
+      return Promise.reject(null);
+    }
+
+    return api("DELETE", "Connectors/" + encodeURIComponent(c.id));
+  }
+
+  // Connector list
+
+  function renderConnectors() {
+    var rows = el("tbody");
+    show(
+      toolbar("Connectors", [el("a", { class: "button", href: "#/connectors/new", text: "New connector" })]),
+      el("table", {}, [
+        el("thead", {}, [el("tr", {}, ["Name", "Module", "Labels", "Status", ""].map(function (h) { return el("th", { text: h }); }))]),
+        rows
+      ])
+    );
+
+    function load() {
+      api("GET", "Connectors").then(function (res) {
+        rows.textContent = "";
+        if (res.data.length === 0) {
+          rows.appendChild(el("tr", {}, [el("td", { colspan: 5, class: "muted", text: "No connectors yet" })]));
+        }
+
+        res.data.forEach(function (c) {
+          rows.appendChild(connectorRow(c, load));
+        });
+      }).catch(showError);
+    }
+
+    load();
+    refreshTimer = setInterval(load, 5000);
+  }
+
+  function connectorRow(c, reload) {
+    var done = function () { clearMessage(); reload(); };
+    var failed = function (err) { if (err) { showError(err); } };
+    return el("tr", {}, [
+      el("td", {}, [
+        el("a", { href: "#/connectors/" + encodeURIComponent(c.id), text: c.name || c.id }),
+        c.description ? el("div", { class: "muted", text: c.description }) : null
+      ]),
+      el("td", { text: c.module }),
+      el("td", {}, [labels(c)]),
+      el("td", {}, [status(c), c.failure && c.running ? el("div", { class: "error-text", text: c.failure.message }) : null]),
+      el("td", { class: "actions" }, [
+        el("button", {
+          text: c.running ? "Stop" : "Start", disabled: c.readOnly,
+          onclick: function () { setState(c, !c.running).then(done).catch(failed); }
+        }),
+        " ",
+        el("button", {
+          class: "danger", text: "Delete", disabled: c.readOnly,
+          onclick: function () { deleteConnector(c).then(done).catch(failed); }
+        })
+      ])
+    ]);
+  }
+
+  // Modules
+
+  function renderModules() {
+    Promise.all([api("GET", "Modules"), loadOpenAPI()]).then(function (results) {
+      show(
+        toolbar("Modules"),
+        el("table", {}, [
+          el("thead", {}, [el("tr", {}, ["Name", "Description", "Settings", ""].map(function (h) { return el("th", { text: h }); }))]),
+          el("tbody", {}, results[0].data.map(function (m) {
+            return el("tr", {}, [
+              el("td", { text: m.name }),
+              el("td", { text: m.description }),
+              el("td", { class: "muted", text: settingsSchema(m.name) ? "form" : "JSON" }),
+              el("td", { class: "actions" }, [
+                el("a", { class: "button", href: "#/connectors/new/" + encodeURIComponent(m.name), text: "New connector" })
+              ])
+            ]);
+          }))
+        ])
+      );
+    }).catch(showError);
+  }
+
+  // Connector editor
+
+  function renderConnector(id) {
+    Promise.all([api("GET", "Connectors/" + encodeURIComponent(id)), api("GET", "Modules"), loadOpenAPI()]).then(function (results) {
+      renderEditor(results[0].data, results[0].etag, results[1].data);
+    }).catch(showError);
+  }
+
+  function renderNewConnector(module) {
+    Promise.all([api("GET", "Modules"), loadOpenAPI()]).then(function (results) {
+      var modules = results[0].data;
+      var c = { name: "", description: "", module: module || (modules[0] ? modules[0].name : ""), settings: {} };
+      renderEditor(c, null, modules);
+    }).catch(showError);
+  }
+
+  function renderEditor(c, etag, modules) {
+    var isNew = !c.id;
+    var jsonMode = false;
+    var settingsEditor = null;
+    var settingsContainer = el("div");
+    var results = el("div");
+
+    var name = el("input", { type: "text", value: c.name });
+    var description = el("input", { type: "text", value: c.description });
+    var module = el("select", {}, modules.map(function (m) {
+      return el("option", { value: m.name, text: m.name });
+    }));
+    module.value = c.module;
+
+    var labelText = el("textarea", { rows: 3, placeholder: "key=value, one label per line", style: "min-height: 60px" });
+    labelText.value = Object.keys(c.labels || {}).sort().map(function (k) { return k + "=" + c.labels[k]; }).join("\n");
+
+    var jsonToggle = el("button", { type: "button", text: "Edit as JSON" });
+
+    function buildSettings(value) {
+      var schema = settingsSchema(module.value);
+      settingsEditor = jsonMode || !schema ? jsonEditor(value, "settings") : createEditor(schema, value, "settings");
+      jsonToggle.textContent = jsonMode ? "Edit as form" : "Edit as JSON";
+      jsonToggle.disabled = !schema;
+      settingsContainer.textContent = "";
+      settingsContainer.appendChild(settingsEditor.element);
+    }
+
+    function currentSettings() {
+      return settingsEditor.get() || {};
+    }
+
+    jsonToggle.addEventListener("click", function () {
+      try {
+        var value = currentSettings();
+        jsonMode = !jsonMode;
+        buildSettings(value);
+      } catch (err) {
+        showError(err);
+      }
+    });
+
+    module.addEventListener("change", function () {
+      var value = {};
+      try {
+        value = currentSettings();
+      } catch (err) {
+        // settings of the previous module are dropped when they can not be read
+      }
+
+      buildSettings(value);
+    });
+
+    buildSettings(c.settings || {});
+
+    function body() {
+      var labelMap = {};
+      labelText.value.split("\n").forEach(function (line) {
+        var idx = line.indexOf("=");
+        if (idx > 0) {
+          labelMap[line.substring(0, idx).trim()] = line.substring(idx + 1).trim();
+        }
+      });
+
+      return {
+        name: name.value,
+        description: description.value,
+        module: module.value,
+        labels: labelMap,
+        settings: currentSettings()
+      };
+    }
+
+    function save() {
+      var request;
+      try {
+        request = isNew
+          ? api("POST", "Connectors", body())
+          : api("PUT", "Connectors/" + encodeURIComponent(c.id), body(), etag ? { "If-Match": etag } : {});
+      } catch (err) {
+        showError(err);
+        return;
+      }
+
+      request.then(function (res) {
+        showMessage("Connector " + res.data.name + " saved", "info");
+        if (isNew) {
+          location.hash = "#/connectors/" + encodeURIComponent(res.data.id);
+        } else {
+          renderEditor(res.data, res.etag, modules);
+        }
+      }).catch(function (err) {
+        if (err.status === 412) {
+          showMessage("The connector was changed by someone else, reload the page to see the changes. " + err.message, "error");
+        } else {
+          showError(err);
+        }
+      });
+    }
+
+    function test() {
+      var connector;
+      try {
+        connector = body();
+      } catch (err) {
+        showError(err);
+        return;
+      }
+
+      // the id lets the server use the stored secrets of the connector in place of the redacted values
+      if (!isNew) {
+        connector.id = c.id;
+      }
+
+      results.textContent = "";
+      results.appendChild(el("p", { class: "muted", text: "Testing..." }));
+      api("POST", "Modules/" + encodeURIComponent(connector.module) + "/Test", connector).then(function (res) {
+        var r = res.data;
+        results.textContent = "";
+        results.appendChild(el("div", { class: "panel" }, [
+          el("h3", { text: r.success ? "Test succeeded" : "Test failed", class: r.success ? "" : "error-text" }),
+          r.errors.length ? el("ul", {}, r.errors.map(function (e) { return el("li", { class: "error-text", text: e }); })) : null,
+          el("p", { class: "muted", text: r.observations.length + " observation(s) would have been published" }),
+          r.observations.length ? el("pre", { text: JSON.stringify(r.observations, null, 2) }) : null
+        ]));
+      }).catch(function (err) {
+        results.textContent = "";
+        showError(err);
+      });
+    }
+
+    var actions = [];
+    if (!isNew) {
+      var reload = function () { clearMessage(); renderConnector(c.id); };
+      var failed = function (err) { if (err) { showError(err); } };
+      actions.push(
+        el("button", { text: c.running ? "Stop" : "Start", disabled: c.readOnly, onclick: function () { setState(c, !c.running).then(reload).catch(failed); } }),
+        el("button", { class: "danger", text: "Delete", disabled: c.readOnly, onclick: function () {
+          deleteConnector(c).then(function () { location.hash = "#/connectors"; }).catch(failed);
+        } })
+      );
+    }
+
+    var statusPanel = isNew ? null : el("div", { class: "panel" }, [
+      field("Status", [status(c)]),
+      c.failure ? field("Last failure", [el("span", { class: "error-text", text: new Date(c.failure.time).toLocaleString() + ": " + c.failure.message })]) : null,
+      c.nextRun ? field("Next run", [el("span", { text: new Date(c.nextRun).toLocaleString() })]) : null,
+      field("Id", [el("span", { text: c.id })]),
+      field("Revision", [el("span", { text: String(c.revision) })]),
+      c.readOnly ? field("Managed by", [el("span", { text: c.source + " (read-only)" })]) : null
+    ]);
+
+    show(
+      toolbar(isNew ? "New connector" : c.name || c.id, actions),
+      statusPanel,
+      el("fieldset", { class: "panel", disabled: c.readOnly }, [
+        field("Name", [name]),
+        field("Description", [description]),
+        field("Module", [module]),
+        field("Labels", [labelText]),
+        el("div", { class: "toolbar" }, [el("h3", { text: "Settings" }), el("span", { class: "spacer" }), jsonToggle]),
+        settingsContainer,
+        el("div", { class: "toolbar" }, [
+          el("button", { class: "primary", type: "button", text: isNew ? "Create" : "Save", onclick: save }),
+          el("button", { type: "button", text: "Test settings", onclick: test }),
+          el("a", { class: "button", href: "#/connectors", text: "Back" })
+        ])
+      ]),
+      results
+    );
+  }
+
+  function field(label, controls, hint) {
+    return el("div", { class: "field" }, [
+      el("label", { text: label }),
+      el("div", { class: "control" }, controls.concat(hint ? [el("span", { class: "hint", text: hint })] : []))
+    ]);
+  }
+
+  // Settings forms generated from the JSON schema of a module, every editor has an element and a
+  // get function returning the edited value, undefined leaves the value out
+
+  function resolve(schema) {
+    while (schema && schema.$ref) {
+      schema = openAPI.components.schemas[schema.$ref.split("/").pop()];
+    }
+
+    return schema || {};
+  }
+
+  function isCompound(schema) {
+    return schema.type === "object" || schema.type === "array";
+  }
+
+  function isSecret(schema, name) {
+    return schema.format === "password" || /password|secret|token|apikey/i.test(name || "");
+  }
+
+  function createEditor(schema, value, name) {
+    schema = resolve(schema);
+    if (schema.enum) {
+      return enumEditor(schema, value);
+    }
+
+    switch (schema.type) {
+      case "object":
+        if (schema.properties) {
+          return objectEditor(schema, value);
+        }
+
+        return schema.additionalProperties ? mapEditor(schema, value) : jsonEditor(value, name);
+      case "array":
+        return arrayEditor(schema, value, name);
+      case "string":
+        return inputEditor(isSecret(schema, name) ? "password" : "text", value, function (v) { return v; });
+      case "integer":
+      case "number":
+        return inputEditor("number", value, Number);
+      case "boolean":
+        return booleanEditor(value);
+    }
+
+    return jsonEditor(value, name);
+  }
+
+  function defaultValue(schema) {
+    schema = resolve(schema);
+    if (schema.default !== undefined) {
+      return schema.default;
+    }
+
+    switch (schema.type) {
+      case "object":
+        return {};
+      case "array":
+        return [];
+      case "string":
+        return "";
+    }
+
+    return undefined;
+  }
+
+  function objectEditor(schema, value) {
+    var original = value && typeof value === "object" ? value : {};
+    var editors = {};
+    var element = el("div");
+    Object.keys(schema.properties).sort().forEach(function (key) {
+      var propSchema = resolve(schema.properties[key]);
+      var editor = createEditor(propSchema, original[key], key);
+      editors[key] = editor;
+      if (isCompound(propSchema)) {
+        element.appendChild(el("fieldset", {}, [
+          el("legend", { text: key }),
+          propSchema.description ? el("span", { class: "hint", text: propSchema.description }) : null,
+          editor.element
+        ]));
+      } else {
+        element.appendChild(field(key, [editor.element], propSchema.description));
+      }
+    });
+
+    return {
+      element: element,
+      get: function () {
+        var result = JSON.parse(JSON.stringify(original));
+        Object.keys(editors).forEach(function (key) {
+          var v = editors[key].get();
+          if (v === undefined) {
+            delete result[key];
+          } else {
+            result[key] = v;
+          }
+        });
+
+        return result;
+      }
+    };
+  }
+
+  function arrayEditor(schema, value, name) {
+    var items = [];
+    var list = el("div");
+    var element = el("div", {}, [list, el("button", { type: "button", text: "Add " + (name || "item"), onclick: function () {
+      add(defaultValue(schema.items));
+    } })]);
+
+    function add(itemValue) {
+      var editor = createEditor(schema.items || {}, itemValue, name);
+      var item = el("div", { class: "item" });
+      var entry = { editor: editor };
+      item.appendChild(el("div", { class: "item-header" }, [
+        el("span", { class: "muted", text: "#" + (items.length + 1) }),
+        el("button", { type: "button", class: "danger", text: "Remove", onclick: function () {
+          items.splice(items.indexOf(entry), 1);
+          list.removeChild(item);
+        } })
+      ]));
+      item.appendChild(editor.element);
+      items.push(entry);
+      list.appendChild(item);
+    }
+
+    (Array.isArray(value) ? value : []).forEach(add);
+    return {
+      element: element,
+      get: function () {
+        return items.map(function (entry) {
+          var v = entry.editor.get();
+          return v === undefined ? null : v;
+        });
+      }
+    };
+  }
+
+  function mapEditor(schema, value) {
+    var entries = [];
+    var list = el("div");
+    var element = el("div", {}, [list, el("button", { type: "button", text: "Add entry", onclick: function () {
+      add("", defaultValue(schema.additionalProperties));
+    } })]);
+
+    function add(key, entryValue) {
+      var keyInput = el("input", { type: "text", value: key, placeholder: "key" });
+      var editor = createEditor(schema.additionalProperties, entryValue, key);
+      var item = el("div", { class: "item" });
+      var entry = { key: keyInput, editor: editor };
+      item.appendChild(el("div", { class: "item-header" }, [
+        keyInput,
+        el("button", { type: "button", class: "danger", text: "Remove", onclick: function () {
+          entries.splice(entries.indexOf(entry), 1);
+          list.removeChild(item);
+        } })
+      ]));
+      item.appendChild(editor.element);
+      entries.push(entry);
+      list.appendChild(item);
+    }
+
+    var original = value && typeof value === "object" ? value : {};
+    Object.keys(original).sort().forEach(function (k) { add(k, original[k]); });
+    return {
+      element: element,
+      get: function () {
+        var result = {};
+        entries.forEach(function (entry) {
+          if (entry.key.value) {
+            result[entry.key.value] = entry.editor.get();
+          }
+        });
+
+        return result;
+      }
+    };
+  }
+
+  function inputEditor(type, value, parse) {
+    var input = el("input", { type: type, value: value === undefined || value === null ? "" : String(value), step: type === "number" ? "any" : null });
+    return {
+      element: input,
+      get: function () {
+        if (input.value === "" && (type === "number" || value === undefined)) {
+          return undefined;
+        }
+
+        return parse(input.value);
+      }
+    };
+  }
+
+  function booleanEditor(value) {
+    var input = el("input", { type: "checkbox", checked: !!value });
+    return {
+      element: input,
+      get: function () {
+        return value === undefined && !input.checked ? undefined : input.checked;
+      }
+    };
+  }
+
+  function enumEditor(schema, value) {
+    var select = el("select", {}, [el("option", { value: "", text: "" })].concat(schema.enum.map(function (v) {
+      return el("option", { value: String(v), text: String(v) });
+    })));
+    select.value = value === undefined || value === null ? "" : String(value);
+    return {
+      element: select,
+      get: function () {
+        var match = schema.enum.filter(function (v) { return String(v) === select.value; });
+        return match.length ? match[0] : undefined;
+      }
+    };
+  }
+
+  function jsonEditor(value, name) {
+    var textarea = el("textarea", { spellcheck: "false" });
+    textarea.value = value === undefined ? "" : JSON.stringify(value, null, 2);
+    return {
+      element: textarea,
+      get: function () {
+        if (textarea.value.trim() === "") {
+          return undefined;
+        }
+
+        try {
+          return JSON.parse(textarea.value);
+        } catch (e) {
+          throw new Error("Invalid JSON in " + (name || "value") + ": " + e.message);
+        }
+      }
+    };
+  }
+
+  // Navigation
+
+  function route() {
+    clearInterval(refreshTimer);
+    clearMessage();
+
+    var parts = location.hash.replace(/^#\/?/, "").split("/");
+    Array.prototype.forEach.call(document.querySelectorAll("header nav a"), function (a) {
+      a.className = a.getAttribute("href") === "#/" + (parts[0] || "connectors") ? "active" : "";
+    });
+
+    if (parts[0] === "modules") {
+      renderModules();
+    } else if (parts[0] === "connectors" && parts[1] === "new") {
+      renderNewConnector(parts[2] ? decodeURIComponent(parts[2]) : "");
+    } else if (parts[0] === "connectors" && parts[1]) {
+      renderConnector(decodeURIComponent(parts[1]));
+    } else {
+      renderConnectors();
+    }
+  }
+
+  var keyInput = document.getElementById("apikey");
+  keyInput.value = apiKey;
+  document.getElementById("credentials").addEventListener("submit", function (e) {
+    e.preventDefault();
+    apiKey = keyInput.value;
+    sessionStorage.setItem("apiKey", apiKey);
+    openAPI = null;
+    route();
+  });
+
+  window.addEventListener("hashchange", route);
+  route();
+})();
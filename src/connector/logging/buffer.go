@@ -0,0 +1,127 @@
+package logging
+
+import "sync"
+
+// DefaultBufferSize is the number of entries kept per connector when no buffer size is configured
+const DefaultBufferSize = 500
+
+// subscriptionBufferSize is the number of entries buffered for a subscription, entries are dropped
+// when a subscriber does not keep up
+const subscriptionBufferSize = 100
+
+// Buffer keeps the most recent log entries of a connector and passes new entries to its subscriptions
+type Buffer struct {
+	mutex         sync.RWMutex
+	entries       []*Entry
+	next          int
+	full          bool
+	subscriptions map[*Subscription]bool
+	closed        bool
+}
+
+// Subscription receives the new entries of a Buffer with at least its level on Entries, the channel
+// is closed when the buffer is closed
+type Subscription struct {
+	Entries chan *Entry
+	Level   Level
+}
+
+// CreateBuffer creates a buffer keeping the given number of entries, DefaultBufferSize is used
+// when size is not positive
+func CreateBuffer(size int) *Buffer {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+
+	return &Buffer{entries: make([]*Entry, size), subscriptions: make(map[*Subscription]bool)}
+}
+
+// Entries returns the buffered entries with at least the given level oldest first, limit is the
+// maximum number of entries to return counting from the newest entry, 0 returns all entries
+func (b *Buffer) Entries(minimum Level, limit int) []*Entry {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.entriesLocked(minimum, limit)
+}
+
+// Subscribe returns the buffered entries like Entries and a subscription that receives new entries with at
+// least the given level, no entry is missed or received twice. Unsubscribe has to be called when the subscriber is done
+func (b *Buffer) Subscribe(minimum Level, limit int) ([]*Entry, *Subscription) {
+	s := &Subscription{Entries: make(chan *Entry, subscriptionBufferSize), Level: minimum}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		close(s.Entries)
+	} else {
+		b.subscriptions[s] = true
+	}
+
+	return b.entriesLocked(minimum, limit), s
+}
+
+// Unsubscribe removes a subscription from the buffer
+func (b *Buffer) Unsubscribe(s *Subscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.subscriptions[s] {
+		delete(b.subscriptions, s)
+		close(s.Entries)
+	}
+}
+
+// Close ends all subscriptions, for instance when the connector is deleted
+func (b *Buffer) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	for s := range b.subscriptions {
+		delete(b.subscriptions, s)
+		close(s.Entries)
+	}
+}
+
+// add stores an entry, replacing the oldest entry when the buffer is full, and sends it to the subscriptions,
+// nothing is stored when the buffer is nil
+func (b *Buffer) add(e *Entry) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.entries[b.next] = e
+	b.next = (b.next + 1) % len(b.entries)
+	b.full = b.full || b.next == 0
+
+	for s := range b.subscriptions {
+		if e.Level < s.Level {
+			continue
+		}
+
+		select {
+		case s.Entries <- e:
+		default:
+		}
+	}
+}
+
+func (b *Buffer) entriesLocked(minimum Level, limit int) []*Entry {
+	ordered := b.entries[:b.next]
+	if b.full {
+		ordered = append(append([]*Entry{}, b.entries[b.next:]...), ordered...)
+	}
+
+	selected := make([]*Entry, 0)
+	for _, e := range ordered {
+		if e.Level >= minimum {
+			selected = append(selected, e)
+		}
+	}
+
+	if limit > 0 && len(selected) > limit {
+		selected = selected[len(selected)-limit:]
+	}
+
+	return selected
+}
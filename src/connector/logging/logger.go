@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"fmt"
+	"time"
+)
+
+// Logger logs the messages of a single connector, the entries are written to the output and kept
+// in the buffer of the connector. All methods can be called on a nil Logger in which case the
+// entries are only written to the output
+type Logger struct {
+	connector string
+	module    string
+	buffer    *Buffer
+}
+
+// CreateLogger creates a logger for the connector with the given id and module which keeps
+// its entries in buffer
+func CreateLogger(connector string, module string, buffer *Buffer) *Logger {
+	return &Logger{connector: connector, module: module, buffer: buffer}
+}
+
+// Debugf logs a debug message, arguments are handled in the manner of fmt.Printf
+func (l *Logger) Debugf(format string, v ...interface{}) {
+	l.Logf(LevelDebug, format, v...)
+}
+
+// Infof logs an informational message, arguments are handled in the manner of fmt.Printf
+func (l *Logger) Infof(format string, v ...interface{}) {
+	l.Logf(LevelInfo, format, v...)
+}
+
+// Warnf logs a warning, arguments are handled in the manner of fmt.Printf
+func (l *Logger) Warnf(format string, v ...interface{}) {
+	l.Logf(LevelWarn, format, v...)
+}
+
+// Errorf logs an error, arguments are handled in the manner of fmt.Printf
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	l.Logf(LevelError, format, v...)
+}
+
+// Logf logs a message with the given level when the level is enabled
+func (l *Logger) Logf(lvl Level, format string, v ...interface{}) {
+	if !enabled(lvl) {
+		return
+	}
+
+	e := &Entry{Time: time.Now(), Level: lvl, Message: fmt.Sprintf(format, v...)}
+	if l != nil {
+		e.Connector, e.Module = l.connector, l.module
+		l.buffer.add(e)
+	}
+
+	write(e)
+}
@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+// Level is a "enumeration" of the log levels from least to most severe
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// Format describes how log entries are written to the output
+type Format string
+
+// Format is a "enumeration" of the supported output formats
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// Entry is a single log message, Connector and Module are empty for messages that
+// are not logged by a connector
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Level     Level     `json:"level"`
+	Connector string    `json:"connector,omitempty"`
+	Module    string    `json:"module,omitempty"`
+	Message   string    `json:"message"`
+}
+
+var (
+	mutex            = sync.RWMutex{}
+	level            = LevelInfo
+	format           = FormatText
+	output io.Writer = os.Stderr
+)
+
+// Configure sets the minimum level of the entries logged by connectors and the output format, the
+// output of the standard logger is written in the same format. Messages of the standard logger are
+// written regardless of the level
+func Configure(minimum Level, f Format) {
+	mutex.Lock()
+	level = minimum
+	format = f
+	mutex.Unlock()
+
+	log.SetFlags(0)
+	log.SetOutput(standardWriter{})
+}
+
+// ParseLevel returns the level with the given name, an empty name returns LevelInfo
+func ParseLevel(name string) (Level, error) {
+	if len(name) == 0 {
+		return LevelInfo, nil
+	}
+
+	for i, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return Level(i), nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("Unknown log level %s, use debug, info, warn or error", name)
+}
+
+// ParseFormat returns the format with the given name, an empty name returns FormatText
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+
+	return FormatText, fmt.Errorf("Unknown log format %s, use text or json", name)
+}
+
+// String returns the name of the level
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+
+	return levelNames[l]
+}
+
+// MarshalJSON writes the level as its name
+func (l Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+// enabled checks if entries of the given level are logged
+func enabled(l Level) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return l >= level
+}
+
+// write writes an entry to the output in the configured format
+func write(e *Entry) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	if format == FormatJSON {
+		b, _ := json.Marshal(e)
+		output.Write(append(b, '\n'))
+		return
+	}
+
+	line := e.Time.Format("2006/01/02 15:04:05") + " " + strings.ToUpper(e.Level.String())
+	if len(e.Connector) > 0 {
+		line += fmt.Sprintf(" [connector=%s module=%s]", e.Connector, e.Module)
+	}
+
+	output.Write([]byte(line + " " + e.Message + "\n"))
+}
+
+// standardWriter writes the lines of the standard logger as info entries
+type standardWriter struct{}
+
+func (standardWriter) Write(b []byte) (int, error) {
+	write(&Entry{Time: time.Now(), Level: LevelInfo, Message: strings.TrimSuffix(string(b), "\n")})
+	return len(b), nil
+}
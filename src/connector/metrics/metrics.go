@@ -0,0 +1,308 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text format written by Registry.Write
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Kind is the Prometheus type of a metric family
+type Kind string
+
+// Kind is a "enumeration" of the supported metric types
+const (
+	KindCounter Kind = "counter"
+	KindGauge   Kind = "gauge"
+	KindSummary Kind = "summary"
+)
+
+// DefaultRegistry is the registry the metrics created by NewCounterVec, NewGaugeVec and NewSummaryVec
+// are added to, it is served by GET /metrics
+var DefaultRegistry = &Registry{}
+
+// Registry holds metric families and writes them in the Prometheus text format
+type Registry struct {
+	mutex    sync.RWMutex
+	families []*family
+}
+
+// family is a named metric with a value for every combination of label values
+type family struct {
+	name   string
+	help   string
+	kind   Kind
+	labels []string
+	mutex  sync.RWMutex
+	series map[string]*series
+}
+
+// series holds the value of a family for one combination of label values, count is
+// only used by a summary
+type series struct {
+	values []string
+	mutex  sync.Mutex
+	value  float64
+	count  uint64
+}
+
+// Counter is a value that only goes up, all methods can be called on a nil Counter
+type Counter struct{ s *series }
+
+// Gauge is a value that can go up and down, all methods can be called on a nil Gauge
+type Gauge struct{ s *series }
+
+// Summary tracks the sum and count of observations, for instance durations, all methods
+// can be called on a nil Summary
+type Summary struct{ s *series }
+
+// CounterVec is a counter family, use With to get the counter for a set of label values
+type CounterVec struct{ f *family }
+
+// GaugeVec is a gauge family, use With to get the gauge for a set of label values
+type GaugeVec struct{ f *family }
+
+// SummaryVec is a summary family, use With to get the summary for a set of label values
+type SummaryVec struct{ f *family }
+
+// NewCounterVec adds a counter family with the given label names to the DefaultRegistry
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return &CounterVec{DefaultRegistry.register(name, help, KindCounter, labels)}
+}
+
+// NewGaugeVec adds a gauge family with the given label names to the DefaultRegistry
+func NewGaugeVec(name string, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{DefaultRegistry.register(name, help, KindGauge, labels)}
+}
+
+// NewSummaryVec adds a summary family with the given label names to the DefaultRegistry
+func NewSummaryVec(name string, help string, labels ...string) *SummaryVec {
+	return &SummaryVec{DefaultRegistry.register(name, help, KindSummary, labels)}
+}
+
+// With returns the counter for the given label values, the counter is created when it does not exist yet
+func (v *CounterVec) With(values ...string) *Counter {
+	return &Counter{v.f.with(values)}
+}
+
+// With returns the gauge for the given label values, the gauge is created when it does not exist yet
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return &Gauge{v.f.with(values)}
+}
+
+// With returns the summary for the given label values, the summary is created when it does not exist yet
+func (v *SummaryVec) With(values ...string) *Summary {
+	return &Summary{v.f.with(values)}
+}
+
+// Inc increases the counter by 1
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increases the counter by v, negative values are ignored
+func (c *Counter) Add(v float64) {
+	if c == nil || v < 0 {
+		return
+	}
+
+	c.s.update(func(s *series) { s.value += v })
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64) {
+	if g == nil {
+		return
+	}
+
+	g.s.update(func(s *series) { s.value = v })
+}
+
+// Add adds v to the gauge, v can be negative
+func (g *Gauge) Add(v float64) {
+	if g == nil {
+		return
+	}
+
+	g.s.update(func(s *series) { s.value += v })
+}
+
+// Observe adds a single observation to the summary
+func (s *Summary) Observe(v float64) {
+	if s == nil {
+		return
+	}
+
+	s.s.update(func(s *series) {
+		s.value += v
+		s.count++
+	})
+}
+
+// Delete removes the series of all families with a label of the given name set to value, for
+// instance all series of a deleted connector
+func (r *Registry) Delete(label string, value string) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, f := range r.families {
+		for i, l := range f.labels {
+			if l != label {
+				continue
+			}
+
+			f.mutex.Lock()
+			for key, s := range f.series {
+				if s.values[i] == value {
+					delete(f.series, key)
+				}
+			}
+			f.mutex.Unlock()
+		}
+	}
+}
+
+// Write writes all families in the Prometheus text exposition format, families without
+// series are left out and series are sorted by their label values
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range r.families {
+		f.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+// register adds a family to the registry, registering the same name twice is a programming error
+func (r *Registry) register(name string, help string, kind Kind, labels []string) *family {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, f := range r.families {
+		if f.name == name {
+			panic(fmt.Sprintf("metric %s registered twice", name))
+		}
+	}
+
+	f := &family{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+	r.families = append(r.families, f)
+	return f
+}
+
+// with returns the series for the label values, the series is created when it does not exist yet
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	f.mutex.RLock()
+	s, ok := f.series[key]
+	f.mutex.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if s, ok = f.series[key]; !ok {
+		s = &series{values: append([]string(nil), values...)}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+// write writes the help, type and series of the family
+func (f *family) write(w *bufio.Writer) {
+	f.mutex.RLock()
+	all := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		all = append(all, s)
+	}
+	f.mutex.RUnlock()
+
+	if len(all) == 0 {
+		return
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		for k := range all[i].values {
+			if all[i].values[k] != all[j].values[k] {
+				return all[i].values[k] < all[j].values[k]
+			}
+		}
+
+		return false
+	})
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escape(f.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	for _, s := range all {
+		s.mutex.Lock()
+		value, count := s.value, s.count
+		s.mutex.Unlock()
+
+		labels := f.labelPairs(s.values)
+		if f.kind == KindSummary {
+			fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labels, formatValue(value))
+			fmt.Fprintf(w, "%s_count%s %d\n", f.name, labels, count)
+		} else {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, labels, formatValue(value))
+		}
+	}
+}
+
+// labelPairs formats the label names and values as {name="value",...}
+func (f *family) labelPairs(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(values))
+	for i, v := range values {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, f.labels[i], escape(v, true))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (s *series) update(f func(s *series)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f(s)
+}
+
+// escape escapes backslashes and line feeds, and double quotes in label values
+func escape(s string, quotes bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quotes {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+
+	return s
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
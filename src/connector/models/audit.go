@@ -0,0 +1,91 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// AuditAction describes the change recorded by an AuditEvent
+type AuditAction string
+
+// AuditAction is a "enumeration" of the changes that are recorded in the audit log
+const (
+	AuditActionCreate AuditAction = "create"
+	AuditActionUpdate AuditAction = "update"
+	AuditActionDelete AuditAction = "delete"
+	AuditActionStart  AuditAction = "start"
+	AuditActionStop   AuditAction = "stop"
+)
+
+// AuditConfig defines how long audit events are kept
+//   RetentionDays: events older than this number of days are removed, defaults to 90
+//   MaxEvents: maximum number of events to keep, the oldest events are removed first, 0 keeps all events
+type AuditConfig struct {
+	RetentionDays int `json:"retentionDays"`
+	MaxEvents     int `json:"maxEvents"`
+}
+
+// AuditActor describes who made a change, the actor is passed to the system in the context of a call
+//   Identity: authenticated identity as {method}:{name}, file:{path} for connector files, empty when authentication is disabled
+//   RemoteAddress: address of the client that made the request
+type AuditActor struct {
+	Identity      string `json:"identity,omitempty"`
+	RemoteAddress string `json:"remoteAddress,omitempty"`
+}
+
+// AuditEvent is a recorded change of a connector, secrets in the changes are redacted
+//   ID: sequence number of the event
+//   Changes: the changed fields with their value before and after the change, settings are
+// 	compared per value using paths such as settings/subBrokers/0/host
+type AuditEvent struct {
+	ID            uint64        `json:"id"`
+	Time          time.Time     `json:"time"`
+	Action        AuditAction   `json:"action"`
+	Identity      string        `json:"identity,omitempty"`
+	RemoteAddress string        `json:"remoteAddress,omitempty"`
+	ConnectorID   string        `json:"connectorId"`
+	ConnectorName string        `json:"connectorName"`
+	Changes       []AuditChange `json:"changes,omitempty"`
+}
+
+// AuditChange holds the value of a field before and after a change, a missing value means
+// the field did not exist
+type AuditChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditQuery selects audit events, empty fields match every event. Events are returned newest first
+//   Limit: maximum number of events to return
+type AuditQuery struct {
+	ConnectorID string
+	Identity    string
+	Action      AuditAction
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+}
+
+// Matches checks if an event is selected by the query, Limit is not taken into account
+func (q *AuditQuery) Matches(e *AuditEvent) bool {
+	return (len(q.ConnectorID) == 0 || q.ConnectorID == e.ConnectorID) &&
+		(len(q.Identity) == 0 || q.Identity == e.Identity) &&
+		(len(q.Action) == 0 || q.Action == e.Action) &&
+		(q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Time.Before(q.Until))
+}
+
+type auditActorKey struct{}
+
+// WithAuditActor returns a copy of ctx holding the actor of the changes made using the context
+func WithAuditActor(ctx context.Context, actor *AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// GetAuditActor returns the actor stored in ctx by WithAuditActor, nil when there is none
+func GetAuditActor(ctx context.Context) *AuditActor {
+	actor, _ := ctx.Value(auditActorKey{}).(*AuditActor)
+	return actor
+}
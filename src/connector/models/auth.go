@@ -0,0 +1,158 @@
+package models
+
+// Role is a set of permissions assigned to an identity
+type Role string
+
+// Role is a "enumeration" of the available roles
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+// Permission is required by an EndpointOperation
+type Permission string
+
+// Permission is a "enumeration" of the permissions used by the endpoints
+//   PermissionRead: read connectors, modules and templates
+//   PermissionOperate: start, stop and test connectors
+//   PermissionWrite: create, change and delete connectors and templates
+//   PermissionAdmin: manage role assignments
+const (
+	PermissionRead    Permission = "read"
+	PermissionOperate Permission = "operate"
+	PermissionWrite   Permission = "write"
+	PermissionAdmin   Permission = "admin"
+)
+
+// rolePermissions maps the roles to their permissions
+var rolePermissions = map[Role][]Permission{
+	RoleViewer:   {PermissionRead},
+	RoleOperator: {PermissionRead, PermissionOperate},
+	RoleAdmin:    {PermissionRead, PermissionOperate, PermissionWrite, PermissionAdmin},
+}
+
+// IsValid checks if the role is one of the known roles
+func (r Role) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// HasPermission checks if the role grants the given permission
+func (r Role) HasPermission(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AuthMethod is a "enumeration" of the methods an identity can authenticate with
+const (
+	AuthMethodAPIKey      = "apikey"
+	AuthMethodBasic       = "basic"
+	AuthMethodJWT         = "jwt"
+	AuthMethodCertificate = "certificate"
+)
+
+// IsAuthMethod checks if method is one of the known authentication methods
+func IsAuthMethod(method string) bool {
+	return method == AuthMethodAPIKey || method == AuthMethodBasic || method == AuthMethodJWT || method == AuthMethodCertificate
+}
+
+// RoleAssignment binds a role to an identity authenticated with the given method, assignments are
+// stored in the database and take precedence over the role in the auth config
+type RoleAssignment struct {
+	Method   string `json:"method"`
+	Identity string `json:"identity"`
+	Role     Role   `json:"role"`
+}
+
+// RoleAssignmentKey returns the key of the assignment of an identity, identities with the same
+// name authenticated with another method do not share an assignment
+func RoleAssignmentKey(method string, identity string) string {
+	if len(method) == 0 {
+		return identity
+	}
+
+	return method + "/" + identity
+}
+
+// Key returns the key of the assignment, see RoleAssignmentKey
+func (a *RoleAssignment) Key() string {
+	return RoleAssignmentKey(a.Method, a.Identity)
+}
+
+// AuthConfig defines how requests to the REST API are authenticated, authentication is enabled when
+// at least one API key, user, JWT key or client certificate config is configured
+//   APIKeys: static keys sent in the X-API-Key header
+//   Users: users for HTTP basic authentication
+//   JWT: validation of bearer tokens, see JWTConfig
+//   ClientCertificate: authentication with TLS client certificates, see ClientCertificateConfig
+//   PublicPaths: paths of endpoints that can be requested without authentication, defaults to /health, /health/live and /health/ready
+//   DefaultRole: role of identities without a configured or assigned role, no access when empty
+type AuthConfig struct {
+	APIKeys           []APIKeyConfig           `json:"apiKeys"`
+	Users             []UserConfig             `json:"users"`
+	JWT               *JWTConfig               `json:"jwt"`
+	ClientCertificate *ClientCertificateConfig `json:"clientCertificate"`
+	PublicPaths       []string                 `json:"publicPaths"`
+	DefaultRole       Role                     `json:"defaultRole"`
+}
+
+// APIKeyConfig defines a static API key
+//   Name: name of the identity using the key
+//   Key: the key itself
+//   Role: role of the identity when no role is assigned in the database
+type APIKeyConfig struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	Role Role   `json:"role"`
+}
+
+// UserConfig defines a user for HTTP basic authentication
+//   Name: username
+//   PasswordHash: bcrypt hash of the password, use the -hashpassword flag to create one
+//   Role: role of the user when no role is assigned in the database
+type UserConfig struct {
+	Name         string `json:"name"`
+	PasswordHash string `json:"passwordHash"`
+	Role         Role   `json:"role"`
+}
+
+// JWTConfig defines how bearer tokens are validated, the subject of a token is used as identity
+//   Algorithm: HS256, HS384, HS512 or RS256, defaults to HS256
+//   Secret: shared secret for the HS algorithms
+//   PublicKeyFile: path to a PEM encoded RSA public key for RS256
+//   Issuer: when set the iss claim of a token has to match
+//   Audience: when set the aud claim of a token has to contain the audience
+//   RoleClaim: name of the claim holding the role of the subject, for instance role
+//   AllowMissingExpiry: accept tokens without an exp claim, these tokens never expire
+type JWTConfig struct {
+	Algorithm          string `json:"algorithm"`
+	Secret             string `json:"secret"`
+	PublicKeyFile      string `json:"publicKeyFile"`
+	Issuer             string `json:"issuer"`
+	Audience           string `json:"audience"`
+	RoleClaim          string `json:"roleClaim"`
+	AllowMissingExpiry bool   `json:"allowMissingExpiry"`
+}
+
+// ClientCertificateConfig defines authentication with the client certificates verified by the TLS
+// clientCAFile, the common name of the certificate subject is used as identity
+//   Roles: role per common name, used when no role is assigned in the database
+type ClientCertificateConfig struct {
+	Roles map[string]Role `json:"roles"`
+}
+
+// Identity is the authenticated caller of a request
+//   Name: name of the API key, username or token subject
+//   Method: method used to authenticate, apikey, basic or jwt
+//   Role: role from the auth config or token, replaced by the role assigned in the database
+type Identity struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+	Role   Role   `json:"role"`
+}
@@ -0,0 +1,48 @@
+package models
+
+// ConnectorSelector selects the connectors of a bulk operation by id or by module and labels
+//   IDs: ids of the connectors, Module and Labels are ignored when ids are given
+//   Module: name of the module used by the connectors
+//   Labels: labels the connectors should have, a connector is selected when all labels match
+type ConnectorSelector struct {
+	IDs    []string          `json:"ids,omitempty"`
+	Module string            `json:"module,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// IsEmpty checks if the selector has no criteria
+func (s *ConnectorSelector) IsEmpty() bool {
+	return len(s.IDs) == 0 && len(s.Module) == 0 && len(s.Labels) == 0
+}
+
+// Matches checks if a connector is selected by module and labels
+func (s *ConnectorSelector) Matches(c *ConnectorBase) bool {
+	if len(s.Module) > 0 && s.Module != c.ModuleName {
+		return false
+	}
+
+	for k, v := range s.Labels {
+		if value, ok := c.Labels[k]; !ok || value != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// BulkResult holds the result of a bulk operation for every selected connector, a bulk operation is
+// not undone when it fails for some of the connectors
+type BulkResult struct {
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+// BulkItemResult is the result of a bulk operation for a single connector, Error is set when the
+// operation failed for the connector
+type BulkItemResult struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name,omitempty"`
+	Success bool          `json:"success"`
+	Error   *ErrorContent `json:"error,omitempty"`
+}
@@ -1,16 +1,95 @@
 package models
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
 
-// ConnectorModule describes all functions which will be called by the system
+	"github.com/tebben/sensorthings-connector/src/connector/logging"
+	"github.com/tebben/sensorthings-connector/src/connector/schema"
+)
+
+// ConnectorStopTimeout is the maximum time to wait for the goroutines of a module to exit
+// after its context has been cancelled
+const ConnectorStopTimeout = 10 * time.Second
+
+// ConnectorModule describes all functions which will be called by the system.
+// Start should not block, all work needs to be run by goroutines started with Go
+// and has to end when the given context is cancelled
 type ConnectorModule interface {
 	GetName() string
 	GetDescription() string
 	SetPublishChannel(chan *PublishMessage)
+	SetLiveFeed(*LiveFeed)
+	SetMetrics(*ConnectorMetrics)
+	GetMetrics() *ConnectorMetrics
+	SetLogger(*logging.Logger)
 	SettingsChanged(json.RawMessage) error
 	Setup()
-	Start()
-	Stop()
+	Start(ctx context.Context)
+	Wait(timeout time.Duration) error
+	GetFailure() *ModuleFailure
+}
+
+// ConnectorModuleFactory can be implemented by a ConnectorModule that can not be instantiated
+// from its type alone, for instance because it holds configuration. The system will use
+// NewInstance to create the module for a connector
+type ConnectorModuleFactory interface {
+	NewInstance() ConnectorModule
+}
+
+// ConnectorModuleSettingsSchema can be implemented by a ConnectorModule to describe its settings,
+// the schema is used in the OpenAPI document
+type ConnectorModuleSettingsSchema interface {
+	GetSettingsSchema() *schema.Schema
+}
+
+// ConnectorModuleRedactor can be implemented by a ConnectorModule to redact the secrets in its settings
+// itself, RedactSettings should replace every secret by RedactedValue. Other modules get the string fields
+// with format password in their settings schema and fields named like a password, secret, token or API key redacted
+type ConnectorModuleRedactor interface {
+	RedactSettings(settings json.RawMessage) json.RawMessage
+}
+
+// ScheduledModule can be implemented by a polling ConnectorModule to report the next time
+// it will fetch readings, a zero time means there is no next run
+type ScheduledModule interface {
+	GetNextRun() time.Time
+}
+
+// ConnectorModuleEndpoints can be implemented by a ConnectorModule to add its own REST endpoints, the paths
+// of the operations are relative and have to start with a static segment, for instance /Discover.
+// The operations of GetModuleOperations are mounted under /Modules/{name} and are handled by the module
+// added to the system. The operations of GetConnectorOperations are mounted under /Connectors/{id} and
+// are handled by the module instance of the connector given in the path
+type ConnectorModuleEndpoints interface {
+	GetModuleOperations() []EndpointOperation
+	GetConnectorOperations() []EndpointOperation
+}
+
+// ModuleFailure describes the last failure of a running module
+type ModuleFailure struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// ConnectorModuleTester can be implemented by a ConnectorModule to support a one-shot
+// check of its settings, for instance connecting to a broker or fetching a single reading.
+// Test should send the observations it retrieves to the PublishChannel as it would when
+// running, the system will collect them instead of publishing them. Test should return
+// before the deadline of the given context.
+type ConnectorModuleTester interface {
+	Test(ctx context.Context) []error
+}
+
+// ConnectorTestResult holds the outcome of a connector test, Observations contains the
+// messages that would have been published if the connector was running
+type ConnectorTestResult struct {
+	Success      bool              `json:"success"`
+	Observations []*PublishMessage `json:"observations"`
+	Errors       []string          `json:"errors"`
 }
 
 // ConnectorModuleBase is a basic implementation of the ConnectorModule
@@ -18,6 +97,12 @@ type ConnectorModuleBase struct {
 	Name           string               `json:"name"`
 	Description    string               `json:"description"`
 	PublishChannel chan *PublishMessage `json:"-"`
+	live           *LiveFeed
+	metrics        *ConnectorMetrics
+	logger         *logging.Logger
+	routines       sync.WaitGroup
+	failure        *ModuleFailure
+	failureMutex   sync.RWMutex
 }
 
 // GetName returns the name of the module
@@ -36,6 +121,124 @@ func (mm *ConnectorModuleBase) SetPublishChannel(channel chan *PublishMessage) {
 	mm.PublishChannel = channel
 }
 
+// SetLiveFeed will be called by the system and passes in the live feed of the connector,
+// the feed is nil when the module is not used by a saved connector
+func (mm *ConnectorModuleBase) SetLiveFeed(feed *LiveFeed) {
+	mm.live = feed
+}
+
+// GetLiveFeed returns the live feed of the connector, modules which do not publish through
+// Publish can use it to send their messages to live subscribers
+func (mm *ConnectorModuleBase) GetLiveFeed() *LiveFeed {
+	return mm.live
+}
+
+// SetMetrics will be called by the system and passes in the metrics of the connector,
+// the metrics are nil when the module is not used by a saved connector
+func (mm *ConnectorModuleBase) SetMetrics(metrics *ConnectorMetrics) {
+	mm.metrics = metrics
+}
+
+// GetMetrics returns the metrics of the connector, modules which do not publish through
+// Publish and PublishRaw can use it to record their messages and errors in the statistics of the connector
+func (mm *ConnectorModuleBase) GetMetrics() *ConnectorMetrics {
+	return mm.metrics
+}
+
+// SetLogger will be called by the system and passes in the logger of the connector, the logger
+// is nil when the module is not used by a saved connector
+func (mm *ConnectorModuleBase) SetLogger(logger *logging.Logger) {
+	mm.logger = logger
+}
+
+// GetLogger returns the logger of the connector, messages logged with it are tagged with the connector
+// id and module and kept in the log of the connector. It can be used when the logger is nil
+func (mm *ConnectorModuleBase) GetLogger() *logging.Logger {
+	return mm.logger
+}
+
+// Publish passes a PublishMessage to the PublishChannel, false is returned when the
+// context is done before the message could be handed over
+func (mm *ConnectorModuleBase) Publish(ctx context.Context, pm *PublishMessage) bool {
+	pm.Metrics = mm.metrics
+	mm.metrics.Queued(1)
+	defer mm.metrics.Queued(-1)
+
+	select {
+	case mm.PublishChannel <- pm:
+		mm.live.SendObservation(pm)
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// PublishRaw sends a raw incoming payload to the live subscribers of the connector and counts
+// it as a received message, source describes where the payload came from, for instance a topic or url
+func (mm *ConnectorModuleBase) PublishRaw(source string, payload []byte) {
+	mm.metrics.MessageReceived()
+	mm.live.SendRaw(source, payload)
+}
+
+// MappingError records an incoming message that could not be mapped to an observation
+func (mm *ConnectorModuleBase) MappingError(err error) {
+	mm.metrics.MappingError(err)
+}
+
+// Poll runs fetch and records its duration as the poll duration of the connector, an error returned by
+// fetch is counted as a poll error. Polling modules should fetch their readings through Poll
+func (mm *ConnectorModuleBase) Poll(fetch func() error) {
+	defer mm.metrics.Polled(time.Now())
+	if err := fetch(); err != nil {
+		mm.logger.Errorf("Unable to fetch readings: %v", err)
+		mm.metrics.Error(ErrorCategoryPoll, err)
+	}
+}
+
+// Go runs f in a new goroutine which is tracked by the module, Wait can be used to block
+// until all goroutines started with Go have returned
+func (mm *ConnectorModuleBase) Go(f func()) {
+	mm.routines.Add(1)
+	go func() {
+		defer mm.routines.Done()
+		f()
+	}()
+}
+
+// Wait blocks until all goroutines started with Go have returned, an error is returned
+// when they are still running after the given timeout
+func (mm *ConnectorModuleBase) Wait(timeout time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		mm.routines.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("Module %s did not stop within %v", mm.Name, timeout)
+	}
+}
+
+// Fail records a failure of the running module, for instance a lost connection or a crashed
+// process, the failure is logged, reported as part of the connector and counted as a module error
+func (mm *ConnectorModuleBase) Fail(err error) {
+	mm.logger.Errorf("%v", err)
+	mm.metrics.Error(ErrorCategoryModule, err)
+	mm.failureMutex.Lock()
+	defer mm.failureMutex.Unlock()
+	mm.failure = &ModuleFailure{Time: time.Now(), Message: err.Error()}
+}
+
+// GetFailure returns the last failure recorded by Fail or nil if the module did not fail
+func (mm *ConnectorModuleBase) GetFailure() *ModuleFailure {
+	mm.failureMutex.RLock()
+	defer mm.failureMutex.RUnlock()
+	return mm.failure
+}
+
 // Connector defines a connector that can be created by the user, a connector instantiates a ConnectorModule
 // so a module can be used multiple times for instance when you want to connect multiple Netatmo accounts
 type Connector interface {
@@ -45,20 +248,113 @@ type Connector interface {
 	GetModule() ConnectorModule
 	GetSettings() json.RawMessage
 	GetIsRunning() bool
+	GetRevision() int64
 
 	Start()
-	Stop()
+	Stop() error
 }
 
-// ConnectorBase is the default implementation of a Connector
+// ConnectorBase is the default implementation of a Connector, Revision is increased on every change
+// of the connector and Source holds the path of the definition file of a connector that is managed by a file.
+// The running state is guarded by stateMutex, use GetIsRunning to read it once the connector is shared
 type ConnectorBase struct {
-	ID          string          `json:"id"`
-	Name        string          `json:"name"`
-	Description string          `json:"description"`
-	ModuleName  string          `json:"module"`
-	Running     bool            `json:"running"`
-	Settings    json.RawMessage `json:"settings"`
-	Module      ConnectorModule `json:"-"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	ModuleName  string            `json:"module"`
+	Running     bool              `json:"running"`
+	Settings    json.RawMessage   `json:"settings"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Revision    int64             `json:"revision"`
+	Source      string            `json:"source,omitempty"`
+	Module      ConnectorModule   `json:"-"`
+	stateMutex  sync.RWMutex
+	cancel      context.CancelFunc
+	startedAt   time.Time
+}
+
+// MarshalJSON adds the last failure and next scheduled run of the module, the status summary
+// and whether the connector is read-only to the JSON representation of the connector
+func (c *ConnectorBase) MarshalJSON() ([]byte, error) {
+	type connector ConnectorBase
+	var failure *ModuleFailure
+	var nextRun *time.Time
+	var status *ConnectorStatusSummary
+	snapshot := c.Copy()
+	if c.Module != nil {
+		s := snapshot.GetStatus()
+		status = s.Summary()
+		failure = s.Failure
+		nextRun = s.NextRun
+	}
+
+	return json.Marshal(&struct {
+		*connector
+		ReadOnly bool                    `json:"readOnly,omitempty"`
+		Failure  *ModuleFailure          `json:"failure,omitempty"`
+		NextRun  *time.Time              `json:"nextRun,omitempty"`
+		Status   *ConnectorStatusSummary `json:"status,omitempty"`
+	}{(*connector)(snapshot), c.IsReadOnly(), failure, nextRun, status})
+}
+
+// Copy returns a copy of the connector using the same module, the copy holds a snapshot of the
+// running state and can not stop the connector
+func (c *ConnectorBase) Copy() *ConnectorBase {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+
+	return &ConnectorBase{
+		ID:          c.ID,
+		Name:        c.Name,
+		Description: c.Description,
+		ModuleName:  c.ModuleName,
+		Running:     c.Running,
+		Settings:    c.Settings,
+		Labels:      c.Labels,
+		Revision:    c.Revision,
+		Source:      c.Source,
+		Module:      c.Module,
+		startedAt:   c.startedAt,
+	}
+}
+
+// GetStatus returns the lifecycle state and statistics of the connector, the next scheduled run and module
+// specific information are added for a running connector when the module implements ScheduledModule and
+// ConnectorModuleStatus
+func (c *ConnectorBase) GetStatus() *ConnectorStatus {
+	status := &ConnectorStatus{ID: c.ID, State: ConnectorStateStopped}
+	if c.Module == nil {
+		status.Errors = make(map[ErrorCategory]uint64)
+		return status
+	}
+
+	c.Module.GetMetrics().setStatistics(status)
+	status.Failure = c.Module.GetFailure()
+	c.stateMutex.RLock()
+	running, startedAt := c.Running, c.startedAt
+	c.stateMutex.RUnlock()
+	if !running || startedAt.IsZero() {
+		return status
+	}
+
+	status.State = ConnectorStateRunning
+	status.StartedAt = &startedAt
+	status.UptimeSeconds = int64(time.Since(startedAt).Seconds())
+	if status.Failure != nil && !status.Failure.Time.Before(startedAt) {
+		status.State = ConnectorStateFailed
+	}
+
+	if scheduled, ok := c.Module.(ScheduledModule); ok {
+		if next := scheduled.GetNextRun(); !next.IsZero() {
+			status.NextRun = &next
+		}
+	}
+
+	if moduleStatus, ok := c.Module.(ConnectorModuleStatus); ok {
+		status.Module = moduleStatus.GetModuleStatus()
+	}
+
+	return status
 }
 
 // GetID returns the id of the connector
@@ -88,22 +384,60 @@ func (c *ConnectorBase) GetSettings() json.RawMessage {
 
 // GetIsRunning returns if the connector is running or not
 func (c *ConnectorBase) GetIsRunning() bool {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+
 	return c.Running
 }
 
+// GetRevision returns the revision of the connector, the revision starts at 1 and is increased
+// every time the connector is changed
+func (c *ConnectorBase) GetRevision() int64 {
+	return c.Revision
+}
+
+// IsReadOnly returns true when the connector is defined by a file, see Source, such a connector
+// can not be changed through the REST API
+func (c *ConnectorBase) IsReadOnly() bool {
+	return len(c.Source) > 0
+}
+
 // GetModule returns the instantiated ConnectorModule for the Connector
 func (c *ConnectorBase) GetModule() ConnectorModule {
 	return c.Module
 }
 
-// Start wil start running the connector
+// Start wil start running the connector, the module runs under a new context
+// which is cancelled by Stop. Start does nothing when the connector is already started
 func (c *ConnectorBase) Start() {
-	go c.GetModule().Start()
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+
+	if c.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.startedAt = time.Now()
+	c.GetModule().Start(ctx)
 	c.Running = true
 }
 
-// Stop will stop the connector
-func (c *ConnectorBase) Stop() {
-	go c.GetModule().Stop()
+// Stop will stop the connector by cancelling the context of the module and waiting
+// until all module goroutines have exited or ConnectorStopTimeout has passed
+func (c *ConnectorBase) Stop() error {
+	c.stateMutex.Lock()
+	cancel := c.cancel
 	c.Running = false
+	c.cancel = nil
+	c.startedAt = time.Time{}
+	c.stateMutex.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	return c.GetModule().Wait(ConnectorStopTimeout)
 }
@@ -0,0 +1,10 @@
+package models
+
+// EncryptionConfig defines the key used to encrypt the connectors and templates in the database with
+// AES-GCM, the database is not encrypted when no key is configured
+//   KeyFile: file holding the base64 encoded 256 bit key, a key can be created with the -generatekey flag
+//   KeyEnv: name of the environment variable holding the base64 encoded key, used when there is no KeyFile
+type EncryptionConfig struct {
+	KeyFile string `json:"keyFile"`
+	KeyEnv  string `json:"keyEnv"`
+}
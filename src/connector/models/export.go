@@ -0,0 +1,98 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ConfigBundleVersion is the version of the bundle format written by an export
+const ConfigBundleVersion = 1
+
+// RedactedValue replaces secrets in redacted exports, an imported secret with this value
+// keeps the secret that is currently stored
+const RedactedValue = "********"
+
+// ConfigBundle holds the complete configuration of the connector and is used to export and import it
+//   Version: version of the bundle format, see ConfigBundleVersion
+//   Connectors: all connectors ordered by name
+//   Templates: all connector templates
+type ConfigBundle struct {
+	Version    int                   `json:"version"`
+	Connectors []ConnectorDefinition `json:"connectors"`
+	Templates  []*ConnectorTemplate  `json:"templates,omitempty"`
+}
+
+// ConnectorDefinition is the stored configuration of a connector without its runtime state
+type ConnectorDefinition struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	ModuleName  string            `json:"module"`
+	Running     bool              `json:"running"`
+	Settings    json.RawMessage   `json:"settings"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// ConnectorFilesConfig defines a directory of connector definition files, the stored connectors are
+// reconciled with the files at startup. Connectors defined by a file are read-only in the REST API
+//   Directory: directory holding the definitions, one connector per .json, .yaml or .yml file. The id of
+// 	a connector defaults to the file name without extension
+//   Watch: reconcile again when a file is added, changed or removed
+//   Interval: interval (in seconds) in which the directory is checked for changes, defaults to 10
+type ConnectorFilesConfig struct {
+	Directory string        `json:"directory"`
+	Watch     bool          `json:"watch"`
+	Interval  time.Duration `json:"intervalSeconds"`
+}
+
+// ImportResult describes the changes made, or the changes that would be made in a dry run, by an import.
+// Failed is the number of changes that could not be applied, an import is not undone when some of its
+// changes fail
+type ImportResult struct {
+	DryRun     bool          `json:"dryRun"`
+	Failed     int           `json:"failed"`
+	Connectors ImportChanges `json:"connectors"`
+	Templates  ImportChanges `json:"templates"`
+}
+
+// ImportChanges lists the created, changed and deleted items of an import
+type ImportChanges struct {
+	Created []ImportChange `json:"created"`
+	Changed []ImportChange `json:"changed"`
+	Deleted []ImportChange `json:"deleted"`
+}
+
+// ImportChange describes a single created, changed or deleted item, Fields holds the names
+// of the changed fields and Error is set when the change could not be applied
+type ImportChange struct {
+	ID     string        `json:"id"`
+	Name   string        `json:"name"`
+	Fields []string      `json:"fields,omitempty"`
+	Error  *ErrorContent `json:"error,omitempty"`
+}
+
+// GetDefinition returns the definition of the connector
+func (c *ConnectorBase) GetDefinition() ConnectorDefinition {
+	return ConnectorDefinition{
+		ID:          c.ID,
+		Name:        c.Name,
+		Description: c.Description,
+		ModuleName:  c.ModuleName,
+		Running:     c.GetIsRunning(),
+		Settings:    c.Settings,
+		Labels:      c.Labels,
+	}
+}
+
+// ToConnector creates a ConnectorBase from the definition
+func (d ConnectorDefinition) ToConnector() *ConnectorBase {
+	return &ConnectorBase{
+		ID:          d.ID,
+		Name:        d.Name,
+		Description: d.Description,
+		ModuleName:  d.ModuleName,
+		Running:     d.Running,
+		Settings:    d.Settings,
+		Labels:      d.Labels,
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tebben/sensorthings-connector/src/connector/schema"
+)
+
+// ExternalModuleConfig defines a module that runs as a separate process, the process is started
+// for every running connector and communicates with the connector over stdin and stdout
+//   Name: name of the module, used when creating a connector
+//   Description: description of the module
+//   Command: path of the executable to run
+//   Args: arguments passed to the executable
+//   Env: extra environment variables in the form key=value
+//   HealthInterval: interval (in seconds) in which a health message is requested, defaults to 30
+//   SettingsSchema: optional JSON schema describing the settings of the module
+type ExternalModuleConfig struct {
+	Name           string         `json:"name"`
+	Description    string         `json:"description"`
+	Command        string         `json:"command"`
+	Args           []string       `json:"args"`
+	Env            []string       `json:"env"`
+	HealthInterval time.Duration  `json:"healthIntervalSeconds"`
+	SettingsSchema *schema.Schema `json:"settingsSchema"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// HealthConfig defines which conditions make the connector not ready, see GET /health/ready
+//   ConnectionGraceSeconds: number of seconds a connection to a broker may be lost before it counts, defaults to 0
+//   IgnorePublishBroker: stay ready while the publish client is not connected to the publish broker
+//   MaxUnhealthyConnectors: number of running connectors that may be unhealthy while ready, -1 ignores the connectors
+//   StaleSeconds: a running connector is unhealthy when it did not publish an observation for this number
+// 	of seconds, 0 disables the check
+type HealthConfig struct {
+	ConnectionGraceSeconds int  `json:"connectionGraceSeconds"`
+	IgnorePublishBroker    bool `json:"ignorePublishBroker"`
+	MaxUnhealthyConnectors int  `json:"maxUnhealthyConnectors"`
+	StaleSeconds           int  `json:"staleSeconds"`
+}
+
+// HealthStatus is the outcome of a health check
+type HealthStatus string
+
+// HealthStatus is a "enumeration" of the outcomes of a health check
+const (
+	HealthStatusOK       HealthStatus = "ok"
+	HealthStatusDegraded HealthStatus = "degraded"
+)
+
+// ConnectorModuleHealth can be implemented by a ConnectorModule to report problems of a running connector
+// that do not stop the module, for instance a lost broker connection. The connector is unhealthy when
+// CheckHealth returns an error, grace is the time a connection may be lost before it is a problem
+type ConnectorModuleHealth interface {
+	CheckHealth(grace time.Duration) error
+}
+
+// Readiness holds the outcome of the readiness checks, Status is degraded when one of the checks is degraded
+type Readiness struct {
+	Status        HealthStatus          `json:"status"`
+	Database      HealthCheck           `json:"database"`
+	PublishBroker HealthCheck           `json:"publishBroker"`
+	Connectors    ConnectorsHealthCheck `json:"connectors"`
+}
+
+// HealthCheck holds the outcome of a single check, Message explains a problem even when it is
+// tolerated by the configured thresholds
+type HealthCheck struct {
+	Status  HealthStatus `json:"status"`
+	Message string       `json:"message,omitempty"`
+}
+
+// ConnectorsHealthCheck holds the outcome of checking the running connectors
+//   Running: number of running connectors
+//   Unhealthy: the running connectors that are failed, report a problem or are stale
+type ConnectorsHealthCheck struct {
+	Status    HealthStatus       `json:"status"`
+	Message   string             `json:"message,omitempty"`
+	Running   int                `json:"running"`
+	Unhealthy []*ConnectorHealth `json:"unhealthy"`
+}
+
+// ConnectorHealth describes why a running connector is unhealthy
+type ConnectorHealth struct {
+	ID      string         `json:"id"`
+	Name    string         `json:"name"`
+	State   ConnectorState `json:"state"`
+	Message string         `json:"message"`
+}
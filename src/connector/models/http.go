@@ -3,6 +3,7 @@ package models
 import (
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"time"
 )
 
 // Server interface for starting and stopping the HTTP server
@@ -19,17 +20,67 @@ const (
 	HTTPOperationGet    HTTPOperation = "GET"
 	HTTPOperationPost   HTTPOperation = "POST"
 	HTTPOperationPatch  HTTPOperation = "PATCH"
+	HTTPOperationPut    HTTPOperation = "PUT"
 	HTTPOperationDelete HTTPOperation = "DELETE"
 )
 
+// CORSConfig defines which browser origins can use the REST API, preflight requests are answered
+// before authentication. All origins are allowed when no origins are configured
+//   AllowedOrigins: origins allowed to call the API, * allows all and https://*.example.com allows all subdomains
+//   AllowedMethods: methods allowed in a preflight, defaults to all methods used by the API
+//   AllowedHeaders: request headers allowed in a preflight, * allows all, defaults to the headers used by the API
+//   ExposedHeaders: response headers readable by the browser, defaults to ETag and Location
+//   AllowCredentials: allow cookies and authorization headers managed by the browser, the origin of the request
+// 	is then returned instead of *. Requires a list of allowed origins without *
+//   MaxAge: time (in seconds) a browser can cache a preflight, defaults to 600
+type CORSConfig struct {
+	AllowedOrigins   []string      `json:"allowedOrigins"`
+	AllowedMethods   []string      `json:"allowedMethods"`
+	AllowedHeaders   []string      `json:"allowedHeaders"`
+	ExposedHeaders   []string      `json:"exposedHeaders"`
+	AllowCredentials bool          `json:"allowCredentials"`
+	MaxAge           time.Duration `json:"maxAgeSeconds"`
+}
+
+// TLSConfig defines HTTPS for the REST API, HTTPS is enabled when a certificate and key are configured
+//   CertFile: path to the PEM encoded certificate, intermediate certificates can follow the certificate
+//   KeyFile: path to the PEM encoded private key
+//   MinVersion: minimum TLS version, 1.2 or 1.3, defaults to 1.2
+//   ClientCAFile: path to the PEM encoded CA certificates used to verify client certificates
+//   ClientAuth: require (default) or optional, with optional a client certificate is only verified when given, see ClientCertificateConfig
+//   ReloadInterval: time (in seconds) between checks for changed certificate, key and CA files, defaults to 60
+//   RedirectAddress: address of an HTTP listener redirecting all requests to HTTPS, for instance :80
+type TLSConfig struct {
+	CertFile        string        `json:"certFile"`
+	KeyFile         string        `json:"keyFile"`
+	MinVersion      string        `json:"minVersion"`
+	ClientCAFile    string        `json:"clientCAFile"`
+	ClientAuth      string        `json:"clientAuth"`
+	ReloadInterval  time.Duration `json:"reloadIntervalSeconds"`
+	RedirectAddress string        `json:"redirectAddress"`
+}
+
+// IsEnabled checks if a certificate and key are configured
+func (t TLSConfig) IsEnabled() bool {
+	return len(t.CertFile) > 0 && len(t.KeyFile) > 0
+}
+
 // HTTPHandler func defines the format of the handler to process the incoming request
 type HTTPHandler func(w http.ResponseWriter, r *http.Request, ps httprouter.Params, m *System)
 
-// EndpointOperation contains the needed information to create an endpoint in the HTTP.Router
+// EndpointOperation contains the needed information to create an endpoint in the HTTP.Router, Permission
+// is the permission the role of the caller needs when authentication is enabled.
+// Summary, Request, Response and Status are used to document the operation in the OpenAPI document.
+// Request and Response hold an empty value of the body type, for instance []ConnectorBase{}
 type EndpointOperation struct {
 	OperationType HTTPOperation `json:"operation"`
 	Path          string        `json:"path"` //relative path to the endpoint for example: /v1.0/myendpoint/
 	Handler       HTTPHandler   `json:"-"`
+	Permission    Permission    `json:"permission,omitempty"`
+	Summary       string        `json:"summary,omitempty"`
+	Request       interface{}   `json:"-"`
+	Response      interface{}   `json:"-"`
+	Status        int           `json:"-"` // status code of a successful request, defaults to 200
 }
 
 // Endpoint defines the rest endpoint options
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// liveBufferSize is the number of messages buffered for a live subscription, messages are
+// dropped when a subscriber does not keep up
+const liveBufferSize = 100
+
+// LiveMessageType describes the content of a LiveMessage
+type LiveMessageType string
+
+// LiveMessageType is a "enumeration" of the messages sent to live subscriptions
+const (
+	LiveMessageObservation LiveMessageType = "observation"
+	LiveMessageRaw         LiveMessageType = "raw"
+)
+
+// LiveMessage is sent to the subscribers of the live feed of a connector
+//   Type: observation for a published message, raw for an incoming payload
+//   Topic: publish topic of an observation or source of a raw payload, for instance an MQTT topic
+//   Observation: the published observation
+//   Payload: the raw incoming payload
+type LiveMessage struct {
+	Type        LiveMessageType `json:"type"`
+	Time        time.Time       `json:"time"`
+	Topic       string          `json:"topic"`
+	Observation *Observation    `json:"observation,omitempty"`
+	Payload     string          `json:"payload,omitempty"`
+}
+
+// LiveFeed distributes the messages of a single connector to its live subscriptions, all methods
+// can be called on a nil LiveFeed in which case nothing is sent
+type LiveFeed struct {
+	subscriptions map[*LiveSubscription]bool
+	mutex         sync.RWMutex
+	closed        bool
+}
+
+// LiveSubscription receives the messages of a LiveFeed on Messages, the channel is closed when
+// the feed is closed
+//   Topic: only messages with a matching topic are received, MQTT wildcards can be used
+//   Raw: when true raw incoming payloads are received as well
+type LiveSubscription struct {
+	Messages chan *LiveMessage
+	Topic    string
+	Raw      bool
+}
+
+// CreateLiveFeed creates a LiveFeed without subscriptions
+func CreateLiveFeed() *LiveFeed {
+	return &LiveFeed{subscriptions: make(map[*LiveSubscription]bool)}
+}
+
+// Subscribe adds a subscription to the feed, Unsubscribe has to be called when the subscriber is done
+func (f *LiveFeed) Subscribe(topic string, raw bool) *LiveSubscription {
+	s := &LiveSubscription{Messages: make(chan *LiveMessage, liveBufferSize), Topic: topic, Raw: raw}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		close(s.Messages)
+	} else {
+		f.subscriptions[s] = true
+	}
+
+	return s
+}
+
+// Unsubscribe removes a subscription from the feed
+func (f *LiveFeed) Unsubscribe(s *LiveSubscription) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.subscriptions[s] {
+		delete(f.subscriptions, s)
+		close(s.Messages)
+	}
+}
+
+// Close ends all subscriptions, for instance when the connector is deleted
+func (f *LiveFeed) Close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.closed = true
+	for s := range f.subscriptions {
+		delete(f.subscriptions, s)
+		close(s.Messages)
+	}
+}
+
+// IsActive returns true when the feed has subscribers
+func (f *LiveFeed) IsActive() bool {
+	if f == nil {
+		return false
+	}
+
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return len(f.subscriptions) > 0
+}
+
+// SendObservation sends a published message to the subscriptions
+func (f *LiveFeed) SendObservation(pm *PublishMessage) {
+	if f.IsActive() {
+		f.send(&LiveMessage{Type: LiveMessageObservation, Time: time.Now(), Topic: pm.Topic, Observation: pm.Observation})
+	}
+}
+
+// SendRaw sends a raw incoming payload to the subscriptions that requested raw payloads
+func (f *LiveFeed) SendRaw(source string, payload []byte) {
+	if f.IsActive() {
+		f.send(&LiveMessage{Type: LiveMessageRaw, Time: time.Now(), Topic: source, Payload: string(payload)})
+	}
+}
+
+func (f *LiveFeed) send(msg *LiveMessage) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	for s := range f.subscriptions {
+		if msg.Type == LiveMessageRaw && !s.Raw {
+			continue
+		}
+
+		if len(s.Topic) > 0 && !TopicMatches(s.Topic, msg.Topic) {
+			continue
+		}
+
+		select {
+		case s.Messages <- msg:
+		default:
+		}
+	}
+}
+
+// TopicMatches checks if a topic matches a filter which can contain the MQTT wildcards + and #
+func TopicMatches(filter, topic string) bool {
+	filterParts := strings.Split(filter, "/")
+	topicParts := strings.Split(topic, "/")
+	for i, f := range filterParts {
+		if f == "#" {
+			return true
+		}
+
+		if i >= len(topicParts) || (f != "+" && f != topicParts[i]) {
+			return false
+		}
+	}
+
+	return len(filterParts) == len(topicParts)
+}
@@ -0,0 +1,11 @@
+package models
+
+// LogConfig defines the level and format of the log and the number of log entries kept per connector
+//   Level: minimum level of the messages logged by connectors, debug, info, warn or error, defaults to info
+//   Format: text or json, defaults to text
+//   BufferSize: number of recent log entries kept per connector, defaults to 500
+type LogConfig struct {
+	Level      string `json:"level"`
+	Format     string `json:"format"`
+	BufferSize int    `json:"bufferSize"`
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tebben/sensorthings-connector/src/connector/metrics"
+)
+
+// MQTTClientRole describes what an MQTT client is used for in the connection state metric
+type MQTTClientRole string
+
+// MQTTClientRole is a "enumeration" of the MQTT clients used by the connector
+const (
+	MQTTClientPublish   MQTTClientRole = "publish"
+	MQTTClientSubscribe MQTTClientRole = "subscribe"
+)
+
+var (
+	messagesReceived = metrics.NewCounterVec("sensorthings_connector_messages_received_total",
+		"Number of incoming messages received by a connector", "connector", "module")
+	observationsPublished = metrics.NewCounterVec("sensorthings_connector_observations_published_total",
+		"Number of observations published to the SensorThings server", "connector", "module")
+	publishFailures = metrics.NewCounterVec("sensorthings_connector_publish_failures_total",
+		"Number of observations that could not be published to the SensorThings server", "connector", "module")
+	mappingErrors = metrics.NewCounterVec("sensorthings_connector_mapping_errors_total",
+		"Number of incoming messages that could not be mapped to an observation", "connector", "module")
+	queueDepth = metrics.NewGaugeVec("sensorthings_connector_queue_depth",
+		"Number of observations waiting to be handed to the publish client", "connector", "module")
+	lastObservation = metrics.NewGaugeVec("sensorthings_connector_last_observation_timestamp_seconds",
+		"Unix time of the last observation that was published successfully", "connector", "module")
+	pollDuration = metrics.NewSummaryVec("sensorthings_connector_poll_duration_seconds",
+		"Duration of fetching readings by a polling module", "connector", "module")
+	mqttConnected = metrics.NewGaugeVec("sensorthings_connector_mqtt_connected",
+		"1 when the MQTT client is connected to the broker, 0 otherwise", "connector", "module", "broker", "client")
+)
+
+// ConnectorMetrics records the metrics of a single connector labelled by connector id and module name and
+// collects the statistics returned in the status of the connector. All methods can be called on a nil
+// ConnectorMetrics in which case nothing is recorded
+type ConnectorMetrics struct {
+	connector       string
+	module          string
+	mutex           sync.RWMutex
+	messagesIn      uint64
+	messagesOut     uint64
+	errors          map[ErrorCategory]uint64
+	lastObservation *ObservationRecord
+	lastError       *ErrorRecord
+}
+
+// CreateConnectorMetrics creates the metrics for the connector with the given id and module
+func CreateConnectorMetrics(connector string, module string) *ConnectorMetrics {
+	return &ConnectorMetrics{connector: connector, module: module, errors: make(map[ErrorCategory]uint64)}
+}
+
+// DeleteConnectorMetrics removes all metrics of the connector with the given id
+func DeleteConnectorMetrics(connector string) {
+	metrics.DefaultRegistry.Delete("connector", connector)
+}
+
+// MQTTConnectionGauge returns the gauge holding the connection state of an MQTT client, cm is nil for
+// the publish client which is not owned by a connector
+func MQTTConnectionGauge(cm *ConnectorMetrics, broker string, role MQTTClientRole) *metrics.Gauge {
+	connector, module := "", ""
+	if cm != nil {
+		connector, module = cm.connector, cm.module
+	}
+
+	return mqttConnected.With(connector, module, broker, string(role))
+}
+
+// GetModuleName returns the name of the module the metrics are labelled with
+func (cm *ConnectorMetrics) GetModuleName() string {
+	if cm == nil {
+		return ""
+	}
+
+	return cm.module
+}
+
+// MessageReceived counts an incoming message
+func (cm *ConnectorMetrics) MessageReceived() {
+	if cm == nil {
+		return
+	}
+
+	messagesReceived.With(cm.connector, cm.module).Inc()
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	cm.messagesIn++
+}
+
+// MappingError counts an incoming message that could not be mapped to an observation
+func (cm *ConnectorMetrics) MappingError(err error) {
+	if cm == nil {
+		return
+	}
+
+	mappingErrors.With(cm.connector, cm.module).Inc()
+	cm.Error(ErrorCategoryMapping, err)
+}
+
+// Queued changes the number of observations waiting to be handed to the publish client by delta
+func (cm *ConnectorMetrics) Queued(delta int) {
+	if cm != nil {
+		queueDepth.With(cm.connector, cm.module).Add(float64(delta))
+	}
+}
+
+// Published counts an observation that was published and records it as the last observation
+func (cm *ConnectorMetrics) Published(pm *PublishMessage) {
+	if cm == nil {
+		return
+	}
+
+	now := time.Now()
+	observationsPublished.With(cm.connector, cm.module).Inc()
+	lastObservation.With(cm.connector, cm.module).Set(float64(now.UnixNano()) / 1e9)
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	cm.messagesOut++
+	cm.lastObservation = &ObservationRecord{Time: now, Topic: pm.Topic, Observation: pm.Observation}
+}
+
+// PublishFailed counts an observation that could not be published
+func (cm *ConnectorMetrics) PublishFailed(err error) {
+	if cm == nil {
+		return
+	}
+
+	publishFailures.With(cm.connector, cm.module).Inc()
+	cm.Error(ErrorCategoryPublish, err)
+}
+
+// Polled records the duration of fetching readings that started at the given time
+func (cm *ConnectorMetrics) Polled(start time.Time) {
+	if cm != nil {
+		pollDuration.With(cm.connector, cm.module).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Error counts an error of the given category and records it as the last error
+func (cm *ConnectorMetrics) Error(category ErrorCategory, err error) {
+	if cm == nil || err == nil {
+		return
+	}
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	cm.errors[category]++
+	cm.lastError = &ErrorRecord{Time: time.Now(), Category: category, Message: err.Error()}
+}
+
+// setStatistics copies the collected statistics into a status
+func (cm *ConnectorMetrics) setStatistics(status *ConnectorStatus) {
+	status.Errors = make(map[ErrorCategory]uint64)
+	if cm == nil {
+		return
+	}
+
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	status.MessagesIn = cm.messagesIn
+	status.MessagesOut = cm.messagesOut
+	status.LastObservation = cm.lastObservation
+	status.LastError = cm.lastError
+	for category, count := range cm.errors {
+		status.Errors[category] = count
+	}
+}
@@ -31,12 +31,12 @@ type PubBroker struct {
 
 // SubBroker defines a subscription broker
 type SubBroker struct {
-	ClientID string   `json:"clientId"`
-	QOS      byte     `json:"qos"`
-	Host     string   `json:"host"`
-	Username string   `json:"username"`
-	Password string   `json:"password"`
-	Streams  []Stream `json:"streams"`
+	ClientID string   `json:"clientId" description:"Client id used to connect to the broker"`
+	QOS      byte     `json:"qos" description:"Quality of service used when subscribing"`
+	Host     string   `json:"host" description:"Host of the broker including scheme and port, for instance tcp://host:1883"`
+	Username string   `json:"username" description:"Username needed to connect to the broker"`
+	Password string   `json:"password" description:"Password needed to connect to the broker" secret:"true"`
+	Streams  []Stream `json:"streams" description:"Topics to subscribe to and their mapping"`
 }
 
 // Stream defines a datastream coming from a subscription broker
@@ -44,9 +44,9 @@ type SubBroker struct {
 //   OutgoingTopic: The topic where the connector will publish the message to
 //   Mapping: FromValue -> ToValue, simple implementation for our use-case now
 type Stream struct {
-	IncomingTopic string             `json:"topicIn"`
-	OutgoingTopic string             `json:"topicOut"`
-	Mapping       map[string]ToValue `json:"mapping"`
+	IncomingTopic string             `json:"topicIn" description:"Topic to subscribe to"`
+	OutgoingTopic string             `json:"topicOut" description:"SensorThings MQTT topic to publish to"`
+	Mapping       map[string]ToValue `json:"mapping" description:"Incoming field name to observation parameter"`
 }
 
 // ToValue defines the SensorThings output value, used in combination with an
@@ -54,6 +54,24 @@ type Stream struct {
 //   Name: the name of the SensorThings observation parameter i.e. result, phenomenonTime
 //   ToInt: if the value needs to be converted into an int, useful for string values from the incoming data
 type ToValue struct {
-	Name    string `json:"name"`
-	ToFloat bool   `json:"toFloat"`
+	Name    string `json:"name" description:"Observation parameter, result or phenomenonTime"`
+	ToFloat bool   `json:"toFloat" description:"Convert the incoming value to a number"`
+}
+
+// MQTTBrokerStatus holds the connection state of a subscription client of a running connector
+type MQTTBrokerStatus struct {
+	Host      string             `json:"host"`
+	Connected bool               `json:"connected"`
+	Streams   []MQTTStreamStatus `json:"streams"`
+}
+
+// MQTTStreamStatus holds the subscription state of a stream of a subscription client
+//   Subscribed: true when the subscription on the incoming topic succeeded and the connection was not lost since
+//   Messages: number of messages received on the incoming topic
+type MQTTStreamStatus struct {
+	IncomingTopic string     `json:"topicIn"`
+	OutgoingTopic string     `json:"topicOut"`
+	Subscribed    bool       `json:"subscribed"`
+	Messages      uint64     `json:"messages"`
+	LastMessage   *time.Time `json:"lastMessage,omitempty"`
 }
@@ -2,10 +2,13 @@ package models
 
 // PublishMessage is used to publish a message trough the PubClient.
 // When a subscription client receives a message it will be transformed into a PublishMessage
-// and send trough the publish channel where the publish broker will pick up the message
+// and send trough the publish channel where the publish broker will pick up the message.
+// Metrics holds the metrics of the connector that sent the message, the publish client records
+// the outcome of publishing the message in it
 type PublishMessage struct {
-	Topic       string       `json:"topic"`
-	Observation *Observation `json:"observation"`
+	Topic       string            `json:"topic"`
+	Observation *Observation      `json:"observation"`
+	Metrics     *ConnectorMetrics `json:"-"`
 }
 
 // Observation in SensorThings represents a single Sensor reading of an ObservedProperty. A physical device, a Sensor, sends
@@ -0,0 +1,107 @@
+package models
+
+import "time"
+
+// ConnectorState describes the lifecycle state of a connector
+type ConnectorState string
+
+// ConnectorState is a "enumeration" of the lifecycle states of a connector, a running connector
+// is failed when its module reported a failure since it was started
+const (
+	ConnectorStateStopped ConnectorState = "stopped"
+	ConnectorStateRunning ConnectorState = "running"
+	ConnectorStateFailed  ConnectorState = "failed"
+)
+
+// ErrorCategory describes where an error recorded in the statistics of a connector occurred
+type ErrorCategory string
+
+// ErrorCategory is a "enumeration" of the errors counted in the statistics of a connector
+const (
+	ErrorCategoryMapping    ErrorCategory = "mapping"
+	ErrorCategoryPublish    ErrorCategory = "publish"
+	ErrorCategoryConnection ErrorCategory = "connection"
+	ErrorCategoryPoll       ErrorCategory = "poll"
+	ErrorCategoryModule     ErrorCategory = "module"
+)
+
+// ConnectorModuleStatus can be implemented by a ConnectorModule to add module specific runtime
+// information to the status of a connector, for instance the connection state of its brokers.
+// GetModuleStatus is only called for a running connector
+type ConnectorModuleStatus interface {
+	GetModuleStatus() interface{}
+}
+
+// ConnectorStatus holds the runtime information of a connector, the statistics are kept while
+// the connector exists and are not reset when the connector is stopped or changed
+//   StartedAt: time the connector was started, not set for a stopped connector
+//   UptimeSeconds: number of seconds the connector has been running since it was started
+//   MessagesIn: number of incoming messages received
+//   MessagesOut: number of observations published
+//   Errors: number of errors per category
+//   NextRun: next time a running scheduled module fetches readings, see ScheduledModule
+//   Module: module specific information of a running connector
+type ConnectorStatus struct {
+	ID              string                   `json:"id"`
+	State           ConnectorState           `json:"state"`
+	StartedAt       *time.Time               `json:"startedAt,omitempty"`
+	UptimeSeconds   int64                    `json:"uptimeSeconds"`
+	MessagesIn      uint64                   `json:"messagesIn"`
+	MessagesOut     uint64                   `json:"messagesOut"`
+	Errors          map[ErrorCategory]uint64 `json:"errors"`
+	LastObservation *ObservationRecord       `json:"lastObservation,omitempty"`
+	LastError       *ErrorRecord             `json:"lastError,omitempty"`
+	Failure         *ModuleFailure           `json:"failure,omitempty"`
+	NextRun         *time.Time               `json:"nextRun,omitempty"`
+	Module          interface{}              `json:"module,omitempty"`
+}
+
+// ConnectorStatusSummary is the compact status of a connector included in the connector
+//   Errors: total number of errors of all categories
+type ConnectorStatusSummary struct {
+	State               ConnectorState `json:"state"`
+	UptimeSeconds       int64          `json:"uptimeSeconds"`
+	MessagesIn          uint64         `json:"messagesIn"`
+	MessagesOut         uint64         `json:"messagesOut"`
+	Errors              uint64         `json:"errors"`
+	LastObservationTime *time.Time     `json:"lastObservationTime,omitempty"`
+	LastErrorTime       *time.Time     `json:"lastErrorTime,omitempty"`
+}
+
+// ObservationRecord holds the last observation published by a connector
+type ObservationRecord struct {
+	Time        time.Time    `json:"time"`
+	Topic       string       `json:"topic"`
+	Observation *Observation `json:"observation"`
+}
+
+// ErrorRecord holds the last error of a connector
+type ErrorRecord struct {
+	Time     time.Time     `json:"time"`
+	Category ErrorCategory `json:"category"`
+	Message  string        `json:"message"`
+}
+
+// Summary returns the compact version of the status
+func (s *ConnectorStatus) Summary() *ConnectorStatusSummary {
+	summary := &ConnectorStatusSummary{
+		State:         s.State,
+		UptimeSeconds: s.UptimeSeconds,
+		MessagesIn:    s.MessagesIn,
+		MessagesOut:   s.MessagesOut,
+	}
+
+	for _, count := range s.Errors {
+		summary.Errors += count
+	}
+
+	if s.LastObservation != nil {
+		summary.LastObservationTime = &s.LastObservation.Time
+	}
+
+	if s.LastError != nil {
+		summary.LastErrorTime = &s.LastError.Time
+	}
+
+	return summary
+}
@@ -1,17 +1,50 @@
 package models
 
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/tebben/sensorthings-connector/src/connector/logging"
+)
+
 type System interface {
-	AddModule(ConnectorModule)
+	AddModule(ConnectorModule) error
 	GetModules() ([]ConnectorModule, error)
 	GetConnectors() ([]Connector, error)
 	GetConnector(id string) (Connector, error)
+	RedactConnector(connector Connector) Connector
 	GetEndpoints() []ConnectorEndpoint
 
-	CreateConnector(connector *ConnectorBase) (Connector, error)
-	PatchConnector(id string, connector *ConnectorBase) (Connector, error)
-	DeleteConnector(id string) error
+	CreateConnector(ctx context.Context, connector *ConnectorBase) (Connector, error)
+	PatchConnector(ctx context.Context, id string, patch json.RawMessage, revision int64) (Connector, error)
+	ReplaceConnector(ctx context.Context, id string, connector *ConnectorBase, revision int64) (Connector, error)
+	DeleteConnector(ctx context.Context, id string) error
+	CloneConnector(ctx context.Context, id string, overrides json.RawMessage) (Connector, error)
+
+	GetTemplates() ([]*ConnectorTemplate, error)
+	GetTemplate(id string) (*ConnectorTemplate, error)
+	CreateTemplate(template *ConnectorTemplate) (*ConnectorTemplate, error)
+	DeleteTemplate(id string) error
+	CreateConnectorFromTemplate(ctx context.Context, instance *TemplateInstance) (Connector, error)
+
+	Export(redact bool) (*ConfigBundle, error)
+	Import(ctx context.Context, bundle *ConfigBundle, replace bool, dryRun bool) (*ImportResult, error)
+
+	GetRoleAssignments() ([]*RoleAssignment, error)
+	GetRoleAssignment(method string, identity string) (*RoleAssignment, error)
+	SetRoleAssignment(assignment *RoleAssignment) (*RoleAssignment, error)
+	DeleteRoleAssignment(method string, identity string) error
+
+	GetAuditEvents(query *AuditQuery) ([]*AuditEvent, error)
 
-	SetConnectorState(id string, running bool) error
+	SetConnectorState(ctx context.Context, id string, running bool) error
+	SetConnectorsState(ctx context.Context, selector *ConnectorSelector, running bool) (*BulkResult, error)
+	TestConnector(id string) (*ConnectorTestResult, error)
+	TestConnectorSettings(connector *ConnectorBase) (*ConnectorTestResult, error)
+	GetLiveFeed(id string) (*LiveFeed, error)
+	GetConnectorStatus(id string) (*ConnectorStatus, error)
+	GetConnectorLogs(id string) (*logging.Buffer, error)
+	GetReadiness() *Readiness
 
 	Start()
 }
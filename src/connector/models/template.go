@@ -0,0 +1,126 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// templateVariable matches a variable reference in template settings, for instance ${brokerHost}
+var templateVariable = regexp.MustCompile(`\$\{([A-Za-z0-9_.-]+)\}`)
+
+// ConnectorTemplate is a stored settings document for a module with named variables, variables can be
+// used in any string of the settings as ${name}. When a string consists of a single variable the string
+// is replaced by the value of the variable so numbers and booleans keep their type
+type ConnectorTemplate struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	ModuleName  string             `json:"module"`
+	Settings    json.RawMessage    `json:"settings"`
+	Variables   []TemplateVariable `json:"variables"`
+}
+
+// TemplateVariable describes a variable used in a ConnectorTemplate, a variable without
+// a default value is required when instantiating the template
+type TemplateVariable struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+}
+
+// TemplateInstance is used to create a connector from a template
+type TemplateInstance struct {
+	Template    string                 `json:"template"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Variables   map[string]interface{} `json:"variables"`
+}
+
+// GetVariableNames returns the names of all variables used in the settings of the template
+func (t *ConnectorTemplate) GetVariableNames() []string {
+	found := make(map[string]bool)
+	for _, match := range templateVariable.FindAllStringSubmatch(string(t.Settings), -1) {
+		found[match[1]] = true
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// IsTemplateVariable checks if a string consists of a single variable reference
+func IsTemplateVariable(s string) bool {
+	match := templateVariable.FindString(s)
+	return len(match) > 0 && match == s
+}
+
+// Instantiate creates the settings for a connector by replacing all variables in the template
+// settings, an error is returned when a variable without default value is not given
+func (t *ConnectorTemplate) Instantiate(variables map[string]interface{}) (json.RawMessage, error) {
+	values := make(map[string]interface{})
+	for _, v := range t.Variables {
+		if v.Default != nil {
+			values[v.Name] = v.Default
+		}
+	}
+
+	for name, value := range variables {
+		values[name] = value
+	}
+
+	missing := make([]string, 0)
+	for _, name := range t.GetVariableNames() {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("Missing template variables: %s", strings.Join(missing, ", "))
+	}
+
+	var settings interface{}
+	if err := json.Unmarshal(t.Settings, &settings); err != nil {
+		return nil, fmt.Errorf("Unable to read settings of template %s", t.Name)
+	}
+
+	return json.Marshal(replaceVariables(settings, values))
+}
+
+// replaceVariables walks a decoded JSON document and replaces the variables in all strings
+func replaceVariables(node interface{}, values map[string]interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			n[k] = replaceVariables(v, values)
+		}
+		return n
+	case []interface{}:
+		for i, v := range n {
+			n[i] = replaceVariables(v, values)
+		}
+		return n
+	case string:
+		if match := templateVariable.FindStringSubmatch(n); match != nil && match[0] == n {
+			return values[match[1]]
+		}
+
+		return templateVariable.ReplaceAllStringFunc(n, func(s string) string {
+			name := templateVariable.FindStringSubmatch(s)[1]
+			if str, ok := values[name].(string); ok {
+				return str
+			}
+
+			return fmt.Sprint(values[name])
+		})
+	}
+
+	return node
+}
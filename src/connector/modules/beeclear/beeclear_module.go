@@ -1,29 +1,37 @@
 package beeclear
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/tebben/sensorthings-connector/src/connector/models"
+	"github.com/tebben/sensorthings-connector/src/connector/schedule"
+	"github.com/tebben/sensorthings-connector/src/connector/schema"
+	"io/ioutil"
 	"net/http"
 	"strings"
 	"time"
 )
 
+// fetchTimeout is the maximum duration of a single request to the BeeClear
+const fetchTimeout = 60 * time.Second
+
 // BeeClearModule adds support for publishing BeeClear readings
 // to a SensorThings MQTT server.
 type BeeClearModule struct {
 	models.ConnectorModuleBase
 	settings      BeeClearSettings
 	fetchInterval time.Duration
-	ticker        *time.Ticker
+	schedule      *schedule.Schedule
 }
 
 // BeeClearSettings contains information on BeeClear login and reading to datastream mappings
 type BeeClearSettings struct {
-	BeeClearHost  string        `json:"bcHost"`
-	FetchInterval time.Duration `json:"fetchIntervalSeconds"`
-	Mappings      []Mapping     `json:"mappings"`
+	BeeClearHost  string            `json:"bcHost" description:"Address of the BeeClear, for instance http://192.168.1.20" secret:"true"`
+	FetchInterval time.Duration     `json:"fetchIntervalSeconds" description:"Interval in seconds between readings, defaults to 600"`
+	Schedule      schedule.Settings `json:"schedule" description:"Optional schedule, overrides fetchIntervalSeconds"`
+	Mappings      []Mapping         `json:"mappings" description:"BeeClear readings to publish"`
 }
 
 // Mapping describes which value needs to published to what topic
@@ -40,14 +48,10 @@ func (bc *BeeClearModule) Setup() {
 }
 
 // Start receiving BeeClear readings and publish it to a SensorThings server
-func (bc *BeeClearModule) Start() {
+// until the given context is done
+func (bc *BeeClearModule) Start(ctx context.Context) {
 	//ToDo: Check settings
-	bc.run()
-}
-
-// Stop receiving BeeClear readings
-func (bc *BeeClearModule) Stop() {
-	bc.ticker.Stop()
+	bc.Go(func() { bc.run(ctx) })
 }
 
 // SettingsChanged will try to parse and set BeeClearSettings from a json.RawMessage
@@ -62,53 +66,104 @@ func (bc *BeeClearModule) SettingsChanged(settings json.RawMessage) error {
 		s.BeeClearHost = s.BeeClearHost[:len(s.BeeClearHost)-1]
 	}
 
+	interval := s.FetchInterval
+	if interval == 0 {
+		interval = bc.fetchInterval
+	}
+
+	sched, err := schedule.CreateSchedule(s.Schedule, time.Second*interval)
+	if err != nil {
+		return err
+	}
+
 	bc.settings = s
+	bc.schedule = sched
 	return nil
 }
 
-func (bc *BeeClearModule) run() {
-	interval := bc.settings.FetchInterval
-	if interval == 0 {
-		interval = bc.fetchInterval
+// GetSettingsSchema returns the schema of BeeClearSettings
+func (bc *BeeClearModule) GetSettingsSchema() *schema.Schema {
+	return schema.Generate(BeeClearSettings{})
+}
+
+// GetNextRun returns the next time readings will be fetched
+func (bc *BeeClearModule) GetNextRun() time.Time {
+	return bc.schedule.NextRun()
+}
+
+func (bc *BeeClearModule) run(ctx context.Context) {
+	if bc.schedule == nil {
+		bc.Fail(errors.New("No valid schedule, check the settings"))
+		return
 	}
 
-	bc.ticker = time.NewTicker(time.Second * interval)
-	go func() {
-		for range bc.ticker.C {
-			// ToDo retrieve readings
-			// ToDo create PublishMessage
-			// ToDo send publish message to channel: bc.PublishChannel <- publishMessage
-
-			// Sample
-			url := fmt.Sprintf("%s/bc_usage?date=1445554800&duration=168&period=24", bc.settings.BeeClearHost)
-			bcUsage := make(map[string]int64)
-
-			if err := getJson(url, &bcUsage); err == nil {
-				for _, mapping := range bc.settings.Mappings {
-					//check if param exist
-					if _, ok := bcUsage[mapping.DataType]; !ok {
-						continue
-					}
-
-					pm := &models.PublishMessage{}
-					pm.Topic = mapping.PublishTopic
-					pm.Observation = &models.Observation{}
-					pm.Observation.Result = bcUsage[mapping.DataType]
-					pm.Observation.PhenomenonTime = time.Unix(bcUsage["d"], 0).Format(time.RFC3339Nano)
-
-					bc.PublishChannel <- pm
-				}
-			}
-		}
-	}()
+	bc.schedule.Run(ctx, func() { bc.Poll(func() error { return bc.fetch(ctx, fetchTimeout) }) })
+}
+
+// Test fetches the BeeClear readings once
+func (bc *BeeClearModule) Test(ctx context.Context) []error {
+	if len(bc.settings.BeeClearHost) == 0 {
+		return []error{errors.New("No BeeClear host configured")}
+	}
+
+	if err := bc.fetch(ctx, 0); err != nil {
+		return []error{err}
+	}
+
+	return nil
 }
 
-func getJson(url string, target interface{}) error {
-	r, err := http.Get(url)
+// fetch retrieves the current readings from the BeeClear and sends a PublishMessage
+// for every configured mapping, the request is cancelled when the context is done or when it
+// takes longer than timeout, a timeout of 0 means no timeout
+func (bc *BeeClearModule) fetch(ctx context.Context, timeout time.Duration) error {
+	// Sample
+	url := fmt.Sprintf("%s/bc_usage?date=1445554800&duration=168&period=24", bc.settings.BeeClearHost)
+	bcUsage := make(map[string]int64)
+
+	body, err := getBody(ctx, url, timeout)
 	if err != nil {
 		return err
 	}
+
+	bc.PublishRaw(url, body)
+	if err := json.Unmarshal(body, &bcUsage); err != nil {
+		bc.MappingError(err)
+		return err
+	}
+
+	for _, mapping := range bc.settings.Mappings {
+		//check if param exist
+		if _, ok := bcUsage[mapping.DataType]; !ok {
+			continue
+		}
+
+		pm := &models.PublishMessage{}
+		pm.Topic = mapping.PublishTopic
+		pm.Observation = &models.Observation{}
+		pm.Observation.Result = bcUsage[mapping.DataType]
+		pm.Observation.PhenomenonTime = time.Unix(bcUsage["d"], 0).Format(time.RFC3339Nano)
+
+		if !bc.Publish(ctx, pm) {
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func getBody(ctx context.Context, url string, timeout time.Duration) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	r, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
 	defer r.Body.Close()
 
-	return json.NewDecoder(r.Body).Decode(target)
+	return ioutil.ReadAll(r.Body)
 }
@@ -0,0 +1,199 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tebben/sensorthings-connector/src/connector/logging"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+	"github.com/tebben/sensorthings-connector/src/connector/schema"
+)
+
+const (
+	stopTimeout    = 5 * time.Second
+	restartDelay   = 10 * time.Second
+	healthInterval = 30
+)
+
+// ExternalModule runs a connector in a separate process, see the package documentation
+// for a description of the protocol
+type ExternalModule struct {
+	models.ConnectorModuleBase
+	config   models.ExternalModuleConfig
+	settings json.RawMessage
+}
+
+// CreateExternalModule creates a module for the given external module config
+func CreateExternalModule(config models.ExternalModuleConfig) *ExternalModule {
+	return &ExternalModule{config: config}
+}
+
+// NewInstance creates a new module using the same external module config
+func (em *ExternalModule) NewInstance() models.ConnectorModule {
+	return CreateExternalModule(em.config)
+}
+
+// Setup initialised the module using the external module config
+func (em *ExternalModule) Setup() {
+	em.Name = em.config.Name
+	em.Description = em.config.Description
+	if em.config.HealthInterval == 0 {
+		em.config.HealthInterval = healthInterval
+	}
+}
+
+// Start runs the external process until the given context is done, when the process exits
+// unexpectedly the failure is recorded and the process is restarted
+func (em *ExternalModule) Start(ctx context.Context) {
+	em.Go(func() {
+		for {
+			err := em.run(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+
+			em.Fail(err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(restartDelay):
+			}
+		}
+	})
+}
+
+// Test starts the external process and asks it to run a one-shot test, observations sent by
+// the process are handled until a testResult is received
+func (em *ExternalModule) Test(ctx context.Context) []error {
+	p, err := em.startProcess()
+	if err != nil {
+		return []error{err}
+	}
+
+	defer p.stop(stopTimeout)
+	if err := p.send(&Message{Type: MessageTypeTest}); err != nil {
+		return []error{err}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return []error{fmt.Errorf("External module %s did not send a test result", em.Name)}
+		case msg, ok := <-p.messages:
+			if !ok {
+				return []error{p.wait()}
+			}
+
+			if msg.Type == MessageTypeTestResult {
+				errs := make([]error, 0)
+				for _, e := range msg.Errors {
+					errs = append(errs, errors.New(e))
+				}
+
+				return errs
+			}
+
+			em.handleMessage(ctx, msg)
+		}
+	}
+}
+
+// GetSettingsSchema returns the settings schema from the external module config
+func (em *ExternalModule) GetSettingsSchema() *schema.Schema {
+	return em.config.SettingsSchema
+}
+
+// SettingsChanged stores the settings which are passed on to the process when it is started
+func (em *ExternalModule) SettingsChanged(settings json.RawMessage) error {
+	if len(settings) > 0 && !json.Valid(settings) {
+		return fmt.Errorf("Unable to read %s Module settings", em.Name)
+	}
+
+	em.settings = settings
+	return nil
+}
+
+// startProcess starts the external process and sends the connector settings
+func (em *ExternalModule) startProcess() (*process, error) {
+	p, err := startProcess(em.config, em.GetLogger())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.send(&Message{Type: MessageTypeSettings, Settings: em.settings}); err != nil {
+		p.stop(stopTimeout)
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// run starts the process and handles its messages until the context is done or
+// the process exits, the reason of the exit is returned
+func (em *ExternalModule) run(ctx context.Context) error {
+	p, err := em.startProcess()
+	if err != nil {
+		return err
+	}
+
+	defer p.stop(stopTimeout)
+	if err := p.send(&Message{Type: MessageTypeStart}); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(time.Second * em.config.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			p.send(&Message{Type: MessageTypeHealth})
+		case msg, ok := <-p.messages:
+			if !ok {
+				return p.wait()
+			}
+
+			em.handleMessage(ctx, msg)
+		}
+	}
+}
+
+// handleMessage handles a message sent by the external process
+func (em *ExternalModule) handleMessage(ctx context.Context, msg *Message) {
+	switch msg.Type {
+	case MessageTypeObservation:
+		{
+			em.GetMetrics().MessageReceived()
+			if len(msg.Topic) == 0 || msg.Observation == nil {
+				em.MappingError(errors.New("Observation without topic or observation"))
+				em.GetLogger().Warnf("External module %s sent an observation without topic or observation", em.Name)
+				return
+			}
+
+			em.Publish(ctx, &models.PublishMessage{Topic: msg.Topic, Observation: msg.Observation})
+		}
+	case MessageTypeLog:
+		{
+			level, err := logging.ParseLevel(msg.Level)
+			if err != nil {
+				level = logging.LevelInfo
+			}
+
+			em.GetLogger().Logf(level, "External module %s: %s", em.Name, msg.Message)
+		}
+	case MessageTypeHealth:
+		{
+			if msg.Healthy != nil && !*msg.Healthy {
+				em.Fail(fmt.Errorf("unhealthy: %s", msg.Message))
+			}
+		}
+	default:
+		em.GetLogger().Warnf("External module %s sent an unknown message type: %s", em.Name, msg.Type)
+	}
+}
@@ -0,0 +1,151 @@
+package external
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/tebben/sensorthings-connector/src/connector/logging"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// process wraps a running external module executable
+type process struct {
+	name     string
+	logger   *logging.Logger
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	encoder  *json.Encoder
+	mutex    sync.Mutex
+	messages chan *Message
+	done     chan struct{}
+	exited   chan struct{}
+	err      error
+	stopOnce sync.Once
+}
+
+// startProcess starts the executable of the given module config and starts reading messages from
+// its stdout, messages can be received on the messages channel which is closed when stdout is closed
+// or the process has exited. The stderr output of the process is logged line by line with the given logger
+func startProcess(config models.ExternalModuleConfig, logger *logging.Logger) (*process, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Env = append(os.Environ(), config.Env...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &process{
+		name:     config.Name,
+		logger:   logger,
+		cmd:      cmd,
+		stdin:    stdin,
+		encoder:  json.NewEncoder(stdin),
+		messages: make(chan *Message),
+		done:     make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+
+	go p.read(stdout)
+	go p.log(stderr)
+	go p.waitExit()
+	return p, nil
+}
+
+// waitExit waits until the process has exited and closes the exited channel, the exit does not depend
+// on stdout being closed so a child process that keeps stdout open does not block a stop
+func (p *process) waitExit() {
+	p.err = p.cmd.Wait()
+	if p.err == nil {
+		p.err = errors.New("process exited")
+	}
+
+	close(p.exited)
+}
+
+// read decodes every line written to stdout into a Message until stdout is closed, the
+// messages channel is closed after that
+func (p *process) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		msg := &Message{}
+		if err := json.Unmarshal(scanner.Bytes(), msg); err != nil {
+			p.logger.Warnf("External module %s sent an invalid message: %v", p.name, err)
+			continue
+		}
+
+		select {
+		case p.messages <- msg:
+		case <-p.done:
+		}
+	}
+
+	close(p.messages)
+}
+
+// log writes every line written to stderr to the log until stderr is closed
+func (p *process) log(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		p.logger.Infof("External module %s: %s", p.name, scanner.Text())
+	}
+
+	// a line that is too long stops the scanner, the rest is discarded so the process does not block on stderr
+	io.Copy(ioutil.Discard, stderr)
+}
+
+// send writes a message as a single line to the stdin of the process
+func (p *process) send(msg *Message) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.encoder.Encode(msg)
+}
+
+// wait blocks until the process has exited and returns the reason
+func (p *process) wait() error {
+	<-p.exited
+	return p.err
+}
+
+// stop asks the process to stop and closes its stdin, when the process is still
+// running after the given timeout it will be killed. stop blocks until the process has exited
+func (p *process) stop(timeout time.Duration) {
+	p.stopOnce.Do(func() {
+		close(p.done)
+		p.send(&Message{Type: MessageTypeStop})
+		p.stdin.Close()
+	})
+
+	select {
+	case <-p.exited:
+	case <-time.After(timeout):
+		p.logger.Warnf("External module %s did not stop within %v, killing process", p.name, timeout)
+		p.cmd.Process.Kill()
+		<-p.exited
+	}
+}
@@ -0,0 +1,54 @@
+// Package external adds support for modules that run as a separate process. The connector starts
+// the configured executable for every running connector and communicates with it using JSON lines,
+// one JSON object per line, over stdin and stdout. Everything written to stderr is logged.
+//
+// Messages sent by the connector to the process (stdin):
+//   {"type": "settings", "settings": {...}}   the settings of the connector, sent before start and test
+//   {"type": "start"}                         start collecting and sending observations
+//   {"type": "stop"}                          stop and exit, the process is killed when it does not exit in time
+//   {"type": "health"}                        request a health message
+//   {"type": "test"}                          optional, run a one-shot test and reply with a testResult
+//
+// Messages sent by the process to the connector (stdout):
+//   {"type": "observation", "topic": "...", "observation": {...}}   publish an observation to the topic
+//   {"type": "log", "level": "info", "message": "..."}               write a message to the connector log
+//   {"type": "health", "healthy": true, "message": "..."}            report the health of the process
+//   {"type": "testResult", "errors": ["..."]}                        end of a test started by a test message
+//
+// When the process exits while the connector is running the exit is reported as a failure of the
+// connector and the process is restarted.
+package external
+
+import (
+	"encoding/json"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// MessageType describes the type of a message exchanged with an external process
+type MessageType string
+
+// MessageType is a "enumeration" of the messages in the external module protocol
+const (
+	MessageTypeSettings    MessageType = "settings"
+	MessageTypeStart       MessageType = "start"
+	MessageTypeStop        MessageType = "stop"
+	MessageTypeHealth      MessageType = "health"
+	MessageTypeTest        MessageType = "test"
+	MessageTypeObservation MessageType = "observation"
+	MessageTypeLog         MessageType = "log"
+	MessageTypeTestResult  MessageType = "testResult"
+)
+
+// Message is a single line in the external module protocol, only the fields
+// belonging to the type of the message are set
+type Message struct {
+	Type        MessageType         `json:"type"`
+	Settings    json.RawMessage     `json:"settings,omitempty"`
+	Topic       string              `json:"topic,omitempty"`
+	Observation *models.Observation `json:"observation,omitempty"`
+	Level       string              `json:"level,omitempty"`
+	Message     string              `json:"message,omitempty"`
+	Healthy     *bool               `json:"healthy,omitempty"`
+	Errors      []string            `json:"errors,omitempty"`
+}
@@ -1,18 +1,31 @@
 package mqtt
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
 	"github.com/tebben/sensorthings-connector/src/connector/models"
 	connectorMQTT "github.com/tebben/sensorthings-connector/src/connector/mqtt"
+	"github.com/tebben/sensorthings-connector/src/connector/rest"
+	"github.com/tebben/sensorthings-connector/src/connector/schema"
 )
 
 // MQTTModule can be used as middleware to connect a MQTT stream of observations (using structured data) to a
 // SensorThings server.
 type MQTTModule struct {
 	models.ConnectorModuleBase
-	settings   MQTTModuleSettings
-	subClients []connectorMQTT.MqttSubClient
+	settings     MQTTModuleSettings
+	ctx          context.Context
+	clients      []*connectorMQTT.MqttSubClient
+	clientsMutex sync.RWMutex
 }
 
 // MQTTModuleSettings is used to configure the listening MQTT clients
@@ -27,26 +40,159 @@ func (mq *MQTTModule) Setup() {
 	mq.Description = "Map a structured non MQTT stream to a SensorThings observation stream"
 }
 
-// Start will create MQTT subscription clients that are configured in the settings and start them
-func (mq *MQTTModule) Start() {
-	mq.subClients = []connectorMQTT.MqttSubClient{}
+// Start will create MQTT subscription clients that are configured in the settings and start them,
+// the clients are stopped when the given context is done
+func (mq *MQTTModule) Start(ctx context.Context) {
+	clients := make([]*connectorMQTT.MqttSubClient, 0, len(mq.settings.SubBrokers))
 	for _, sb := range mq.settings.SubBrokers {
-		subClient := connectorMQTT.CreateSubClient(sb.Host, sb.QOS, sb.Streams, sb.ClientID, mq.PublishChannel, sb.Username, sb.Password, 300, 20)
-		subClient.Start()
+		subClient := connectorMQTT.CreateSubClient(sb.Host, sb.QOS, sb.Streams, sb.ClientID, mq.PublishChannel, mq.GetMetrics(), mq.GetLogger(), sb.Username, sb.Password, 300, 20)
+		subClient.Live = mq.GetLiveFeed()
+		clients = append(clients, &subClient)
+		mq.Go(func() {
+			subClient.Start(ctx)
+			<-ctx.Done()
+			subClient.Stop()
+		})
+	}
+
+	mq.setClients(ctx, clients)
+	mq.Go(func() {
+		<-ctx.Done()
+		mq.setClients(nil, nil)
+	})
+}
 
-		mq.subClients = append(mq.subClients, subClient)
+// GetModuleOperations returns no operations, the MQTT module only adds connector operations
+func (mq *MQTTModule) GetModuleOperations() []models.EndpointOperation {
+	return nil
+}
+
+// GetConnectorOperations adds POST /Connectors/{id}/Ingest which can be used to push a message to a running
+// connector over HTTP, the message is handled as if it was received on the topic given in the topic parameter
+func (mq *MQTTModule) GetConnectorOperations() []models.EndpointOperation {
+	return []models.EndpointOperation{
+		{OperationType: models.HTTPOperationPost, Path: "/Ingest", Handler: mq.handleIngest,
+			Permission: models.PermissionOperate, Summary: "Push a message for the given topic to a running MQTT connector",
+			Request: map[string]interface{}{}, Status: http.StatusAccepted},
 	}
 }
 
-// Stop will stop all defined Subscription brokers
-func (mq *MQTTModule) Stop() {
-	if mq.subClients == nil {
+// handleIngest passes the body of the request to the streams of the running subscription clients
+// subscribing to the topic given in the query
+func (mq *MQTTModule) handleIngest(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	topic := r.URL.Query().Get("topic")
+	if len(topic) == 0 {
+		rest.SendError(w, connectorErrors.NewBadRequestError(errors.New("Parameter topic is required")))
 		return
 	}
 
-	for idx := range mq.subClients {
-		mq.subClients[idx].Stop()
+	mq.clientsMutex.RLock()
+	ctx, clients := mq.ctx, mq.clients
+	mq.clientsMutex.RUnlock()
+	if ctx == nil {
+		rest.SendError(w, connectorErrors.NewConflictError(fmt.Errorf("Connector %s is not running", ps.ByName("id"))))
+		return
+	}
+
+	payload, _ := ioutil.ReadAll(r.Body)
+	matched := false
+	for _, c := range clients {
+		ok, err := c.Ingest(ctx, topic, payload)
+		if err != nil {
+			rest.SendError(w, connectorErrors.NewConflictError(fmt.Errorf("Connector %s is not running", ps.ByName("id"))))
+			return
+		}
+
+		if ok {
+			matched = true
+		}
+	}
+
+	if !matched {
+		rest.SendError(w, connectorErrors.NewBadRequestError(fmt.Errorf("No stream subscribes to topic %s", topic)))
+		return
+	}
+
+	rest.SendJSONResponse(w, http.StatusAccepted, nil)
+}
+
+// MQTTModuleStatus holds the connection state of the subscription brokers of a running connector
+// in the order of the settings
+type MQTTModuleStatus struct {
+	SubBrokers []models.MQTTBrokerStatus `json:"subBrokers"`
+}
+
+// GetModuleStatus returns the connection state of every subscription broker and the subscription state of its streams
+func (mq *MQTTModule) GetModuleStatus() interface{} {
+	mq.clientsMutex.RLock()
+	defer mq.clientsMutex.RUnlock()
+
+	status := &MQTTModuleStatus{SubBrokers: make([]models.MQTTBrokerStatus, 0, len(mq.clients))}
+	for _, c := range mq.clients {
+		status.SubBrokers = append(status.SubBrokers, c.Status())
+	}
+
+	return status
+}
+
+// CheckHealth returns an error when a subscription client is not connected to its broker for longer than grace
+func (mq *MQTTModule) CheckHealth(grace time.Duration) error {
+	mq.clientsMutex.RLock()
+	defer mq.clientsMutex.RUnlock()
+
+	for _, c := range mq.clients {
+		if connected, since := c.ConnectionState(); !connected && time.Since(since) >= grace {
+			return fmt.Errorf("Not connected to %s since %s", c.Host, since.UTC().Format(time.RFC3339))
+		}
 	}
+
+	return nil
+}
+
+// setClients sets the context and subscription clients of the running connector
+func (mq *MQTTModule) setClients(ctx context.Context, clients []*connectorMQTT.MqttSubClient) {
+	mq.clientsMutex.Lock()
+	defer mq.clientsMutex.Unlock()
+	mq.ctx = ctx
+	mq.clients = clients
+}
+
+// Test connects and subscribes to every configured subscription broker at the same time
+// and listens for incoming messages until half of the time before the deadline has passed.
+// A test client id is used so running connectors with the same client id are not disconnected
+func (mq *MQTTModule) Test(ctx context.Context) []error {
+	if len(mq.settings.SubBrokers) == 0 {
+		return []error{errors.New("No subscription brokers configured")}
+	}
+
+	listen := time.Second * 5
+	if deadline, ok := ctx.Deadline(); ok {
+		listen = deadline.Sub(time.Now()) / 2
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	errs := make([]error, 0)
+
+	for _, sb := range mq.settings.SubBrokers {
+		subClient := connectorMQTT.CreateSubClient(sb.Host, sb.QOS, sb.Streams, sb.ClientID+"-test", mq.PublishChannel, nil, nil, sb.Username, sb.Password, 300, 20)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clientErrs := subClient.Test(ctx, listen)
+			mutex.Lock()
+			errs = append(errs, clientErrs...)
+			mutex.Unlock()
+		}()
+	}
+
+	wg.Wait()
+	return errs
+}
+
+// GetSettingsSchema returns the schema of MQTTModuleSettings
+func (mq *MQTTModule) GetSettingsSchema() *schema.Schema {
+	return schema.Generate(MQTTModuleSettings{})
 }
 
 // SettingsChanged will try to parse and set MQTTModuleSettings from a json.RawMessage
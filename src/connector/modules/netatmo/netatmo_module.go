@@ -1,12 +1,14 @@
 package netatmo
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/exzz/netatmo-api-go"
 	"github.com/tebben/sensorthings-connector/src/connector/models"
-	"log"
+	"github.com/tebben/sensorthings-connector/src/connector/schedule"
+	"github.com/tebben/sensorthings-connector/src/connector/schema"
 	"time"
 )
 
@@ -17,23 +19,24 @@ type NetatmoModule struct {
 	settings      NetatmoSettings
 	fetchInterval time.Duration
 	client        *netatmo.Client
-	ticker        *time.Ticker
+	schedule      *schedule.Schedule
 }
 
 // NetatmoSettings contains information on Netatmo login and sensor reading to datastream mappings
 type NetatmoSettings struct {
-	ClientID      string        `json:"clientId"`
-	ClientSecret  string        `json:"clientSecret"`
-	Username      string        `json:"username"`
-	Password      string        `json:"password"`
-	FetchInterval time.Duration `json:"fetchIntervalSeconds"`
-	Mappings      []Mapping     `json:"mappings"`
+	ClientID      string            `json:"clientId" description:"Netatmo app client id"`
+	ClientSecret  string            `json:"clientSecret" description:"Netatmo app client secret" secret:"true"`
+	Username      string            `json:"username" description:"Netatmo account username"`
+	Password      string            `json:"password" description:"Netatmo account password" secret:"true"`
+	FetchInterval time.Duration     `json:"fetchIntervalSeconds" description:"Interval in seconds between readings, defaults to 600"`
+	Schedule      schedule.Settings `json:"schedule" description:"Optional schedule, overrides fetchIntervalSeconds"`
+	Mappings      []Mapping         `json:"mappings" description:"Netatmo readings to publish"`
 }
 
 type Mapping struct {
-	ModuleID     string `json:"moduleId"`
-	DataType     string `json:"dataType"`
-	PublishTopic string `json:"publishTopic"`
+	ModuleID     string `json:"moduleId" description:"Id of the Netatmo module, for instance 70:ee:50:03:65:d4"`
+	DataType     string `json:"dataType" description:"Temperature, Humidity, Noise, Pressure or CO2"`
+	PublishTopic string `json:"publishTopic" description:"SensorThings MQTT topic to publish to"`
 }
 
 // Setup initialised the module by setting some default values
@@ -44,18 +47,14 @@ func (nm *NetatmoModule) Setup() {
 }
 
 // Start receiving Netatmo readings and publish it to a SensorThings server
-func (nm *NetatmoModule) Start() {
+// until the given context is done
+func (nm *NetatmoModule) Start(ctx context.Context) {
 	if len(nm.settings.ClientID) == 0 || len(nm.settings.ClientSecret) == 0 || len(nm.settings.Username) == 0 || len(nm.settings.Password) == 0 {
-		log.Println("Incomplete settings for Netatmo module")
+		nm.GetLogger().Errorf("Incomplete settings for Netatmo module")
 		return
 	}
 
-	nm.run()
-}
-
-// Stop receiving Netatmo readings
-func (nm *NetatmoModule) Stop() {
-	nm.ticker.Stop()
+	nm.Go(func() { nm.run(ctx) })
 }
 
 // SettingsChanged will try to parse and set NetatmoSettings from a json.RawMessage
@@ -65,52 +64,161 @@ func (nm *NetatmoModule) SettingsChanged(settings json.RawMessage) error {
 		return errors.New("Unable to read Netatmo Module settings")
 	}
 
+	interval := s.FetchInterval
+	if interval == 0 {
+		interval = nm.fetchInterval
+	}
+
+	sched, err := schedule.CreateSchedule(s.Schedule, time.Second*interval)
+	if err != nil {
+		return err
+	}
+
 	nm.settings = s
+	nm.schedule = sched
 	return nil
 }
 
-func (nm *NetatmoModule) run() {
-	var err error
-	nm.client, err = netatmo.NewClient(netatmo.Config{
-		ClientID:     nm.settings.ClientID,
-		ClientSecret: nm.settings.ClientSecret,
-		Username:     nm.settings.Username,
-		Password:     nm.settings.Password,
-	})
-	if err != nil {
-		fmt.Println(err)
+// GetSettingsSchema returns the schema of NetatmoSettings
+func (nm *NetatmoModule) GetSettingsSchema() *schema.Schema {
+	return schema.Generate(NetatmoSettings{})
+}
+
+// GetNextRun returns the next time readings will be fetched
+func (nm *NetatmoModule) GetNextRun() time.Time {
+	return nm.schedule.NextRun()
+}
+
+func (nm *NetatmoModule) run(ctx context.Context) {
+	if nm.schedule == nil {
+		nm.Fail(errors.New("No valid schedule, check the settings"))
 		return
 	}
 
-	interval := nm.settings.FetchInterval
-	if interval == 0 {
-		interval = nm.fetchInterval
+	client, err := nm.newClient(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			nm.Fail(fmt.Errorf("Unable to create Netatmo client: %v", err))
+		}
+		return
 	}
 
+	nm.client = client
+
 	// Get some readings at start
-	go nm.getReadings()
+	if nm.schedule.Active(time.Now()) {
+		nm.Poll(func() error { return nm.getReadings(ctx) })
+	}
 
-	nm.ticker = time.NewTicker(time.Second * interval)
-	go func() {
-		for range nm.ticker.C {
-			nm.getReadings()
+	nm.schedule.Run(ctx, func() { nm.Poll(func() error { return nm.getReadings(ctx) }) })
+}
+
+// Test authenticates against the Netatmo API, lists the available modules and
+// retrieves a single set of readings
+func (nm *NetatmoModule) Test(ctx context.Context) []error {
+	if len(nm.settings.ClientID) == 0 || len(nm.settings.ClientSecret) == 0 || len(nm.settings.Username) == 0 || len(nm.settings.Password) == 0 {
+		return []error{errors.New("Incomplete settings for Netatmo module")}
+	}
+
+	client, err := nm.newClient(ctx)
+	if err != nil {
+		return []error{err}
+	}
+
+	dc, err := getDeviceCollection(ctx, client)
+	if err != nil {
+		return []error{err}
+	}
+
+	errs := make([]error, 0)
+	found := make(map[string]bool)
+	for _, station := range dc.Stations() {
+		for _, module := range station.Modules() {
+			found[module.ID] = true
+		}
+
+		nm.handleReadings(ctx, station.Modules())
+	}
+
+	for _, mapping := range nm.settings.Mappings {
+		if !found[mapping.ModuleID] {
+			errs = append(errs, fmt.Errorf("Netatmo module %s not found", mapping.ModuleID))
+			found[mapping.ModuleID] = true
 		}
+	}
+
+	return errs
+}
+
+// newClient authenticates against the Netatmo API, an error is returned when the context is done first
+func (nm *NetatmoModule) newClient(ctx context.Context) (*netatmo.Client, error) {
+	var client *netatmo.Client
+	err := withContext(ctx, func() error {
+		c, err := netatmo.NewClient(netatmo.Config{
+			ClientID:     nm.settings.ClientID,
+			ClientSecret: nm.settings.ClientSecret,
+			Username:     nm.settings.Username,
+			Password:     nm.settings.Password,
+		})
+		client = c
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// getDeviceCollection retrieves the stations and modules, an error is returned when the context is done first
+func getDeviceCollection(ctx context.Context, client *netatmo.Client) (*netatmo.DeviceCollection, error) {
+	var dc *netatmo.DeviceCollection
+	err := withContext(ctx, func() error {
+		var err error
+		dc, err = client.GetDeviceCollection()
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dc, nil
+}
+
+// withContext runs a request of the Netatmo client until it returns or the context is done, the client
+// does not take a context so a request that is still running when the context is done ends in the background
+func withContext(ctx context.Context, request func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- request()
 	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (nm *NetatmoModule) getReadings() {
-	dc, err := nm.client.GetDeviceCollection()
+func (nm *NetatmoModule) getReadings(ctx context.Context) error {
+	dc, err := getDeviceCollection(ctx, nm.client)
 	if err != nil {
-		fmt.Println(err)
-	} else {
-		for _, station := range dc.Stations() {
-			go nm.handleReadings(station.Modules())
-		}
+		return err
 	}
+
+	nm.GetMetrics().MessageReceived()
+	for _, station := range dc.Stations() {
+		nm.handleReadings(ctx, station.Modules())
+	}
+
+	return nil
 }
 
 // ToDo: Lesser for loops -> create mappings?
-func (nm *NetatmoModule) handleReadings(modules []*netatmo.Device) {
+func (nm *NetatmoModule) handleReadings(ctx context.Context, modules []*netatmo.Device) {
 	for _, module := range modules {
 		for _, mapping := range nm.settings.Mappings {
 			if mapping.ModuleID == module.ID {
@@ -123,7 +231,9 @@ func (nm *NetatmoModule) handleReadings(modules []*netatmo.Device) {
 						pm.Observation.Result = value
 						pm.Observation.PhenomenonTime = time.Unix(int64(ts), 0).Format(time.RFC3339Nano)
 
-						nm.PublishChannel <- pm
+						if !nm.Publish(ctx, pm) {
+							return
+						}
 					}
 				}
 			}
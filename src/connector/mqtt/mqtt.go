@@ -1,19 +1,21 @@
 package mqtt
 
 import (
-	"log"
+	"context"
+	"sync"
 	"time"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/tebben/sensorthings-connector/src/connector/logging"
+	"github.com/tebben/sensorthings-connector/src/connector/metrics"
 	"github.com/tebben/sensorthings-connector/src/connector/models"
 )
 
 // MqttClient defines the needed methods to control our MQTT client
 type MqttClient interface {
-	Start()
 	Stop()
-	connect()
-	retryConnect()
+	connect() bool
+	retryConnect() bool
 }
 
 // MqttClientBase holds information on our client needed for a
@@ -28,10 +30,27 @@ type MqttClientBase struct {
 	PingTimeout    time.Duration
 	Connecting     bool
 	PublishChannel chan *models.PublishMessage
+	Metrics        *models.ConnectorMetrics
+	Logger         *logging.Logger
+	connection     *connection
+	ctx            context.Context
 }
 
-// SetClientBase sets the base parameters needed for our MQTT client and creates the MQTT client
-func (m *MqttClientBase) SetClientBase(host string, qos byte, clientID string, channel chan *models.PublishMessage, username string, password string, keepAlive time.Duration, pingTimeout time.Duration) {
+// connection tracks the connection state of a client, it is updated by the handlers of the paho client.
+// Session is increased on every connect so subscriptions made in an earlier session can be recognised,
+// since is the time the client was last connected or disconnected
+type connection struct {
+	mutex     sync.RWMutex
+	gauge     *metrics.Gauge
+	connected bool
+	session   uint64
+	since     time.Time
+}
+
+// SetClientBase sets the base parameters needed for our MQTT client and creates the MQTT client, the
+// connection state and connection errors of the client are recorded in the given connector metrics and
+// logged with the given logger, both are nil for a client that is not owned by a connector
+func (m *MqttClientBase) SetClientBase(host string, qos byte, clientID string, channel chan *models.PublishMessage, connectorMetrics *models.ConnectorMetrics, logger *logging.Logger, role models.MQTTClientRole, username string, password string, keepAlive time.Duration, pingTimeout time.Duration) {
 	m.Qos = qos
 	m.Host = host
 	m.Username = username
@@ -39,54 +58,125 @@ func (m *MqttClientBase) SetClientBase(host string, qos byte, clientID string, c
 	m.KeepAlive = keepAlive
 	m.PingTimeout = pingTimeout
 	m.Connecting = false
-	m.Client = createPahoClient(host, clientID, username, password, keepAlive, pingTimeout)
+	m.Metrics = connectorMetrics
+	m.Logger = logger
+	m.connection = &connection{gauge: models.MQTTConnectionGauge(connectorMetrics, host, role)}
+	m.connection.set(false)
+	m.Client = createPahoClient(host, clientID, username, password, keepAlive, pingTimeout, m.connection, connectorMetrics, logger)
 	m.PublishChannel = channel
+	m.ctx = context.Background()
 }
 
 // Stop will stop the MQTT client
 func (m *MqttClientBase) Stop() {
 	m.Client.Disconnect(500)
+	m.connection.set(false)
+}
+
+// IsConnected returns true when the client is connected to the broker
+func (m *MqttClientBase) IsConnected() bool {
+	connected, _ := m.connection.state()
+	return connected
+}
+
+// ConnectionState returns true when the client is connected to the broker and the time since when the
+// client is connected or disconnected, a client that never connected is disconnected since it was created
+func (m *MqttClientBase) ConnectionState() (bool, time.Time) {
+	m.connection.mutex.RLock()
+	defer m.connection.mutex.RUnlock()
+	return m.connection.connected, m.connection.since
 }
 
-// connect tries to connect the MQTT client to the broker, on fail the retry procedure kicks in
-func (m *MqttClientBase) connect() {
-	if token := m.Client.Connect(); token.Wait() && token.Error() != nil {
-		if !m.Connecting {
-			log.Printf("MQTT client %v", token.Error())
-			m.retryConnect()
+// connect tries to connect the MQTT client to the broker, on fail the retry procedure kicks in.
+// connect blocks until the client is connected or the context of the client is done
+func (m *MqttClientBase) connect() bool {
+	if err := waitToken(m.ctx, m.Client.Connect()); err != nil {
+		if m.ctx.Err() != nil {
+			return false
 		}
+
+		m.Logger.Errorf("MQTT client %v", err)
+		m.Metrics.Error(models.ErrorCategoryConnection, err)
+		return m.retryConnect()
 	}
+
+	return true
 }
 
 // retryConnect starts a ticker which tries to connect every xx seconds and stops the ticker
-// when a connection is established.
-func (m *MqttClientBase) retryConnect() {
-	log.Printf("MQTT client %s starting reconnect procedure in background", m.Host)
+// when a connection is established or the context of the client is done
+func (m *MqttClientBase) retryConnect() bool {
+	m.Logger.Warnf("MQTT client %s starting reconnect procedure", m.Host)
 
 	m.Connecting = true
+	defer func() { m.Connecting = false }()
+
 	ticker := time.NewTicker(time.Second * 10)
-	go func() {
-		for range ticker.C {
-			m.connect()
-			if m.Client.IsConnected() {
-				ticker.Stop()
-				m.Connecting = false
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return false
+		case <-ticker.C:
+			if err := waitToken(m.ctx, m.Client.Connect()); err == nil {
+				return true
 			}
 		}
-	}()
+	}
+}
+
+// waitToken waits until the given token completes or the context is done and returns
+// the error of the token or the context
+func waitToken(ctx context.Context, token paho.Token) error {
+	for !token.WaitTimeout(time.Millisecond * 100) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	return token.Error()
+}
+
+// set sets the connection state and the connection gauge, a new session starts when connected
+func (c *connection) set(connected bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.since.IsZero() || c.connected != connected {
+		c.since = time.Now()
+	}
+
+	c.connected = connected
+	if connected {
+		c.session++
+		c.gauge.Set(1)
+	} else {
+		c.gauge.Set(0)
+	}
+}
+
+// state returns the connection state and the current session
+func (c *connection) state() (bool, uint64) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.connected, c.session
 }
 
-// createPahoClient creates a new paho client
-func createPahoClient(host string, clientID string, username string, password string, keepAlive time.Duration, pingTimeout time.Duration) paho.Client {
+// createPahoClient creates a new paho client which keeps the connection state up to date, a lost
+// connection is recorded as a connection error in the given metrics
+func createPahoClient(host string, clientID string, username string, password string, keepAlive time.Duration, pingTimeout time.Duration, connection *connection, connectorMetrics *models.ConnectorMetrics, logger *logging.Logger) paho.Client {
 	opts := paho.NewClientOptions().AddBroker(host).SetClientID(clientID)
 	opts.SetKeepAlive(keepAlive * time.Second)
 	opts.SetPingTimeout(pingTimeout * time.Second)
 	opts.SetAutoReconnect(true)
 	opts.SetConnectionLostHandler(func(client paho.Client, err error) {
-		connectionLostHandler(client, err, host)
+		connection.set(false)
+		connectorMetrics.Error(models.ErrorCategoryConnection, err)
+		connectionLostHandler(client, err, host, logger)
 	})
 	opts.SetOnConnectHandler(func(client paho.Client) {
-		connectHandler(client, host)
+		connection.set(true)
+		connectHandler(client, host, logger)
 	})
 
 	if len(username) > 0 && len(password) > 0 {
@@ -97,10 +187,10 @@ func createPahoClient(host string, clientID string, username string, password st
 	return paho.NewClient(opts)
 }
 
-func connectHandler(c paho.Client, host string) {
-	log.Printf("MQTT client connected on %s", host)
+func connectHandler(c paho.Client, host string, logger *logging.Logger) {
+	logger.Infof("MQTT client connected on %s", host)
 }
 
-func connectionLostHandler(c paho.Client, err error, host string) {
-	log.Printf("MQTT client lost connection on: %s: errorL%v", host, err)
+func connectionLostHandler(c paho.Client, err error, host string, logger *logging.Logger) {
+	logger.Errorf("MQTT client lost connection on: %s: errorL%v", host, err)
 }
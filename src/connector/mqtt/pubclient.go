@@ -2,6 +2,7 @@ package mqtt
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/tebben/sensorthings-connector/src/connector/models"
 	"log"
 	"time"
@@ -16,7 +17,7 @@ type MqttPubClient struct {
 // CreatePubClient instantiates a MqttPubClient
 func CreatePubClient(host string, qos byte, clientID string, channel chan *models.PublishMessage, username string, password string, keepAlive time.Duration, pingTimeout time.Duration) MqttPubClient {
 	pubClient := MqttPubClient{}
-	pubClient.SetClientBase(host, qos, clientID, channel, username, password, keepAlive, pingTimeout)
+	pubClient.SetClientBase(host, qos, clientID, channel, nil, nil, models.MQTTClientPublish, username, password, keepAlive, pingTimeout)
 	return pubClient
 }
 
@@ -27,18 +28,28 @@ func (m *MqttPubClient) Start() {
 	go m.listen()
 }
 
-// listen start listening for publish messages on the PublishChannel
+// listen start listening for publish messages on the PublishChannel, the outcome of publishing
+// a message is recorded in the metrics of the connector that sent it
 func (m *MqttPubClient) listen() {
 	for {
 		pm := <-m.PublishChannel
-		if !m.Connecting {
-			jsonString, err := json.Marshal(pm.Observation)
-			if err != nil {
-				log.Printf("Error marshalling observation: %v", err.Error())
-			}
+		if m.Connecting {
+			pm.Metrics.PublishFailed(fmt.Errorf("MQTT client %s is reconnecting", m.Host))
+			continue
+		}
+
+		jsonString, err := json.Marshal(pm.Observation)
+		if err != nil {
+			log.Printf("Error marshalling observation: %v", err.Error())
+			pm.Metrics.PublishFailed(err)
+			continue
+		}
 
-			token := m.Client.Publish(pm.Topic, m.Qos, false, jsonString)
-			token.Wait()
+		token := m.Client.Publish(pm.Topic, m.Qos, false, jsonString)
+		if token.Wait() && token.Error() != nil {
+			pm.Metrics.PublishFailed(token.Error())
+		} else {
+			pm.Metrics.Published(pm)
 		}
 	}
 }
@@ -1,50 +1,219 @@
 package mqtt
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"strconv"
+	"sync"
+	"time"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/tebben/sensorthings-connector/src/connector/logging"
 	"github.com/tebben/sensorthings-connector/src/connector/models"
-	"time"
 )
 
 // MqttSubClient is the implementation of the subscription client, the subscription client
 // will connect to a broker where messages can be received
 type MqttSubClient struct {
 	MqttClientBase
-	Streams []models.Stream
+	Streams  []models.Stream
+	Live     *models.LiveFeed
+	handlers *handlerGroup
+	status   []*streamStatus
+}
+
+// ErrClientStopped is returned by Ingest when the subscription client is stopping or stopped
+var ErrClientStopped = errors.New("MQTT subscription client is stopped")
+
+// handlerGroup tracks the incoming messages that are being handled, once stop has begun no new
+// messages are accepted so stop can wait for the ones that are still handled
+type handlerGroup struct {
+	mutex   sync.Mutex
+	wg      sync.WaitGroup
+	stopped bool
+}
+
+// add registers a message to handle, false is returned when the group is stopped
+func (h *handlerGroup) add() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.stopped {
+		return false
+	}
+
+	h.wg.Add(1)
+	return true
+}
+
+func (h *handlerGroup) done() {
+	h.wg.Done()
+}
+
+// stop rejects new messages and waits until the accepted messages are handled
+func (h *handlerGroup) stop() {
+	h.mutex.Lock()
+	h.stopped = true
+	h.mutex.Unlock()
+	h.wg.Wait()
+}
+
+// streamStatus holds the session in which the incoming topic of a stream was subscribed, 0 when
+// it is not subscribed, and the messages received on the topic
+type streamStatus struct {
+	mutex       sync.RWMutex
+	session     uint64
+	messages    uint64
+	lastMessage time.Time
 }
 
-// CreateSubClient instantiates a MqttSubClient
-func CreateSubClient(host string, qos byte, streams []models.Stream, clientID string, channel chan *models.PublishMessage, username string, password string, keepAlive time.Duration, pingTimeout time.Duration) MqttSubClient {
+// CreateSubClient instantiates a MqttSubClient, the received messages and connection state of the client
+// are recorded in the given connector metrics and logged with the given logger which may both be nil
+func CreateSubClient(host string, qos byte, streams []models.Stream, clientID string, channel chan *models.PublishMessage, metrics *models.ConnectorMetrics, logger *logging.Logger, username string, password string, keepAlive time.Duration, pingTimeout time.Duration) MqttSubClient {
 	subClient := MqttSubClient{}
-	subClient.SetClientBase(host, qos, clientID, channel, username, password, keepAlive, pingTimeout)
+	subClient.SetClientBase(host, qos, clientID, channel, metrics, logger, models.MQTTClientSubscribe, username, password, keepAlive, pingTimeout)
 	subClient.Streams = streams
+	subClient.handlers = &handlerGroup{}
+	subClient.status = make([]*streamStatus, len(streams))
+	for i := range streams {
+		subClient.status[i] = &streamStatus{}
+	}
+
 	return subClient
 }
 
-// Start will start the subscription client by connecting and subscribing on topics
-func (m *MqttSubClient) Start() {
-	log.Printf("Starting MQTT subscription client on %s", m.Host)
-	m.connect()
-
-	if len(m.Streams) > 0 {
-		for idx, s := range m.Streams {
-			st := m.Streams[idx]
-			if token := m.Client.Subscribe(s.IncomingTopic, m.Qos, func(client paho.Client, msg paho.Message) {
-				go m.handleIncomingMessage(msg.Topic(), msg.Payload(), st.Mapping, st.OutgoingTopic)
-			}); token.Wait() && token.Error() != nil {
-				log.Print(token.Error())
+// Start will start the subscription client by connecting and subscribing on topics, Start blocks
+// until the client is connected or the given context is done
+func (m *MqttSubClient) Start(ctx context.Context) {
+	m.Logger.Infof("Starting MQTT subscription client on %s", m.Host)
+	m.ctx = ctx
+	if !m.connect() {
+		return
+	}
+
+	for _, err := range m.subscribe() {
+		m.Logger.Errorf("%v", err)
+	}
+}
+
+// Stop disconnects the client and waits until all incoming messages are handled, messages that
+// arrive after stop has begun are dropped
+func (m *MqttSubClient) Stop() {
+	m.handlers.stop()
+	m.MqttClientBase.Stop()
+}
+
+// Test connects to the broker and subscribes to all streams without starting the reconnect
+// procedure, incoming messages are handled until the listen duration has passed or the context
+// is done after which the client is disconnected. All errors that occurred while connecting and
+// subscribing are returned
+func (m *MqttSubClient) Test(ctx context.Context, listen time.Duration) []error {
+	m.ctx = ctx
+	if err := waitToken(ctx, m.Client.Connect()); err != nil {
+		return []error{fmt.Errorf("MQTT client %s %v", m.Host, err)}
+	}
+
+	defer m.Stop()
+	errs := m.subscribe()
+
+	select {
+	case <-time.After(listen):
+	case <-ctx.Done():
+	}
+
+	return errs
+}
+
+// subscribe subscribes on the incoming topic of all streams
+func (m *MqttSubClient) subscribe() []error {
+	errs := make([]error, 0)
+	for idx, s := range m.Streams {
+		st := idx
+		token := m.Client.Subscribe(s.IncomingTopic, m.Qos, func(client paho.Client, msg paho.Message) {
+			if !m.handlers.add() {
+				return
 			}
+
+			go func() {
+				defer m.handlers.done()
+				m.handleIncomingMessage(m.ctx, msg.Topic(), msg.Payload(), st)
+			}()
+		})
+
+		if err := waitToken(m.ctx, token); err != nil {
+			errs = append(errs, fmt.Errorf("MQTT client %s subscribe on %s: %v", m.Host, s.IncomingTopic, err))
+			continue
+		}
+
+		_, session := m.connection.state()
+		m.status[idx].mutex.Lock()
+		m.status[idx].session = session
+		m.status[idx].mutex.Unlock()
+	}
+
+	return errs
+}
+
+// Status returns the connection state of the client and the subscription state of its streams, a stream
+// is only subscribed when it was subscribed in the current session of the client
+func (m *MqttSubClient) Status() models.MQTTBrokerStatus {
+	connected, session := m.connection.state()
+	status := models.MQTTBrokerStatus{Host: m.Host, Connected: connected, Streams: make([]models.MQTTStreamStatus, len(m.Streams))}
+	for i, s := range m.Streams {
+		st := m.status[i]
+		st.mutex.RLock()
+		status.Streams[i] = models.MQTTStreamStatus{
+			IncomingTopic: s.IncomingTopic,
+			OutgoingTopic: s.OutgoingTopic,
+			Subscribed:    connected && st.session == session,
+			Messages:      st.messages,
+		}
+
+		if !st.lastMessage.IsZero() {
+			lastMessage := st.lastMessage
+			status.Streams[i].LastMessage = &lastMessage
+		}
+		st.mutex.RUnlock()
+	}
+
+	return status
+}
+
+// Ingest handles a message that is received by other means than MQTT, for instance pushed over HTTP, as if it
+// was received on the given topic. False is returned when none of the streams subscribes to the topic and
+// ErrClientStopped when stop has begun
+func (m *MqttSubClient) Ingest(ctx context.Context, topic string, payload []byte) (bool, error) {
+	if !m.handlers.add() {
+		return false, ErrClientStopped
+	}
+	defer m.handlers.done()
+
+	matched := false
+	for idx, s := range m.Streams {
+		if models.TopicMatches(s.IncomingTopic, topic) {
+			matched = true
+			m.handleIncomingMessage(ctx, topic, payload, idx)
 		}
 	}
+
+	return matched, nil
 }
 
-// handleIncomingMessage handles an incoming message by converting the payload into a message thet can be used in a
-// SensorThings server and sending it over the PublishChannel to the publish client
-func (m *MqttSubClient) handleIncomingMessage(topic string, payload []byte, mapping map[string]models.ToValue, outgoingTopic string) {
+// handleIncomingMessage handles an incoming message for the stream with the given index by converting the payload into
+// a message thet can be used in a SensorThings server and sending it over the PublishChannel to the publish client, the
+// incoming payload and the published message are sent to the live feed. Sending is cancelled when the given context is done.
+// A payload that is not a JSON object or has a phenomenonTime that is not a string is counted as a mapping error
+func (m *MqttSubClient) handleIncomingMessage(ctx context.Context, topic string, payload []byte, stream int) {
+	st := m.status[stream]
+	st.mutex.Lock()
+	st.messages++
+	st.lastMessage = time.Now()
+	st.mutex.Unlock()
+
+	mapping, outgoingTopic := m.Streams[stream].Mapping, m.Streams[stream].OutgoingTopic
+	m.Metrics.MessageReceived()
+	m.Live.SendRaw(topic, payload)
 	if len(mapping) == 0 {
 		return
 	}
@@ -52,6 +221,7 @@ func (m *MqttSubClient) handleIncomingMessage(topic string, payload []byte, mapp
 	var msg map[string]interface{}
 	err := json.Unmarshal(payload, &msg)
 	if err != nil {
+		m.mappingError(fmt.Errorf("Message on %s is not a JSON object: %v", topic, err))
 		return
 	}
 
@@ -62,24 +232,40 @@ func (m *MqttSubClient) handleIncomingMessage(topic string, payload []byte, mapp
 			switch v.Name {
 			case "result":
 				{
-					if v.ToFloat {
-						iValue, err := strconv.ParseFloat(incVal.(string), 64)
-						if err == nil {
+					o.Result = incVal
+					if s, isString := incVal.(string); isString && v.ToFloat {
+						if iValue, err := strconv.ParseFloat(s, 64); err == nil {
 							o.Result = iValue
-						} else {
-							o.Result = incVal
 						}
-					} else {
-						o.Result = incVal
 					}
 				}
 			case "phenomenonTime":
 				{
-					o.PhenomenonTime = incVal.(string)
+					phenomenonTime, isString := incVal.(string)
+					if !isString {
+						m.mappingError(fmt.Errorf("Field %s of message on %s is not a string", k, topic))
+						return
+					}
+
+					o.PhenomenonTime = phenomenonTime
 				}
 			}
 		}
 	}
 
-	m.PublishChannel <- &models.PublishMessage{Topic: outgoingTopic, Observation: o}
+	pm := &models.PublishMessage{Topic: outgoingTopic, Observation: o, Metrics: m.Metrics}
+	m.Metrics.Queued(1)
+	defer m.Metrics.Queued(-1)
+
+	select {
+	case m.PublishChannel <- pm:
+		m.Live.SendObservation(pm)
+	case <-ctx.Done():
+	}
+}
+
+// mappingError logs and records a message that could not be mapped to an observation
+func (m *MqttSubClient) mappingError(err error) {
+	m.Logger.Warnf("%v", err)
+	m.Metrics.MappingError(err)
 }
@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tebben/sensorthings-connector/src/connector/auth"
+	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// defaultAuditLimit is the maximum number of audit events returned when no limit is given
+const defaultAuditLimit = 100
+
+// HandleGetAudit retrieves the audit events, newest first. The events can be filtered using the query
+// parameters connector, identity, action, since and until (RFC 3339), limit sets the maximum number of events
+func HandleGetAudit(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	query, err := parseAuditQuery(r)
+	if err != nil {
+		sendError(w, connectorErrors.NewBadRequestError(err))
+		return
+	}
+
+	handle := func() (interface{}, error) { return system.GetAuditEvents(query) }
+	HandleGetCollectionRequest(w, r, &handle)
+}
+
+// parseAuditQuery creates an audit query from the query parameters of a request
+func parseAuditQuery(r *http.Request) (*models.AuditQuery, error) {
+	values := r.URL.Query()
+	query := &models.AuditQuery{
+		ConnectorID: values.Get("connector"),
+		Identity:    values.Get("identity"),
+		Action:      models.AuditAction(values.Get("action")),
+		Limit:       defaultAuditLimit,
+	}
+
+	var err error
+	if v := values.Get("since"); len(v) > 0 {
+		if query.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, errors.New("since is not a valid RFC 3339 time")
+		}
+	}
+
+	if v := values.Get("until"); len(v) > 0 {
+		if query.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, errors.New("until is not a valid RFC 3339 time")
+		}
+	}
+
+	if v := values.Get("limit"); len(v) > 0 {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit < 1 {
+			return nil, errors.New("limit should be a positive number")
+		}
+	}
+
+	return query, nil
+}
+
+// auditContext returns the context of a request holding the actor recorded in the audit log for changes
+// made by the request, the identity is only known when authentication is enabled and is recorded as
+// {method}:{name} so identities with the same name authenticated with another method can be told apart
+func auditContext(r *http.Request) context.Context {
+	actor := &models.AuditActor{RemoteAddress: r.RemoteAddr}
+	if identity := auth.GetIdentity(r); identity != nil {
+		actor.Identity = identity.Method + ":" + identity.Name
+	}
+
+	return models.WithAuditActor(r.Context(), actor)
+}
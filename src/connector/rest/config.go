@@ -1,6 +1,11 @@
 package rest
 
-import "github.com/tebben/sensorthings-connector/src/connector/models"
+import (
+	"net/http"
+
+	"github.com/tebben/sensorthings-connector/src/connector/logging"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
 
 // CreateEndPoints creates the pre-defined endpoint config, the config contains all endpoint info
 func CreateEndPoints() []models.ConnectorEndpoint {
@@ -8,19 +13,132 @@ func CreateEndPoints() []models.ConnectorEndpoint {
 		&Endpoint{
 			Name: "Modules",
 			Operations: []models.EndpointOperation{
-				{models.HTTPOperationGet, "/Modules", HandleGetModules},
+				{OperationType: models.HTTPOperationGet, Path: "/Modules", Handler: HandleGetModules,
+					Permission: models.PermissionRead, Summary: "Get all modules", Response: []models.ConnectorModuleBase{}},
+				{OperationType: models.HTTPOperationPost, Path: "/Modules/:name/Test", Handler: HandleTestConnectorSettings,
+					Permission: models.PermissionOperate, Summary: "Test the settings of an unsaved connector", Request: models.ConnectorBase{}, Response: models.ConnectorTestResult{}},
 			},
 		},
 		&Endpoint{
 			Name: "Connectors",
 			Operations: []models.EndpointOperation{
-				{models.HTTPOperationGet, "/Connectors", HandleGetConnectors},
-				{models.HTTPOperationPost, "/Connectors", HandlePostConnector},
-				{models.HTTPOperationGet, "/Connectors/:id", HandleGetConnectorById},
-				{models.HTTPOperationPost, "/Connectors/:id/Start", HandleStartConnector},
-				{models.HTTPOperationPost, "/Connectors/:id/Stop", HandleStopConnector},
-				{models.HTTPOperationDelete, "/Connectors/:id", HandleDeleteConnector},
-				{models.HTTPOperationPatch, "/Connectors/:id", HandlePatchConnector},
+				{OperationType: models.HTTPOperationGet, Path: "/Connectors", Handler: HandleGetConnectors,
+					Permission: models.PermissionRead, Summary: "Get all connectors", Response: []models.ConnectorBase{}},
+				{OperationType: models.HTTPOperationPost, Path: "/Connectors", Handler: HandlePostConnector,
+					Permission: models.PermissionWrite, Summary: "Create a connector, or create one from a template using a TemplateInstance body",
+					Request: models.ConnectorBase{}, Response: models.ConnectorBase{}, Status: http.StatusCreated},
+				{OperationType: models.HTTPOperationGet, Path: "/Connectors/:id", Handler: HandleGetConnectorById,
+					Permission: models.PermissionRead, Summary: "Get a connector by id", Response: models.ConnectorBase{}},
+				{OperationType: models.HTTPOperationPost, Path: "/Connectors/:id/Start", Handler: HandleStartConnector,
+					Permission: models.PermissionOperate, Summary: "Start a connector"},
+				{OperationType: models.HTTPOperationPost, Path: "/Connectors/:id/Stop", Handler: HandleStopConnector,
+					Permission: models.PermissionOperate, Summary: "Stop a connector"},
+				{OperationType: models.HTTPOperationPost, Path: "/Connectors/:id/Test", Handler: HandleTestConnector,
+					Permission: models.PermissionOperate, Summary: "Test a connector without publishing", Response: models.ConnectorTestResult{}},
+				{OperationType: models.HTTPOperationGet, Path: "/Connectors/:id/Live", Handler: HandleGetLiveFeed,
+					Permission: models.PermissionRead, Summary: "Stream the messages of a connector as Server-Sent Events or over a WebSocket, " +
+						"query parameters: topic (MQTT wildcards allowed) and raw=true to include incoming payloads"},
+				{OperationType: models.HTTPOperationGet, Path: "/Connectors/:id/Status", Handler: HandleGetConnectorStatus,
+					Permission: models.PermissionRead, Summary: "Get the lifecycle state, statistics and module specific runtime information of a connector",
+					Response: models.ConnectorStatus{}},
+				{OperationType: models.HTTPOperationGet, Path: "/Connectors/:id/Logs", Handler: HandleGetConnectorLogs,
+					Permission: models.PermissionRead, Summary: "Get the recent log entries of a connector, query parameters: level, limit " +
+						"and follow=true to stream new entries as Server-Sent Events", Response: []logging.Entry{}},
+				{OperationType: models.HTTPOperationPost, Path: "/Connectors/:id/Clone", Handler: HandleCloneConnector,
+					Permission: models.PermissionWrite, Summary: "Copy a connector, the body is a JSON merge patch with overrides",
+					Request: map[string]interface{}{}, Response: models.ConnectorBase{}, Status: http.StatusCreated},
+				{OperationType: models.HTTPOperationDelete, Path: "/Connectors/:id", Handler: HandleDeleteConnector,
+					Permission: models.PermissionWrite, Summary: "Delete a connector"},
+				{OperationType: models.HTTPOperationPatch, Path: "/Connectors/:id", Handler: HandlePatchConnector,
+					Permission: models.PermissionWrite, Summary: "Update a connector using a JSON merge patch, If-Match is honoured",
+					Request: map[string]interface{}{}, Response: models.ConnectorBase{}},
+				{OperationType: models.HTTPOperationPut, Path: "/Connectors/:id", Handler: HandlePutConnector,
+					Permission: models.PermissionWrite, Summary: "Replace a connector, If-Match is honoured",
+					Request: models.ConnectorBase{}, Response: models.ConnectorBase{}},
+			},
+		},
+		&Endpoint{
+			Name: "Bulk",
+			Operations: []models.EndpointOperation{
+				{OperationType: models.HTTPOperationPost, Path: "/Bulk/Connectors/Start", Handler: HandleBulkStartConnectors,
+					Permission: models.PermissionOperate, Summary: "Start the connectors selected by ids or by module and labels, returns the result per connector",
+					Request: models.ConnectorSelector{}, Response: models.BulkResult{}},
+				{OperationType: models.HTTPOperationPost, Path: "/Bulk/Connectors/Stop", Handler: HandleBulkStopConnectors,
+					Permission: models.PermissionOperate, Summary: "Stop the connectors selected by ids or by module and labels, returns the result per connector",
+					Request: models.ConnectorSelector{}, Response: models.BulkResult{}},
+			},
+		},
+		&Endpoint{
+			Name: "Templates",
+			Operations: []models.EndpointOperation{
+				{OperationType: models.HTTPOperationGet, Path: "/Templates", Handler: HandleGetTemplates,
+					Permission: models.PermissionRead, Summary: "Get all connector templates", Response: []models.ConnectorTemplate{}},
+				{OperationType: models.HTTPOperationPost, Path: "/Templates", Handler: HandlePostTemplate,
+					Permission: models.PermissionWrite, Summary: "Create a connector template", Request: models.ConnectorTemplate{}, Response: models.ConnectorTemplate{}, Status: http.StatusCreated},
+				{OperationType: models.HTTPOperationGet, Path: "/Templates/:id", Handler: HandleGetTemplateById,
+					Permission: models.PermissionRead, Summary: "Get a connector template by id", Response: models.ConnectorTemplate{}},
+				{OperationType: models.HTTPOperationDelete, Path: "/Templates/:id", Handler: HandleDeleteTemplate,
+					Permission: models.PermissionWrite, Summary: "Delete a connector template"},
+			},
+		},
+		&Endpoint{
+			Name: "Configuration",
+			Operations: []models.EndpointOperation{
+				{OperationType: models.HTTPOperationGet, Path: "/Export", Handler: HandleGetExport,
+					Permission: models.PermissionRead, Summary: "Export all connectors and templates with redacted secrets, query parameters: format=yaml and " +
+						"redact=false to include the secrets (admin permission)",
+					Response: models.ConfigBundle{}},
+				{OperationType: models.HTTPOperationPost, Path: "/Import", Handler: HandlePostImport,
+					Permission: models.PermissionWrite, Summary: "Import an exported bundle, query parameters: mode=merge|replace, dryRun=true and format=yaml",
+					Request: models.ConfigBundle{}, Response: models.ImportResult{}},
+			},
+		},
+		&Endpoint{
+			Name: "Roles",
+			Operations: []models.EndpointOperation{
+				{OperationType: models.HTTPOperationGet, Path: "/Roles", Handler: HandleGetRoleAssignments,
+					Permission: models.PermissionAdmin, Summary: "Get all role assignments", Response: []models.RoleAssignment{}},
+				{OperationType: models.HTTPOperationPost, Path: "/Roles", Handler: HandlePostRoleAssignment,
+					Permission: models.PermissionAdmin, Summary: "Assign a role to an identity, replaces the current assignment",
+					Request: models.RoleAssignment{}, Response: models.RoleAssignment{}, Status: http.StatusCreated},
+				{OperationType: models.HTTPOperationGet, Path: "/Roles/:method/:identity", Handler: HandleGetRoleAssignment,
+					Permission: models.PermissionAdmin, Summary: "Get the role assignment of an identity authenticated with a method", Response: models.RoleAssignment{}},
+				{OperationType: models.HTTPOperationDelete, Path: "/Roles/:method/:identity", Handler: HandleDeleteRoleAssignment,
+					Permission: models.PermissionAdmin, Summary: "Delete the role assignment of an identity authenticated with a method"},
+			},
+		},
+		&Endpoint{
+			Name: "Audit",
+			Operations: []models.EndpointOperation{
+				{OperationType: models.HTTPOperationGet, Path: "/Audit", Handler: HandleGetAudit,
+					Permission: models.PermissionAdmin, Summary: "Get the audit log of connector changes newest first, query parameters: connector, identity, action, since, until and limit",
+					Response: []models.AuditEvent{}},
+			},
+		},
+		&Endpoint{
+			Name: "Health",
+			Operations: []models.EndpointOperation{
+				{OperationType: models.HTTPOperationGet, Path: "/health", Handler: HandleGetHealth,
+					Summary: "Check if the connector is up, does not require authentication"},
+				{OperationType: models.HTTPOperationGet, Path: "/health/live", Handler: HandleGetHealth,
+					Summary: "Liveness check, the connector is up when it responds, does not require authentication"},
+				{OperationType: models.HTTPOperationGet, Path: "/health/ready", Handler: HandleGetReadiness,
+					Summary: "Readiness check of the database, publish broker and running connectors, 503 when degraded, " +
+						"does not require authentication, the checks are only returned to callers with the read permission", Response: models.Readiness{}},
+			},
+		},
+		&Endpoint{
+			Name: "Metrics",
+			Operations: []models.EndpointOperation{
+				{OperationType: models.HTTPOperationGet, Path: "/metrics", Handler: HandleGetMetrics,
+					Permission: models.PermissionRead, Summary: "Get the metrics of all connectors in the Prometheus text format"},
+			},
+		},
+		&Endpoint{
+			Name: "OpenAPI",
+			Operations: []models.EndpointOperation{
+				{OperationType: models.HTTPOperationGet, Path: "/openapi.json", Handler: HandleGetOpenAPI,
+					Permission: models.PermissionRead, Summary: "Get the OpenAPI document of this API"},
 			},
 		},
 	}
@@ -0,0 +1,46 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// connectorETag returns the ETag of a connector which is based on its revision
+func connectorETag(c models.Connector) string {
+	return strconv.Quote(strconv.FormatInt(c.GetRevision(), 10))
+}
+
+// ifMatchRevision returns the revision of a connector when the If-Match header of the request matches
+// its ETag, 0 is returned when the header is missing or *. A HTTP PreconditionFailed is returned when
+// none of the given ETags match
+func ifMatchRevision(r *http.Request, system models.System, id string) (int64, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if len(ifMatch) == 0 || ifMatch == "*" {
+		return 0, nil
+	}
+
+	con, err := system.GetConnector(id)
+	if err != nil {
+		return 0, err
+	}
+
+	etag := connectorETag(con)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(tag) == etag {
+			return con.GetRevision(), nil
+		}
+	}
+
+	return 0, connectorErrors.NewPreconditionFailedError(fmt.Errorf("Connector %s has been changed, the current ETag is %s", id, etag))
+}
+
+// sendConnector sends a connector with redacted secrets using sendJSONResponse with its ETag
+func sendConnector(w http.ResponseWriter, status int, system models.System, con models.Connector) {
+	w.Header().Set("ETag", connectorETag(con))
+	sendJSONResponse(w, status, system.RedactConnector(con))
+}
@@ -0,0 +1,135 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tebben/sensorthings-connector/src/connector/auth"
+	"github.com/tebben/sensorthings-connector/src/connector/config"
+	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+	"gopkg.in/yaml.v2"
+)
+
+// HandleGetExport returns all connectors and templates as a bundle, the bundle is written as YAML when
+// format=yaml is given or YAML is accepted. Secrets in the settings are redacted, redact=false exports
+// the secrets and requires the admin permission
+func HandleGetExport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	redact := true
+	if len(r.URL.Query().Get("redact")) > 0 {
+		var err error
+		if redact, err = boolParameter(r, "redact"); err != nil {
+			sendError(w, err)
+			return
+		}
+	}
+
+	if !redact && !auth.HasPermission(r, models.PermissionAdmin) {
+		sendError(w, connectorErrors.NewErrorWithStatusCode(errors.New("Exporting secrets requires the admin permission"), http.StatusForbidden))
+		return
+	}
+
+	bundle, err := system.Export(redact)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	if !isYAML(r.URL.Query().Get("format"), r.Header.Get("Accept")) {
+		sendJSONResponse(w, http.StatusOK, bundle)
+		return
+	}
+
+	b, err := toYAML(bundle)
+	if err != nil {
+		sendError(w, connectorErrors.NewRequestInternalServerError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// HandlePostImport imports a bundle created by an export, mode=replace deletes connectors and templates that are not
+// in the bundle, the default mode is merge. When dryRun=true only the changes that would be made are returned
+func HandlePostImport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	mode := r.URL.Query().Get("mode")
+	if len(mode) > 0 && mode != "merge" && mode != "replace" {
+		sendError(w, connectorErrors.NewBadRequestError(fmt.Errorf("Unknown import mode %s, use merge or replace", mode)))
+		return
+	}
+
+	dryRun, err := boolParameter(r, "dryRun")
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	byteData, _ := ioutil.ReadAll(r.Body)
+	if isYAML(r.URL.Query().Get("format"), r.Header.Get("Content-Type")) {
+		if byteData, err = config.YAMLToJSON(byteData); err != nil {
+			sendError(w, connectorErrors.NewBadRequestError(errors.New("Unable to parse bundle")))
+			return
+		}
+	}
+
+	bundle := &models.ConfigBundle{}
+	if err := json.Unmarshal(byteData, bundle); err != nil {
+		sendError(w, connectorErrors.NewBadRequestError(errors.New("Unable to parse bundle")))
+		return
+	}
+
+	if result, err := system.Import(auditContext(r), bundle, mode == "replace", dryRun); err != nil {
+		sendError(w, err)
+	} else {
+		sendJSONResponse(w, http.StatusOK, result)
+	}
+}
+
+// boolParameter reads an optional boolean query parameter
+func boolParameter(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if len(value) == 0 {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, connectorErrors.NewBadRequestError(fmt.Errorf("Invalid value for %s", name))
+	}
+
+	return b, nil
+}
+
+// isYAML checks if YAML is requested by the format parameter or a media type
+func isYAML(format string, mediaType string) bool {
+	if len(format) > 0 {
+		return strings.EqualFold(format, "yaml")
+	}
+
+	return strings.Contains(mediaType, "yaml")
+}
+
+// toYAML writes a value as YAML using its JSON representation so the JSON field names are used
+func toYAML(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(doc)
+}
@@ -0,0 +1,375 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// filterNodeType is the type of a node in a parsed $filter expression
+type filterNodeType int
+
+const (
+	filterLiteral filterNodeType = iota
+	filterProperty
+	filterFunction
+	filterNot
+	filterAnd
+	filterOr
+	filterComparison
+)
+
+// filterNode is a node in a parsed $filter expression, for instance
+// module eq 'MQTT' and (running eq true or substringof('test', name))
+type filterNode struct {
+	nodeType filterNodeType
+	value    interface{}   // value of a literal
+	path     []string      // property path, for instance labels/site
+	name     string        // name of a function or comparison operator
+	args     []*filterNode // arguments of a function or operands of an operator
+}
+
+// filterFunctions holds the supported functions and their number of arguments
+var filterFunctions = map[string]int{
+	"substringof": 2,
+	"contains":    2,
+	"startswith":  2,
+	"endswith":    2,
+	"tolower":     1,
+	"toupper":     1,
+	"trim":        1,
+	"length":      1,
+}
+
+var filterComparisons = map[string]bool{"eq": true, "ne": true, "gt": true, "ge": true, "lt": true, "le": true}
+
+type filterToken struct {
+	text    string
+	literal interface{}
+	isLit   bool
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// parseFilter parses a $filter expression
+func parseFilter(filter string) (*filterNode, error) {
+	tokens, err := tokenizeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+
+	return node, nil
+}
+
+// tokenizeFilter splits a filter in string, number and keyword literals, names and punctuation
+func tokenizeFilter(filter string) ([]filterToken, error) {
+	tokens := make([]filterToken, 0)
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, filterToken{text: string(r)})
+			i++
+		case r == '\'':
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, errors.New("unterminated string")
+				}
+
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						sb.WriteRune('\'')
+						i += 2
+						continue
+					}
+
+					i++
+					break
+				}
+
+				sb.WriteRune(runes[i])
+				i++
+			}
+
+			tokens = append(tokens, filterToken{text: sb.String(), literal: sb.String(), isLit: true})
+		case r == '-' || unicode.IsDigit(r):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+
+			text := string(runes[start:i])
+			f, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", text)
+			}
+
+			tokens = append(tokens, filterToken{text: text, literal: f, isLit: true})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || strings.ContainsRune("_/.-", runes[i])) {
+				i++
+			}
+
+			text := string(runes[start:i])
+			switch text {
+			case "true":
+				tokens = append(tokens, filterToken{text: text, literal: true, isLit: true})
+			case "false":
+				tokens = append(tokens, filterToken{text: text, literal: false, isLit: true})
+			case "null":
+				tokens = append(tokens, filterToken{text: text, literal: nil, isLit: true})
+			default:
+				tokens = append(tokens, filterToken{text: text})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+
+	return tokens, nil
+}
+
+func (p *filterParser) peek() *filterToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+
+	return nil
+}
+
+// accept consumes the next token when it is the given keyword or punctuation
+func (p *filterParser) accept(text string) bool {
+	if t := p.peek(); t != nil && !t.isLit && strings.EqualFold(t.text, text) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected %q", text)
+	}
+
+	return nil
+}
+
+func (p *filterParser) parseOr() (*filterNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("or") {
+		var right *filterNode
+		if right, err = p.parseAnd(); err == nil {
+			left = &filterNode{nodeType: filterOr, args: []*filterNode{left, right}}
+		}
+	}
+
+	return left, err
+}
+
+func (p *filterParser) parseAnd() (*filterNode, error) {
+	left, err := p.parseNot()
+	for err == nil && p.accept("and") {
+		var right *filterNode
+		if right, err = p.parseNot(); err == nil {
+			left = &filterNode{nodeType: filterAnd, args: []*filterNode{left, right}}
+		}
+	}
+
+	return left, err
+}
+
+func (p *filterParser) parseNot() (*filterNode, error) {
+	if p.accept("not") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return &filterNode{nodeType: filterNot, args: []*filterNode{operand}}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (*filterNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t != nil && !t.isLit && filterComparisons[strings.ToLower(t.text)] {
+		p.pos++
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &filterNode{nodeType: filterComparison, name: strings.ToLower(t.text), args: []*filterNode{left, right}}, nil
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parsePrimary() (*filterNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, errors.New("unexpected end of filter")
+	}
+
+	p.pos++
+	if t.isLit {
+		return &filterNode{nodeType: filterLiteral, value: t.literal}, nil
+	}
+
+	if t.text == "(" {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		return node, p.expect(")")
+	}
+
+	if t.text == ")" || t.text == "," {
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+
+	name := strings.ToLower(t.text)
+	if argCount, ok := filterFunctions[name]; ok && p.accept("(") {
+		node := &filterNode{nodeType: filterFunction, name: name}
+		for i := 0; i < argCount; i++ {
+			if i > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+
+			node.args = append(node.args, arg)
+		}
+
+		return node, p.expect(")")
+	}
+
+	return &filterNode{nodeType: filterProperty, path: strings.Split(t.text, "/")}, nil
+}
+
+// evaluate evaluates the expression against a decoded JSON document
+func (n *filterNode) evaluate(doc interface{}) (interface{}, error) {
+	switch n.nodeType {
+	case filterLiteral:
+		return n.value, nil
+	case filterProperty:
+		return lookupPath(doc, n.path), nil
+	}
+
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.evaluate(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		args[i] = v
+	}
+
+	switch n.nodeType {
+	case filterNot:
+		return !isTrue(args[0]), nil
+	case filterAnd:
+		return isTrue(args[0]) && isTrue(args[1]), nil
+	case filterOr:
+		return isTrue(args[0]) || isTrue(args[1]), nil
+	case filterComparison:
+		return compare(n.name, args[0], args[1]), nil
+	}
+
+	return callFunction(n.name, args)
+}
+
+func isTrue(v interface{}) bool {
+	b, ok := v.(bool)
+	return ok && b
+}
+
+// compare applies a comparison operator, values of different types are only unequal
+func compare(op string, a, b interface{}) bool {
+	sameType := typeRank(a) == typeRank(b) && typeRank(a) < 4
+	c := compareValues(a, b)
+	switch op {
+	case "eq":
+		return sameType && c == 0
+	case "ne":
+		return !sameType || c != 0
+	case "gt":
+		return sameType && c > 0
+	case "ge":
+		return sameType && c >= 0
+	case "lt":
+		return sameType && c < 0
+	case "le":
+		return sameType && c <= 0
+	}
+
+	return false
+}
+
+func callFunction(name string, args []interface{}) (interface{}, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(string)
+		if !ok && arg != nil {
+			return nil, fmt.Errorf("%s expects string arguments", name)
+		}
+
+		strs[i] = s
+	}
+
+	switch name {
+	case "substringof":
+		return strings.Contains(strs[1], strs[0]), nil
+	case "contains":
+		return strings.Contains(strs[0], strs[1]), nil
+	case "startswith":
+		return strings.HasPrefix(strs[0], strs[1]), nil
+	case "endswith":
+		return strings.HasSuffix(strs[0], strs[1]), nil
+	case "tolower":
+		return strings.ToLower(strs[0]), nil
+	case "toupper":
+		return strings.ToUpper(strs[0]), nil
+	case "trim":
+		return strings.TrimSpace(strs[0]), nil
+	case "length":
+		return float64(len([]rune(strs[0]))), nil
+	}
+
+	return nil, fmt.Errorf("unknown function %s", name)
+}
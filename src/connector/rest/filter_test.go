@@ -0,0 +1,268 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+var testConnector = map[string]interface{}{
+	"id":      "1",
+	"name":    "Test O'Brien",
+	"module":  "MQTT",
+	"running": true,
+	"retries": 3.0,
+	"labels":  map[string]interface{}{"site": "Enschede"},
+	"missing": nil,
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		filter   string
+		expected bool
+	}{
+		{"module eq 'MQTT'", true},
+		{"module ne 'MQTT'", false},
+		{"MODULE EQ 'MQTT'", false},
+		{"module EQ 'MQTT'", true},
+		{"running eq true", true},
+		{"running", true},
+		{"retries gt 2", true},
+		{"retries ge 3", true},
+		{"retries lt 3", false},
+		{"retries le -1", false},
+		{"retries eq 3.0", true},
+		{"labels/site eq 'Enschede'", true},
+		{"labels/unknown eq null", true},
+		{"missing eq null", true},
+		{"unknown/path eq null", true},
+		// values of different types are only unequal
+		{"retries eq '3'", false},
+		{"retries ne '3'", true},
+		{"retries gt '1'", false},
+		{"running eq 'true'", false},
+		// a quote in a string is escaped with a second quote
+		{"name eq 'Test O''Brien'", true},
+		{"name eq 'Test O'''", false},
+		{"endswith(name, '''Brien')", true},
+		{"name eq ''", false},
+		// functions
+		{"substringof('O''B', name)", true},
+		{"contains(name, 'O''B')", true},
+		{"startswith(name, 'Test')", true},
+		{"startswith(name, 'test')", false},
+		{"tolower(module) eq 'mqtt'", true},
+		{"toupper(labels/site) eq 'ENSCHEDE'", true},
+		{"trim('  x ') eq 'x'", true},
+		{"length(name) eq 12", true},
+		{"contains(missing, 'x')", false},
+		// and binds stronger than or, not applies to the comparison that follows
+		{"module eq 'MQTT' or running eq false and retries eq 0", true},
+		{"(module eq 'MQTT' or running eq false) and retries eq 0", false},
+		{"module eq 'HTTP' and running eq true or retries eq 3", true},
+		{"module eq 'HTTP' and (running eq true or retries eq 3)", false},
+		{"not module eq 'HTTP'", true},
+		{"not not running", true},
+		{"not running or retries eq 3", true},
+		{"not (running or retries eq 3)", false},
+		{"((module eq 'MQTT'))", true},
+	}
+
+	for _, test := range tests {
+		node, err := parseFilter(test.filter)
+		if err != nil {
+			t.Errorf("parseFilter(%q) returned error: %v", test.filter, err)
+			continue
+		}
+
+		result, err := node.evaluate(testConnector)
+		if err != nil {
+			t.Errorf("evaluate(%q) returned error: %v", test.filter, err)
+			continue
+		}
+
+		if isTrue(result) != test.expected {
+			t.Errorf("evaluate(%q) = %v, expected %v", test.filter, result, test.expected)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	filters := []string{
+		"",
+		"module eq",
+		"eq 'MQTT'",
+		"module eq 'MQTT",
+		"module eq 'MQTT''",
+		"(module eq 'MQTT'",
+		"module eq 'MQTT')",
+		"module eq 'MQTT' and",
+		"or running",
+		"not",
+		"module eq 'MQTT' running",
+		"module = 'MQTT'",
+		"module eq \"MQTT\"",
+		"retries eq 1.2.3",
+		"retries eq -",
+		"startswith(name)",
+		"startswith(name, 'a', 'b')",
+		"startswith(name 'a')",
+		"tolower()",
+		"length(name,)",
+		",",
+	}
+
+	for _, filter := range filters {
+		if _, err := parseFilter(filter); err == nil {
+			t.Errorf("parseFilter(%q) should return an error", filter)
+		}
+	}
+}
+
+func TestFilterFunctionArguments(t *testing.T) {
+	node, err := parseFilter("startswith(retries, '3')")
+	if err != nil {
+		t.Fatalf("parseFilter returned error: %v", err)
+	}
+
+	if _, err := node.evaluate(testConnector); err == nil {
+		t.Error("a function with a number argument should return an error")
+	}
+}
+
+func TestParseQueryOptions(t *testing.T) {
+	valid := []string{
+		"/Connectors",
+		"/Connectors?id=1",
+		"/Connectors?$filter=module%20eq%20'MQTT'&$orderby=name%20desc,id&$top=2&$skip=1&$count=true",
+		"/Connectors?$orderby=name%20ASC",
+		"/Connectors?$top=0",
+	}
+
+	for _, u := range valid {
+		if _, err := ParseQueryOptions(httptest.NewRequest("GET", u, nil)); err != nil {
+			t.Errorf("ParseQueryOptions(%q) returned error: %v", u, err)
+		}
+	}
+
+	invalid := []string{
+		"/Connectors?$filter=module%20eq",
+		"/Connectors?$orderby=name%20down",
+		"/Connectors?$orderby=name%20asc%20desc",
+		"/Connectors?$orderby=name,,id",
+		"/Connectors?$top=-1",
+		"/Connectors?$top=a",
+		"/Connectors?$skip=-1",
+		"/Connectors?$count=maybe",
+		"/Connectors?$expand=Module",
+	}
+
+	for _, u := range invalid {
+		if _, err := ParseQueryOptions(httptest.NewRequest("GET", u, nil)); err == nil {
+			t.Errorf("ParseQueryOptions(%q) should return an error", u)
+		}
+	}
+
+	if options, _ := ParseQueryOptions(httptest.NewRequest("GET", "/Connectors?id=1", nil)); options != nil {
+		t.Error("a query without query options should not return options")
+	}
+}
+
+func TestApplyQueryOptions(t *testing.T) {
+	items := []map[string]interface{}{
+		{"id": "a", "module": "MQTT", "order": 2.0},
+		{"id": "b", "module": "HTTP", "order": 1.0},
+		{"id": "c", "module": "MQTT", "order": 3.0},
+		{"id": "d", "module": "MQTT"},
+		{"id": "e", "module": "HTTP", "order": 1.0},
+	}
+
+	tests := []struct {
+		url      string
+		expected []string
+		count    int
+		nextLink string
+	}{
+		{"/Connectors?$count=true", []string{"a", "b", "c", "d", "e"}, 5, ""},
+		{"/Connectors?$filter=module%20eq%20'MQTT'&$count=true", []string{"a", "c", "d"}, 3, ""},
+		// items without the property come first, ties keep their order
+		{"/Connectors?$orderby=order", []string{"d", "b", "e", "a", "c"}, -1, ""},
+		{"/Connectors?$orderby=order%20desc", []string{"c", "a", "b", "e", "d"}, -1, ""},
+		{"/Connectors?$orderby=module,order%20desc", []string{"b", "e", "c", "a", "d"}, -1, ""},
+		{"/Connectors?$orderby=order,id%20desc", []string{"d", "e", "b", "a", "c"}, -1, ""},
+		// paging, the count is the number of items before paging
+		{"/Connectors?$top=2&$count=true", []string{"a", "b"}, 5, "http://example.com/Connectors?$count=true&$skip=2&$top=2"},
+		{"/Connectors?$top=2&$skip=2", []string{"c", "d"}, -1, "http://example.com/Connectors?$skip=4&$top=2"},
+		{"/Connectors?$top=2&$skip=3", []string{"d", "e"}, -1, ""},
+		{"/Connectors?$skip=4", []string{"e"}, -1, ""},
+		{"/Connectors?$skip=10", []string{}, -1, ""},
+		{"/Connectors?$top=0", []string{}, -1, "http://example.com/Connectors?$skip=0&$top=0"},
+		{"/Connectors?$filter=module%20eq%20'MQTT'&$orderby=id%20desc&$top=1&$skip=1",
+			[]string{"c"}, -1, "http://example.com/Connectors?$filter=module+eq+%27MQTT%27&$orderby=id+desc&$skip=2&$top=1"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.url, nil)
+		options, err := ParseQueryOptions(r)
+		if err != nil {
+			t.Fatalf("ParseQueryOptions(%q) returned error: %v", test.url, err)
+		}
+
+		response, err := options.Apply(r, items)
+		if err != nil {
+			t.Fatalf("Apply(%q) returned error: %v", test.url, err)
+		}
+
+		if ids := responseIDs(t, response); !equalStrings(ids, test.expected) {
+			t.Errorf("Apply(%q) = %v, expected %v", test.url, ids, test.expected)
+		}
+
+		if test.count < 0 && response.Count != nil {
+			t.Errorf("Apply(%q) should not return a count", test.url)
+		} else if test.count >= 0 && (response.Count == nil || *response.Count != test.count) {
+			t.Errorf("Apply(%q) count = %v, expected %d", test.url, response.Count, test.count)
+		}
+
+		if response.NextLink != test.nextLink {
+			t.Errorf("Apply(%q) next link = %q, expected %q", test.url, response.NextLink, test.nextLink)
+		}
+	}
+}
+
+func TestNextLinkScheme(t *testing.T) {
+	r := httptest.NewRequest("GET", "https://connector.local:8443/Templates?$top=1", nil)
+	if link := nextLink(r, 1); link != "https://connector.local:8443/Templates?$skip=1&$top=1" {
+		t.Errorf("nextLink = %q", link)
+	}
+}
+
+func responseIDs(t *testing.T, response *CollectionResponse) []string {
+	ids := make([]string, 0, len(response.Value))
+	for _, v := range response.Value {
+		item := struct {
+			ID string `json:"id"`
+		}{}
+
+		if err := json.Unmarshal(v.(json.RawMessage), &item); err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, item.ID)
+	}
+
+	return ids
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
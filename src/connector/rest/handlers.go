@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/tebben/sensorthings-connector/src/connector/auth"
 	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
 	"github.com/tebben/sensorthings-connector/src/connector/models"
 	"io/ioutil"
@@ -16,44 +17,129 @@ import (
 func HandleGetModules(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
 	connector := *s
 	handle := func() (interface{}, error) { return connector.GetModules() }
-	HandleGetRequest(w, r, &handle)
+	HandleGetCollectionRequest(w, r, &handle)
 }
 
-// HandleGetConnectors retrieves all configured connectors
+// HandleGetConnectors retrieves all configured connectors, secrets in the settings are redacted
 func HandleGetConnectors(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
-	connector := *s
-	handle := func() (interface{}, error) { return connector.GetConnectors() }
-	HandleGetRequest(w, r, &handle)
+	system := *s
+	handle := func() (interface{}, error) {
+		connectors, err := system.GetConnectors()
+		if err != nil {
+			return nil, err
+		}
+
+		redacted := make([]models.Connector, 0, len(connectors))
+		for _, c := range connectors {
+			redacted = append(redacted, system.RedactConnector(c))
+		}
+
+		return redacted, nil
+	}
+	HandleGetCollectionRequest(w, r, &handle)
 }
 
-// HandlePostConnector handles a new created connector
+// HandlePostConnector handles a new created connector, when the body contains a template the connector
+// is created from the template using the given variables
 func HandlePostConnector(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
 	system := *s
 	byteData, _ := ioutil.ReadAll(r.Body)
+	instance := &models.TemplateInstance{}
+	if err := json.Unmarshal(byteData, instance); err == nil && len(instance.Template) > 0 {
+		if con, err := system.CreateConnectorFromTemplate(auditContext(r), instance); err != nil {
+			sendError(w, err)
+		} else {
+			sendConnector(w, http.StatusCreated, system, con)
+		}
+		return
+	}
+
 	connector := &models.ConnectorBase{}
 	err := json.Unmarshal(byteData, connector)
 	if err != nil {
 		sendError(w, connectorErrors.NewBadRequestError(errors.New("Unable to parse connector")))
 	} else {
-		if con, err := system.CreateConnector(connector); err != nil {
+		if con, err := system.CreateConnector(auditContext(r), connector); err != nil {
 			sendError(w, connectorErrors.NewBadRequestError(err))
 		} else {
-			sendJSONResponse(w, http.StatusCreated, con)
+			sendConnector(w, http.StatusCreated, system, con)
+		}
+	}
+}
+
+// HandleCloneConnector creates a copy of a connector by id, the body can contain a JSON merge patch
+// with overrides for the copy
+func HandleCloneConnector(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	byteData, _ := ioutil.ReadAll(r.Body)
+	if con, err := system.CloneConnector(auditContext(r), ps.ByName("id"), byteData); err != nil {
+		sendError(w, err)
+	} else {
+		sendConnector(w, http.StatusCreated, system, con)
+	}
+}
+
+// HandleGetTemplates retrieves all connector templates
+func HandleGetTemplates(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	handle := func() (interface{}, error) { return system.GetTemplates() }
+	HandleGetCollectionRequest(w, r, &handle)
+}
+
+// HandleGetTemplateById retrieves a connector template by id
+func HandleGetTemplateById(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	handle := func() (interface{}, error) { return system.GetTemplate(ps.ByName("id")) }
+	HandleGetRequest(w, r, &handle)
+}
+
+// HandlePostTemplate handles a new created connector template
+func HandlePostTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	byteData, _ := ioutil.ReadAll(r.Body)
+	template := &models.ConnectorTemplate{}
+	err := json.Unmarshal(byteData, template)
+	if err != nil {
+		sendError(w, connectorErrors.NewBadRequestError(errors.New("Unable to parse template")))
+	} else {
+		if t, err := system.CreateTemplate(template); err != nil {
+			sendError(w, err)
+		} else {
+			sendJSONResponse(w, http.StatusCreated, t)
 		}
 	}
 }
 
-// HandleGetConnectorById retrieves a connector by id
+// HandleDeleteTemplate deletes a connector template by id
+func HandleDeleteTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	if err := system.DeleteTemplate(ps.ByName("id")); err != nil {
+		sendError(w, err)
+	} else {
+		sendJSONResponse(w, http.StatusOK, nil)
+	}
+}
+
+// HandleGetConnectorById retrieves a connector by id with redacted secrets, the ETag header holds the
+// revision of the connector
 func HandleGetConnectorById(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
 	system := *s
-	handle := func() (interface{}, error) { return system.GetConnector(ps.ByName("id")) }
+	handle := func() (interface{}, error) {
+		con, err := system.GetConnector(ps.ByName("id"))
+		if err != nil {
+			return nil, err
+		}
+
+		w.Header().Set("ETag", connectorETag(con))
+		return system.RedactConnector(con), nil
+	}
 	HandleGetRequest(w, r, &handle)
 }
 
 // HandleStartConnector start a connector by id
 func HandleStartConnector(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
 	system := *s
-	if err := system.SetConnectorState(ps.ByName("id"), true); err != nil {
+	if err := system.SetConnectorState(auditContext(r), ps.ByName("id"), true); err != nil {
 		sendError(w, err)
 	} else {
 		sendJSONResponse(w, http.StatusOK, nil)
@@ -64,25 +150,113 @@ func HandleStartConnector(w http.ResponseWriter, r *http.Request, ps httprouter.
 func HandleStopConnector(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
 	system := *s
 
-	if err := system.SetConnectorState(ps.ByName("id"), false); err != nil {
+	if err := system.SetConnectorState(auditContext(r), ps.ByName("id"), false); err != nil {
 		sendError(w, err)
 	} else {
 		sendJSONResponse(w, http.StatusOK, nil)
 	}
 }
 
+// HandleBulkStartConnectors starts the connectors selected by the selector in the body
+func HandleBulkStartConnectors(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	handleBulkConnectorState(w, r, s, true)
+}
+
+// HandleBulkStopConnectors stops the connectors selected by the selector in the body
+func HandleBulkStopConnectors(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	handleBulkConnectorState(w, r, s, false)
+}
+
+// handleBulkConnectorState sets the running state of the selected connectors, the response holds the
+// result per connector and is sent with status 200 also when the state of some connectors could not be set
+func handleBulkConnectorState(w http.ResponseWriter, r *http.Request, s *models.System, running bool) {
+	system := *s
+	byteData, _ := ioutil.ReadAll(r.Body)
+	selector := &models.ConnectorSelector{}
+	if err := json.Unmarshal(byteData, selector); err != nil {
+		sendError(w, connectorErrors.NewBadRequestError(errors.New("Unable to parse connector selector")))
+		return
+	}
+
+	if result, err := system.SetConnectorsState(auditContext(r), selector, running); err != nil {
+		sendError(w, err)
+	} else {
+		sendJSONResponse(w, http.StatusOK, result)
+	}
+}
+
 // HandleDeleteConnector deletes a connector by id
 func HandleDeleteConnector(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
 	system := *s
-	if err := system.DeleteConnector(ps.ByName("id")); err != nil {
+	if err := system.DeleteConnector(auditContext(r), ps.ByName("id")); err != nil {
 		sendError(w, err)
 	} else {
 		sendJSONResponse(w, http.StatusOK, nil)
 	}
 }
 
-// HandlePatchConnector patches a connector by given id
+// HandlePatchConnector patches a connector by given id, the body is a JSON merge patch. When the If-Match
+// header is given the connector is only changed if the ETag still matches
 func HandlePatchConnector(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	revision, err := ifMatchRevision(r, system, ps.ByName("id"))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	byteData, _ := ioutil.ReadAll(r.Body)
+	if con, err := system.PatchConnector(auditContext(r), ps.ByName("id"), byteData, revision); err != nil {
+		sendError(w, err)
+	} else {
+		sendConnector(w, http.StatusOK, system, con)
+	}
+}
+
+// HandlePutConnector replaces a connector by given id, when the If-Match header is given the connector
+// is only replaced if the ETag still matches
+func HandlePutConnector(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	revision, err := ifMatchRevision(r, system, ps.ByName("id"))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	byteData, _ := ioutil.ReadAll(r.Body)
+	connector := &models.ConnectorBase{}
+	err = json.Unmarshal(byteData, connector)
+	if err != nil {
+		sendError(w, connectorErrors.NewBadRequestError(errors.New("Unable to parse connector")))
+	} else {
+		if con, err := system.ReplaceConnector(auditContext(r), ps.ByName("id"), connector, revision); err != nil {
+			sendError(w, err)
+		} else {
+			sendConnector(w, http.StatusOK, system, con)
+		}
+	}
+}
+
+// HandleTestConnector runs a connection test for an existing connector by id
+func HandleTestConnector(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	if result, err := system.TestConnector(ps.ByName("id")); err != nil {
+		sendError(w, err)
+	} else {
+		sendJSONResponse(w, http.StatusOK, result)
+	}
+}
+
+// HandleGetConnectorStatus retrieves the runtime status of a connector by id
+func HandleGetConnectorStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	handle := func() (interface{}, error) { return system.GetConnectorStatus(ps.ByName("id")) }
+	HandleGetRequest(w, r, &handle)
+}
+
+// HandleTestConnectorSettings runs a connection test for an unsaved connector posted in the body,
+// the module is taken from the path
+func HandleTestConnectorSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
 	system := *s
 	byteData, _ := ioutil.ReadAll(r.Body)
 	connector := &models.ConnectorBase{}
@@ -90,17 +264,97 @@ func HandlePatchConnector(w http.ResponseWriter, r *http.Request, ps httprouter.
 	if err != nil {
 		sendError(w, connectorErrors.NewBadRequestError(errors.New("Unable to parse connector")))
 	} else {
-		if con, err := system.PatchConnector(ps.ByName("id"), connector); err != nil {
+		connector.ModuleName = ps.ByName("name")
+		if result, err := system.TestConnectorSettings(connector); err != nil {
+			sendError(w, err)
+		} else {
+			sendJSONResponse(w, http.StatusOK, result)
+		}
+	}
+}
+
+// HandleGetRoleAssignments retrieves all role assignments
+func HandleGetRoleAssignments(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	handle := func() (interface{}, error) { return system.GetRoleAssignments() }
+	HandleGetCollectionRequest(w, r, &handle)
+}
+
+// HandleGetRoleAssignment retrieves the role assignment of an identity authenticated with a method
+func HandleGetRoleAssignment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	handle := func() (interface{}, error) { return system.GetRoleAssignment(ps.ByName("method"), ps.ByName("identity")) }
+	HandleGetRequest(w, r, &handle)
+}
+
+// HandlePostRoleAssignment assigns a role to an identity
+func HandlePostRoleAssignment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	byteData, _ := ioutil.ReadAll(r.Body)
+	assignment := &models.RoleAssignment{}
+	err := json.Unmarshal(byteData, assignment)
+	if err != nil {
+		sendError(w, connectorErrors.NewBadRequestError(errors.New("Unable to parse role assignment")))
+	} else {
+		if a, err := system.SetRoleAssignment(assignment); err != nil {
 			sendError(w, err)
 		} else {
-			sendJSONResponse(w, http.StatusOK, con)
+			sendJSONResponse(w, http.StatusCreated, a)
 		}
 	}
 }
 
+// HandleDeleteRoleAssignment removes the role assignment of an identity authenticated with a method
+func HandleDeleteRoleAssignment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	if err := system.DeleteRoleAssignment(ps.ByName("method"), ps.ByName("identity")); err != nil {
+		sendError(w, err)
+	} else {
+		sendJSONResponse(w, http.StatusOK, nil)
+	}
+}
+
+// HandleGetHealth reports that the connector is up, the endpoint is public by default
+func HandleGetHealth(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	handle := func() (interface{}, error) { return map[string]string{"status": "ok"}, nil }
+	HandleGetRequest(w, r, &handle)
+}
+
+// HandleGetReadiness reports if the connector is ready, the status is 503 Service Unavailable when the
+// connector is degraded. The endpoint is public by default, only callers with the read permission get
+// the outcome of every check
+func HandleGetReadiness(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	readiness := system.GetReadiness()
+	status := http.StatusOK
+	if readiness.Status != models.HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	if !auth.HasPermission(r, models.PermissionRead) {
+		sendJSONResponse(w, status, map[string]models.HealthStatus{"status": readiness.Status})
+		return
+	}
+
+	sendJSONResponse(w, status, readiness)
+}
+
+// HandleGetOpenAPI returns the OpenAPI document generated from all endpoints
+func HandleGetOpenAPI(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	handle := func() (interface{}, error) {
+		modules, err := system.GetModules()
+		if err != nil {
+			return nil, err
+		}
+
+		return CreateOpenAPI(system.GetEndpoints(), modules), nil
+	}
+	HandleGetRequest(w, r, &handle)
+}
+
 // handleGetRequest is the default function to handle incoming GET requests
 func HandleGetRequest(w http.ResponseWriter, r *http.Request, h *func() (interface{}, error)) {
-	w.Header().Add("Access-Control-Allow-Origin", "*")
 	handler := *h
 	if data, err := handler(); err != nil {
 		sendError(w, err)
@@ -109,6 +363,32 @@ func HandleGetRequest(w http.ResponseWriter, r *http.Request, h *func() (interfa
 	}
 }
 
+// HandleGetCollectionRequest handles a GET request on a collection, when the request contains query
+// options the collection is filtered, ordered and paged and returned as a CollectionResponse
+func HandleGetCollectionRequest(w http.ResponseWriter, r *http.Request, h *func() (interface{}, error)) {
+	options, err := ParseQueryOptions(r)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	if options == nil {
+		HandleGetRequest(w, r, h)
+		return
+	}
+
+	handle := func() (interface{}, error) {
+		handler := *h
+		data, err := handler()
+		if err != nil {
+			return nil, err
+		}
+
+		return options.Apply(r, data)
+	}
+	HandleGetRequest(w, r, &handle)
+}
+
 // sendJSONResponse sends the desired message to the user
 // the message will be marshalled into an indented JSON format
 func sendJSONResponse(w http.ResponseWriter, status int, data interface{}) {
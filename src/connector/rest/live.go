@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// liveKeepAlive is the interval in which a keep-alive is sent on an idle live stream
+const liveKeepAlive = 15 * time.Second
+
+var upgrader = websocket.Upgrader{}
+
+// HandleGetLiveFeed streams the messages of a connector as Server-Sent Events, when the request is a
+// WebSocket upgrade the messages are sent as WebSocket text messages instead. The query parameter topic
+// filters the messages on topic, MQTT wildcards can be used, raw=true adds the raw incoming payloads
+func HandleGetLiveFeed(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	feed, err := system.GetLiveFeed(ps.ByName("id"))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	raw := false
+	if value := r.URL.Query().Get("raw"); len(value) > 0 {
+		if raw, err = strconv.ParseBool(value); err != nil {
+			sendError(w, connectorErrors.NewBadRequestError(errors.New("Invalid value for raw")))
+			return
+		}
+	}
+
+	topic := r.URL.Query().Get("topic")
+	if websocket.IsWebSocketUpgrade(r) {
+		streamWebSocket(w, r, feed, topic, raw)
+	} else {
+		streamEvents(w, r, feed, topic, raw)
+	}
+}
+
+// streamEvents writes the messages of the feed as Server-Sent Events until the client disconnects
+// or the feed is closed, the event name is the type of the message
+func streamEvents(w http.ResponseWriter, r *http.Request, feed *models.LiveFeed, topic string, raw bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendError(w, connectorErrors.NewRequestInternalServerError(errors.New("Streaming is not supported")))
+		return
+	}
+
+	sub := feed.Subscribe(topic, raw)
+	defer feed.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case msg, ok := <-sub.Messages:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(msg)
+			if err != nil {
+				log.Printf("%v", err.Error())
+				continue
+			}
+
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data)
+		}
+
+		flusher.Flush()
+	}
+}
+
+// streamWebSocket upgrades the connection and sends the messages of the feed as JSON text messages
+// until the client closes the connection or the feed is closed
+func streamWebSocket(w http.ResponseWriter, r *http.Request, feed *models.LiveFeed, topic string, raw bool) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sub := feed.Subscribe(topic, raw)
+	defer feed.Unsubscribe(sub)
+
+	// Read and discard client messages so control messages are handled and a close is noticed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-keepAlive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveKeepAlive)); err != nil {
+				return
+			}
+		case msg, ok := <-sub.Messages:
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "connector deleted"))
+				return
+			}
+
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		}
+	}
+}
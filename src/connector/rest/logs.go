@@ -0,0 +1,113 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
+	"github.com/tebben/sensorthings-connector/src/connector/logging"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// HandleGetConnectorLogs retrieves the recent log entries of a connector, oldest first. The query parameter
+// level sets the minimum level of the entries and limit the maximum number of entries, follow=true streams
+// the entries as Server-Sent Events and keeps sending new entries until the client disconnects
+func HandleGetConnectorLogs(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	buffer, err := system.GetConnectorLogs(ps.ByName("id"))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	values := r.URL.Query()
+	minimum, err := logging.ParseLevel(values.Get("level"))
+	if err != nil {
+		sendError(w, connectorErrors.NewBadRequestError(err))
+		return
+	}
+
+	limit := 0
+	if v := values.Get("limit"); len(v) > 0 {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			sendError(w, connectorErrors.NewBadRequestError(errors.New("limit should be a positive number")))
+			return
+		}
+	}
+
+	follow := false
+	if v := values.Get("follow"); len(v) > 0 {
+		if follow, err = strconv.ParseBool(v); err != nil {
+			sendError(w, connectorErrors.NewBadRequestError(errors.New("Invalid value for follow")))
+			return
+		}
+	}
+
+	if follow {
+		streamLogs(w, r, buffer, minimum, limit)
+		return
+	}
+
+	handle := func() (interface{}, error) { return buffer.Entries(minimum, limit), nil }
+	HandleGetRequest(w, r, &handle)
+}
+
+// streamLogs writes the buffered entries followed by new entries as Server-Sent Events until the client
+// disconnects or the log is closed
+func streamLogs(w http.ResponseWriter, r *http.Request, buffer *logging.Buffer, minimum logging.Level, limit int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendError(w, connectorErrors.NewRequestInternalServerError(errors.New("Streaming is not supported")))
+		return
+	}
+
+	entries, sub := buffer.Subscribe(minimum, limit)
+	defer buffer.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	for _, e := range entries {
+		writeLogEvent(w, e)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-sub.Entries:
+			if !ok {
+				return
+			}
+
+			writeLogEvent(w, e)
+		}
+
+		flusher.Flush()
+	}
+}
+
+// writeLogEvent writes a log entry as a Server-Sent Event, the event name is the level of the entry
+func writeLogEvent(w http.ResponseWriter, e *logging.Entry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		return
+	}
+
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Level, data)
+}
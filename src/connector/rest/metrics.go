@@ -0,0 +1,19 @@
+package rest
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tebben/sensorthings-connector/src/connector/metrics"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// HandleGetMetrics writes the metrics of all connectors and MQTT clients in the Prometheus text format
+func HandleGetMetrics(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := metrics.DefaultRegistry.Write(w); err != nil {
+		log.Printf("Unable to write metrics: %v", err.Error())
+	}
+}
@@ -0,0 +1,215 @@
+package rest
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+const (
+	modulePrefix    = "/Modules/:name"
+	connectorPrefix = "/Connectors/:id"
+)
+
+// moduleOperation is an operation contributed by one or more modules
+type moduleOperation struct {
+	operation models.EndpointOperation
+	modules   []string
+}
+
+// CreateModuleEndPoints creates the endpoints for the operations of all modules implementing
+// models.ConnectorModuleEndpoints. Every operation is mounted once, requests are dispatched to the
+// module or connector given in the path. Operations that conflict with the given endpoints, or
+// with an operation of another module that requires a different permission, are skipped
+func CreateModuleEndPoints(modules []models.ConnectorModule, endpoints []models.ConnectorEndpoint) []models.ConnectorEndpoint {
+	mounted := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		for _, op := range endpoint.GetOperations() {
+			mounted[operationKey(op.OperationType, op.Path)] = true
+		}
+	}
+
+	moduleOps := make([]*moduleOperation, 0)
+	connectorOps := make([]*moduleOperation, 0)
+	for _, module := range modules {
+		provider, ok := module.(models.ConnectorModuleEndpoints)
+		if !ok {
+			continue
+		}
+
+		moduleOps = addModuleOperations(moduleOps, mounted, module.GetName(), modulePrefix, provider.GetModuleOperations())
+		connectorOps = addModuleOperations(connectorOps, mounted, module.GetName(), connectorPrefix, provider.GetConnectorOperations())
+	}
+
+	return []models.ConnectorEndpoint{
+		&Endpoint{Name: "Modules", Operations: createDispatchOperations(moduleOps, HandleModuleOperation)},
+		&Endpoint{Name: "Connectors", Operations: createDispatchOperations(connectorOps, HandleConnectorOperation)},
+	}
+}
+
+// HandleModuleOperation dispatches a request to the operation of the module given in the path
+func HandleModuleOperation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	name := ps.ByName("name")
+	modules, _ := system.GetModules()
+	for _, module := range modules {
+		if module.GetName() != name {
+			continue
+		}
+
+		if provider, ok := module.(models.ConnectorModuleEndpoints); ok {
+			if op := findOperation(provider.GetModuleOperations(), r, modulePrefix); op != nil {
+				op.Handler(w, r, ps, s)
+				return
+			}
+		}
+
+		sendError(w, connectorErrors.NewRequestNotFound(fmt.Errorf("Module %s does not provide %s", name, r.URL.Path)))
+		return
+	}
+
+	sendError(w, connectorErrors.NewRequestNotFound(fmt.Errorf("Module %s not found", name)))
+}
+
+// HandleConnectorOperation dispatches a request to the operation of the module instance of the
+// connector given in the path
+func HandleConnectorOperation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, s *models.System) {
+	system := *s
+	con, err := system.GetConnector(ps.ByName("id"))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	if provider, ok := con.GetModule().(models.ConnectorModuleEndpoints); ok {
+		if op := findOperation(provider.GetConnectorOperations(), r, connectorPrefix); op != nil {
+			op.Handler(w, r, ps, s)
+			return
+		}
+	}
+
+	sendError(w, connectorErrors.NewRequestNotFound(fmt.Errorf("Connector %s does not provide %s", con.GetID(), r.URL.Path)))
+}
+
+// SendJSONResponse can be used by the operations of modules to send a response in the same format
+// as the other endpoints
+func SendJSONResponse(w http.ResponseWriter, status int, data interface{}) {
+	sendJSONResponse(w, status, data)
+}
+
+// SendError can be used by the operations of modules to send an ErrorResponse, the status code is
+// taken from an errors.APIError and defaults to 500
+func SendError(w http.ResponseWriter, err error) {
+	sendError(w, err)
+}
+
+// addModuleOperations adds the operations of a module to the list of module operations
+func addModuleOperations(list []*moduleOperation, mounted map[string]bool, module string, prefix string, operations []models.EndpointOperation) []*moduleOperation {
+	for _, op := range operations {
+		if op.Handler == nil {
+			continue
+		}
+
+		if !strings.HasPrefix(op.Path, "/") || strings.HasPrefix(op.Path, "/:") || strings.HasPrefix(op.Path, "/*") {
+			log.Printf("Module %s: path %s of %s operation has to start with a static segment", module, op.Path, op.OperationType)
+			continue
+		}
+
+		path := prefix + op.Path
+		key := operationKey(op.OperationType, path)
+		if existing := findModuleOperation(list, key); existing != nil {
+			if existing.operation.Path != path {
+				log.Printf("Module %s: %s %s conflicts with %s of another module", module, op.OperationType, path, existing.operation.Path)
+				continue
+			}
+
+			if existing.operation.Permission != op.Permission {
+				log.Printf("Module %s: %s %s requires permission %s, another module requires %s", module, op.OperationType, path, op.Permission, existing.operation.Permission)
+				continue
+			}
+
+			existing.modules = append(existing.modules, module)
+			continue
+		}
+
+		if mounted[key] {
+			log.Printf("Module %s: %s %s conflicts with an existing endpoint", module, op.OperationType, path)
+			continue
+		}
+
+		op.Path = path
+		list = append(list, &moduleOperation{operation: op, modules: []string{module}})
+	}
+
+	return list
+}
+
+// createDispatchOperations creates the endpoint operations for a list of module operations which
+// are handled by the given dispatch handler
+func createDispatchOperations(list []*moduleOperation, dispatch models.HTTPHandler) []models.EndpointOperation {
+	operations := make([]models.EndpointOperation, 0, len(list))
+	for _, m := range list {
+		op := m.operation
+		op.Handler = dispatch
+		op.Summary = strings.TrimSpace(fmt.Sprintf("%s (module %s)", op.Summary, strings.Join(m.modules, ", ")))
+		operations = append(operations, op)
+	}
+
+	return operations
+}
+
+func findModuleOperation(list []*moduleOperation, key string) *moduleOperation {
+	for _, m := range list {
+		if operationKey(m.operation.OperationType, m.operation.Path) == key {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// findOperation searches the operation of a module matching the method and path of a request
+func findOperation(operations []models.EndpointOperation, r *http.Request, prefix string) *models.EndpointOperation {
+	for i, op := range operations {
+		if string(op.OperationType) == r.Method && op.Handler != nil && pathMatches(prefix+op.Path, r.URL.Path) {
+			return &operations[i]
+		}
+	}
+
+	return nil
+}
+
+// pathMatches checks if a request path matches a route path containing :param and *catchAll segments
+func pathMatches(route string, path string) bool {
+	routeParts := strings.Split(strings.Trim(route, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range routeParts {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+
+		if i >= len(pathParts) || (!strings.HasPrefix(part, ":") && part != pathParts[i]) {
+			return false
+		}
+	}
+
+	return len(routeParts) == len(pathParts)
+}
+
+// operationKey returns a key for an operation on a path, the names of parameters are left out because
+// the router does not accept different names for a parameter at the same position
+func operationKey(operation models.HTTPOperation, path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			parts[i] = part[:1]
+		}
+	}
+
+	return string(operation) + " " + strings.Join(parts, "/")
+}
@@ -0,0 +1,246 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+	"github.com/tebben/sensorthings-connector/src/connector/schema"
+)
+
+// OpenAPI is the root of an OpenAPI 3 document
+type OpenAPI struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+// OpenAPIInfo holds the title and version of the API
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIComponents holds the schemas that are referenced by the operations
+type OpenAPIComponents struct {
+	Schemas map[string]*schema.Schema `json:"schemas"`
+}
+
+// OpenAPIOperation describes a single operation on a path
+type OpenAPIOperation struct {
+	Tags        []string                    `json:"tags"`
+	Summary     string                      `json:"summary,omitempty"`
+	OperationID string                      `json:"operationId"`
+	Parameters  []OpenAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter describes a path or query parameter
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required"`
+	Schema      *schema.Schema `json:"schema"`
+}
+
+// OpenAPIRequestBody describes the body of a request
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse describes a response of an operation
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType holds the schema of a body
+type OpenAPIMediaType struct {
+	Schema *schema.Schema `json:"schema"`
+}
+
+// queryParameters are the query options supported on GET requests of collections
+var queryParameters = []OpenAPIParameter{
+	{Name: "$filter", In: "query", Description: "Filter expression, for instance module eq 'MQTT' and running eq true", Schema: &schema.Schema{Type: "string"}},
+	{Name: "$orderby", In: "query", Description: "Comma separated properties with optional asc or desc", Schema: &schema.Schema{Type: "string"}},
+	{Name: "$top", In: "query", Description: "Maximum number of items to return", Schema: &schema.Schema{Type: "integer"}},
+	{Name: "$skip", In: "query", Description: "Number of items to skip", Schema: &schema.Schema{Type: "integer"}},
+	{Name: "$count", In: "query", Description: "Add the total number of matching items as @iot.count", Schema: &schema.Schema{Type: "boolean"}},
+}
+
+// CreateOpenAPI generates an OpenAPI document from the given endpoints, the settings schemas of
+// modules implementing ConnectorModuleSettingsSchema are added as components named {module}Settings
+func CreateOpenAPI(endpoints []models.ConnectorEndpoint, modules []models.ConnectorModule) *OpenAPI {
+	doc := &OpenAPI{
+		OpenAPI:    "3.0.0",
+		Info:       OpenAPIInfo{Title: "SensorThings Connector", Version: "1.0"},
+		Paths:      make(map[string]map[string]*OpenAPIOperation),
+		Components: OpenAPIComponents{Schemas: make(map[string]*schema.Schema)},
+	}
+
+	doc.Components.Schemas["ErrorResponse"] = schema.Generate(models.ErrorResponse{})
+	addModuleSchemas(doc, modules)
+
+	for _, endpoint := range endpoints {
+		for _, op := range endpoint.GetOperations() {
+			if op.Handler == nil {
+				continue
+			}
+
+			path, params := openAPIPath(op.Path)
+			if _, ok := doc.Paths[path]; !ok {
+				doc.Paths[path] = make(map[string]*OpenAPIOperation)
+			}
+
+			doc.Paths[path][strings.ToLower(string(op.OperationType))] = createOperation(doc, endpoint.GetName(), op, params)
+		}
+	}
+
+	return doc
+}
+
+// addModuleSchemas adds the settings schema of every module to the components and
+// describes the settings of ConnectorBase as one of these schemas
+func addModuleSchemas(doc *OpenAPI, modules []models.ConnectorModule) {
+	connector := schema.Generate(models.ConnectorBase{})
+	settings := connector.Properties["settings"]
+	settings.Description = "Module specific settings"
+	connector.Properties["failure"] = schema.Generate(models.ModuleFailure{})
+	connector.Properties["nextRun"] = &schema.Schema{Type: "string", Format: "date-time"}
+
+	for _, m := range modules {
+		if s, ok := m.(models.ConnectorModuleSettingsSchema); ok && s.GetSettingsSchema() != nil {
+			name := componentName(m.GetName()) + "Settings"
+			doc.Components.Schemas[name] = s.GetSettingsSchema()
+			settings.OneOf = append(settings.OneOf, schema.Ref(name))
+		}
+	}
+
+	doc.Components.Schemas["ConnectorBase"] = connector
+}
+
+// createOperation creates the OpenAPI operation for an EndpointOperation
+func createOperation(doc *OpenAPI, tag string, op models.EndpointOperation, params []string) *OpenAPIOperation {
+	operation := &OpenAPIOperation{
+		Tags:        []string{tag},
+		Summary:     op.Summary,
+		OperationID: operationID(op),
+		Responses:   make(map[string]*OpenAPIResponse),
+	}
+
+	for _, p := range params {
+		operation.Parameters = append(operation.Parameters, OpenAPIParameter{
+			Name:     p,
+			In:       "path",
+			Required: true,
+			Schema:   &schema.Schema{Type: "string"},
+		})
+	}
+
+	if op.OperationType == models.HTTPOperationGet && op.Response != nil && schema.IsArray(op.Response) {
+		operation.Parameters = append(operation.Parameters, queryParameters...)
+	}
+
+	if op.Request != nil {
+		operation.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content:  jsonContent(bodySchema(doc, op.Request)),
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	response := &OpenAPIResponse{Description: http.StatusText(status)}
+	if op.Response != nil {
+		response.Content = jsonContent(bodySchema(doc, op.Response))
+	}
+
+	operation.Responses[fmt.Sprintf("%d", status)] = response
+	operation.Responses["default"] = &OpenAPIResponse{
+		Description: "Error",
+		Content:     jsonContent(schema.Ref("ErrorResponse")),
+	}
+
+	return operation
+}
+
+// bodySchema returns a reference to the component schema of the type of the given value, the
+// component is generated when it does not exist yet. Unnamed types are described inline
+func bodySchema(doc *OpenAPI, v interface{}) *schema.Schema {
+	name := schema.TypeName(v)
+	if len(name) == 0 {
+		return schema.Generate(v)
+	}
+
+	if _, ok := doc.Components.Schemas[name]; !ok {
+		s := schema.Generate(v)
+		if s.Type == "array" {
+			s = s.Items
+		}
+
+		doc.Components.Schemas[name] = s
+	}
+
+	if schema.IsArray(v) {
+		return &schema.Schema{Type: "array", Items: schema.Ref(name)}
+	}
+
+	return schema.Ref(name)
+}
+
+func jsonContent(s *schema.Schema) map[string]*OpenAPIMediaType {
+	return map[string]*OpenAPIMediaType{"application/json": {Schema: s}}
+}
+
+// openAPIPath converts a httprouter path such as /Connectors/:id into /Connectors/{id}
+// and returns the names of the path parameters
+func openAPIPath(path string) (string, []string) {
+	params := make([]string, 0)
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			params = append(params, part[1:])
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+
+	return strings.Join(parts, "/"), params
+}
+
+// operationID creates an id for an operation from its method and path, for instance postConnectorsIdStart
+func operationID(op models.EndpointOperation) string {
+	id := strings.ToLower(string(op.OperationType))
+	for _, part := range strings.Split(op.Path, "/") {
+		part = strings.TrimLeft(part, ":*")
+		part = strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, part)
+
+		if len(part) > 0 {
+			id += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+
+	return id
+}
+
+// componentName removes all characters that are not allowed in an OpenAPI component name
+func componentName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.' {
+			return r
+		}
+		return -1
+	}, name)
+}
@@ -0,0 +1,266 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
+)
+
+// QueryOptions holds the SensorThings query options of a request on a collection
+type QueryOptions struct {
+	Filter  *filterNode
+	OrderBy []orderByItem
+	Top     int
+	HasTop  bool
+	Skip    int
+	Count   bool
+}
+
+// CollectionResponse is the SensorThings style response for a collection requested with query options
+type CollectionResponse struct {
+	Count    *int          `json:"@iot.count,omitempty"`
+	NextLink string        `json:"@iot.nextLink,omitempty"`
+	Value    []interface{} `json:"value"`
+}
+
+type orderByItem struct {
+	path       []string
+	descending bool
+}
+
+// queryItem is the JSON of an item in a collection together with its decoded representation
+// which is used to filter and order the collection
+type queryItem struct {
+	value json.RawMessage
+	doc   interface{}
+}
+
+// ParseQueryOptions reads the $filter, $orderby, $top, $skip and $count options from the query of
+// a request, nil is returned when the request does not contain any query option
+func ParseQueryOptions(r *http.Request) (*QueryOptions, error) {
+	query := r.URL.Query()
+	if len(query) == 0 {
+		return nil, nil
+	}
+
+	options := &QueryOptions{}
+	found := false
+	for key, values := range query {
+		if !strings.HasPrefix(key, "$") {
+			continue
+		}
+
+		found = true
+		value := values[0]
+		var err error
+		switch key {
+		case "$filter":
+			options.Filter, err = parseFilter(value)
+		case "$orderby":
+			options.OrderBy, err = parseOrderBy(value)
+		case "$top":
+			options.Top, err = parseNonNegative(value)
+			options.HasTop = true
+		case "$skip":
+			options.Skip, err = parseNonNegative(value)
+		case "$count":
+			options.Count, err = strconv.ParseBool(value)
+		default:
+			err = errors.New("unsupported query option")
+		}
+
+		if err != nil {
+			return nil, connectorErrors.NewBadRequestError(fmt.Errorf("Invalid %s: %v", key, err))
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	return options, nil
+}
+
+// Apply filters, orders and pages the given collection, items is a slice of values that can be
+// marshalled to JSON, properties in $filter and $orderby refer to the JSON names of the values
+func (q *QueryOptions) Apply(r *http.Request, items interface{}) (*CollectionResponse, error) {
+	b, err := json.Marshal(items)
+	if err != nil {
+		return nil, connectorErrors.NewRequestInternalServerError(err)
+	}
+
+	raws := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(b, &raws); err != nil {
+		return nil, connectorErrors.NewRequestInternalServerError(err)
+	}
+
+	selected := make([]queryItem, 0, len(raws))
+	for _, raw := range raws {
+		var doc interface{}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, connectorErrors.NewRequestInternalServerError(err)
+		}
+
+		if q.Filter != nil {
+			match, err := q.Filter.evaluate(doc)
+			if err != nil {
+				return nil, connectorErrors.NewBadRequestError(fmt.Errorf("Invalid $filter: %v", err))
+			}
+
+			if b, ok := match.(bool); !ok || !b {
+				continue
+			}
+		}
+
+		selected = append(selected, queryItem{value: raw, doc: doc})
+	}
+
+	if len(q.OrderBy) > 0 {
+		sort.SliceStable(selected, func(i, j int) bool {
+			for _, o := range q.OrderBy {
+				c := compareValues(lookupPath(selected[i].doc, o.path), lookupPath(selected[j].doc, o.path))
+				if c != 0 {
+					return (c < 0) != o.descending
+				}
+			}
+
+			return false
+		})
+	}
+
+	response := &CollectionResponse{Value: make([]interface{}, 0)}
+	if q.Count {
+		count := len(selected)
+		response.Count = &count
+	}
+
+	end := len(selected)
+	if q.HasTop && q.Skip+q.Top < end {
+		end = q.Skip + q.Top
+		response.NextLink = nextLink(r, end)
+	}
+
+	for i := q.Skip; i < end; i++ {
+		response.Value = append(response.Value, selected[i].value)
+	}
+
+	return response, nil
+}
+
+// nextLink creates the link to the next page of a collection by replacing $skip in the request url
+func nextLink(r *http.Request, skip int) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	query := r.URL.Query()
+	query.Set("$skip", strconv.Itoa(skip))
+	rawQuery := strings.Replace(query.Encode(), "%24", "$", -1)
+	link := url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path, RawQuery: rawQuery}
+	return link.String()
+}
+
+func parseNonNegative(value string) (int, error) {
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, errors.New("expected a non-negative number")
+	}
+
+	return i, nil
+}
+
+// parseOrderBy parses a comma separated list of properties followed by an optional asc or desc
+func parseOrderBy(value string) ([]orderByItem, error) {
+	items := make([]orderByItem, 0)
+	for _, part := range strings.Split(value, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("unexpected %q", strings.TrimSpace(part))
+		}
+
+		item := orderByItem{path: strings.Split(fields[0], "/")}
+		if len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "asc":
+			case "desc":
+				item.descending = true
+			default:
+				return nil, fmt.Errorf("unexpected %q", fields[1])
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// lookupPath returns the value of a property path such as settings/host in a decoded JSON document
+func lookupPath(doc interface{}, path []string) interface{} {
+	current := doc
+	for _, p := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		current = m[p]
+	}
+
+	return current
+}
+
+// compareValues compares two decoded JSON values, nil is smaller than any other value and values of
+// different types are ordered by type
+func compareValues(a, b interface{}) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+
+	switch av := a.(type) {
+	case bool:
+		bv := b.(bool)
+		if av == bv {
+			return 0
+		} else if !av {
+			return -1
+		}
+		return 1
+	case float64:
+		bv := b.(float64)
+		if av < bv {
+			return -1
+		} else if av > bv {
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(av, b.(string))
+	}
+
+	return 0
+}
+
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	}
+
+	return 4
+}
@@ -0,0 +1,187 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronExpression is a parsed 5 field cron expression: minute hour day-of-month month day-of-week.
+// Every field supports *, single values, ranges (1-5), steps (*/10, 0-30/5) and lists (1,15,30),
+// the month and day-of-week fields also accept names such as jan and mon
+type cronExpression struct {
+	minute     []bool
+	hour       []bool
+	dayOfMonth []bool
+	month      []bool
+	dayOfWeek  []bool
+	anyDom     bool
+	anyDow     bool
+	anyHour    bool
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// parseCron parses a 5 field cron expression
+func parseCron(expression string) (*cronExpression, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Cron expression %q should have 5 fields", expression)
+	}
+
+	var err error
+	c := &cronExpression{
+		anyDom: fields[2] == "*" || fields[2] == "?",
+		anyDow: fields[4] == "*" || fields[4] == "?",
+	}
+
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if c.dayOfMonth, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	if c.dayOfWeek, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, err
+	}
+
+	// 7 is an alias for sunday
+	if c.dayOfWeek[7] {
+		c.dayOfWeek[0] = true
+	}
+
+	c.anyHour = true
+	for _, h := range c.hour {
+		c.anyHour = c.anyHour && h
+	}
+
+	return c, nil
+}
+
+// parseCronField parses a single cron field into a lookup table of allowed values
+func parseCronField(field string, min int, max int, names map[string]int) ([]bool, error) {
+	values := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[idx+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("Invalid step in cron field %q", field)
+			}
+			part = part[:idx]
+		}
+
+		from, to := min, max
+		if part != "*" && part != "?" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = parseCronValue(bounds[0], min, max, names); err != nil {
+				return nil, err
+			}
+
+			to = from
+			if len(bounds) == 2 {
+				if to, err = parseCronValue(bounds[1], min, max, names); err != nil {
+					return nil, err
+				}
+			} else if step > 1 {
+				to = max
+			}
+
+			if to < from {
+				return nil, fmt.Errorf("Invalid range in cron field %q", field)
+			}
+		}
+
+		for i := from; i <= to; i += step {
+			values[i] = true
+		}
+	}
+
+	return values, nil
+}
+
+// parseCronValue parses a number or name and checks if it is within the bounds of the field
+func parseCronValue(value string, min int, max int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("Invalid cron value %q, expected %d-%d", value, min, max)
+	}
+
+	return v, nil
+}
+
+// matchesDay checks the day-of-month and day-of-week fields, when both are restricted
+// a day matching either of them is allowed like in a standard cron
+func (c *cronExpression) matchesDay(t time.Time) bool {
+	dom := c.dayOfMonth[t.Day()]
+	dow := c.dayOfWeek[int(t.Weekday())]
+
+	if c.anyDom || c.anyDow {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// next returns the first time after t that matches the expression, a zero time is returned
+// when there is no match within 5 years. Like a standard cron a time skipped by a daylight saving
+// change does not match and a time that occurs twice only matches the first time, unless the
+// expression runs every hour
+func (c *cronExpression) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !c.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !c.hour[t.Hour()] {
+			// Add the remaining minutes instead of using time.Date, which is ambiguous for an hour that occurs twice
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+
+		if !c.minute[t.Minute()] || (!c.anyHour && repeated(t)) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// repeated checks if the wall clock time of t already occurred an hour earlier, which happens when
+// the clock is set back at the end of daylight saving time
+func repeated(t time.Time) bool {
+	earlier := t.Add(-time.Hour)
+	return earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute()
+}
@@ -0,0 +1,168 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expression string
+		field      func(c *cronExpression) []bool
+		expected   []int
+	}{
+		{"* * * * *", func(c *cronExpression) []bool { return c.hour }, seq(0, 23, 1)},
+		{"*/15 * * * *", func(c *cronExpression) []bool { return c.minute }, []int{0, 15, 30, 45}},
+		{"0-30/10 * * * *", func(c *cronExpression) []bool { return c.minute }, []int{0, 10, 20, 30}},
+		{"5/20 * * * *", func(c *cronExpression) []bool { return c.minute }, []int{5, 25, 45}},
+		{"1,15,30 * * * *", func(c *cronExpression) []bool { return c.minute }, []int{1, 15, 30}},
+		{"0 9-11,14 * * *", func(c *cronExpression) []bool { return c.hour }, []int{9, 10, 11, 14}},
+		{"0 0 1-7 * *", func(c *cronExpression) []bool { return c.dayOfMonth }, seq(1, 7, 1)},
+		{"0 0 * jan-mar *", func(c *cronExpression) []bool { return c.month }, []int{1, 2, 3}},
+		{"0 0 * JUN,dec *", func(c *cronExpression) []bool { return c.month }, []int{6, 12}},
+		{"0 0 * * mon-fri", func(c *cronExpression) []bool { return c.dayOfWeek }, seq(1, 5, 1)},
+		{"0 0 * * 7", func(c *cronExpression) []bool { return c.dayOfWeek }, []int{0, 7}},
+		{"0 0 * * sun,sat", func(c *cronExpression) []bool { return c.dayOfWeek }, []int{0, 6}},
+		{"0 0 ? * */2", func(c *cronExpression) []bool { return c.dayOfWeek }, []int{0, 2, 4, 6}},
+	}
+
+	for _, test := range tests {
+		c, err := parseCron(test.expression)
+		if err != nil {
+			t.Errorf("parseCron(%q) returned error: %v", test.expression, err)
+			continue
+		}
+
+		if got := values(test.field(c)); !equalInts(got, test.expected) {
+			t.Errorf("parseCron(%q) = %v, expected %v", test.expression, got, test.expected)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	expressions := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"a * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"30-10 * * * *",
+		"1-2-3 * * * *",
+		"mon * * * *",
+		"* * * mon *",
+		"* * * * jan",
+		"1,,2 * * * *",
+	}
+
+	for _, expression := range expressions {
+		if _, err := parseCron(expression); err == nil {
+			t.Errorf("parseCron(%q) should return an error", expression)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	amsterdam := location(t, "Europe/Amsterdam")
+	newYork := location(t, "America/New_York")
+
+	tests := []struct {
+		expression string
+		after      time.Time
+		expected   time.Time
+	}{
+		// every 10 minutes aligned to the clock, the result is always after the given time
+		{"*/10 * * * *", date(time.UTC, 2026, 10, 19, 10, 3), date(time.UTC, 2026, 10, 19, 10, 10)},
+		{"*/10 * * * *", date(time.UTC, 2026, 10, 19, 10, 10), date(time.UTC, 2026, 10, 19, 10, 20)},
+		{"*/10 * * * *", date(time.UTC, 2026, 10, 19, 10, 9).Add(59 * time.Second), date(time.UTC, 2026, 10, 19, 10, 10)},
+		{"*/10 * * * *", date(time.UTC, 2026, 10, 19, 23, 55), date(time.UTC, 2026, 10, 20, 0, 0)},
+		// ranges, lists and names
+		{"0 9 * * mon-fri", date(time.UTC, 2026, 10, 16, 10, 0), date(time.UTC, 2026, 10, 19, 9, 0)},
+		{"15,45 8-9 * * *", date(time.UTC, 2026, 10, 19, 9, 45), date(time.UTC, 2026, 10, 20, 8, 15)},
+		{"0 0 1 jan *", date(time.UTC, 2026, 10, 19, 0, 0), date(time.UTC, 2027, 1, 1, 0, 0)},
+		{"0 12 * * 7", date(time.UTC, 2026, 10, 19, 0, 0), date(time.UTC, 2026, 10, 25, 12, 0)},
+		// day-of-month only, months without the day are skipped
+		{"0 0 31 * *", date(time.UTC, 2026, 10, 31, 0, 0), date(time.UTC, 2026, 12, 31, 0, 0)},
+		{"0 0 29 2 *", date(time.UTC, 2026, 10, 19, 0, 0), date(time.UTC, 2028, 2, 29, 0, 0)},
+		{"0 0 13 * *", date(time.UTC, 2026, 10, 19, 0, 0), date(time.UTC, 2026, 11, 13, 0, 0)},
+		// day-of-month and day-of-week restricted, either of them matches
+		{"0 0 13 * fri", date(time.UTC, 2026, 10, 19, 0, 0), date(time.UTC, 2026, 10, 23, 0, 0)},
+		{"0 0 20 * fri", date(time.UTC, 2026, 10, 19, 0, 0), date(time.UTC, 2026, 10, 20, 0, 0)},
+		// no match within 5 years
+		{"0 0 30 2 *", date(time.UTC, 2026, 10, 19, 0, 0), time.Time{}},
+		// the time zone of the given time is used
+		{"0 9 * * *", date(newYork, 2026, 10, 19, 10, 0), date(time.UTC, 2026, 10, 20, 13, 0)},
+		{"0 9 * * *", date(newYork, 2026, 12, 1, 10, 0), date(time.UTC, 2026, 12, 2, 14, 0)},
+		// start of daylight saving time, 02:30 does not exist on 29 March 2026 in Amsterdam
+		{"30 2 * * *", date(amsterdam, 2026, 3, 28, 12, 0), date(amsterdam, 2026, 3, 30, 2, 30)},
+		{"0 * * * *", date(amsterdam, 2026, 3, 29, 1, 30), date(amsterdam, 2026, 3, 29, 3, 0)},
+		// end of daylight saving time, 02:30 occurs twice on 25 October 2026 in Amsterdam
+		{"30 2 * * *", date(amsterdam, 2026, 10, 25, 0, 0), date(time.UTC, 2026, 10, 25, 0, 30)},
+		{"30 2 * * *", date(time.UTC, 2026, 10, 25, 0, 30).In(amsterdam), date(amsterdam, 2026, 10, 26, 2, 30)},
+		{"0 * * * *", date(time.UTC, 2026, 10, 25, 0, 0).In(amsterdam), date(time.UTC, 2026, 10, 25, 1, 0)},
+	}
+
+	for _, test := range tests {
+		c, err := parseCron(test.expression)
+		if err != nil {
+			t.Fatalf("parseCron(%q) returned error: %v", test.expression, err)
+		}
+
+		if got := c.next(test.after); !got.Equal(test.expected) {
+			t.Errorf("next(%q, %v) = %v, expected %v", test.expression, test.after, got, test.expected)
+		}
+	}
+}
+
+func date(loc *time.Location, year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, loc)
+}
+
+func location(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s not available: %v", name, err)
+	}
+
+	return loc
+}
+
+func seq(from, to, step int) []int {
+	s := make([]int, 0)
+	for i := from; i <= to; i += step {
+		s = append(s, i)
+	}
+
+	return s
+}
+
+func values(field []bool) []int {
+	v := make([]int, 0)
+	for i, set := range field {
+		if set {
+			v = append(v, i)
+		}
+	}
+
+	return v
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
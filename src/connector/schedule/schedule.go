@@ -0,0 +1,280 @@
+// Package schedule contains the scheduling used by polling modules, a schedule runs a task on a fixed
+// interval or on a cron expression, optionally limited to active time windows and spread using jitter
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxIterations limits the search for a run time within the active windows
+const maxIterations = 10000
+
+// Settings describes a schedule and can be added to the settings of a module
+//   Cron: 5 field cron expression (minute hour day-of-month month day-of-week), for instance
+//     "*/10 * * * *" to run every 10 minutes aligned to the clock, takes precedence over Interval
+//   Interval: interval in seconds between two runs when no cron expression is given
+//   Jitter: maximum random delay in seconds added to every run to spread load
+//   Windows: time windows in which the schedule is active, always active when empty
+//   TimeZone: IANA time zone used for the cron expression and windows, defaults to local time
+type Settings struct {
+	Cron     string        `json:"cron" description:"Cron expression, for instance */10 * * * *"`
+	Interval time.Duration `json:"intervalSeconds" description:"Interval in seconds when no cron expression is given"`
+	Jitter   time.Duration `json:"jitterSeconds" description:"Maximum random delay in seconds"`
+	Windows  []Window      `json:"activeWindows" description:"Windows in which the schedule is active"`
+	TimeZone string        `json:"timezone" description:"IANA time zone, defaults to local time"`
+}
+
+// Window describes a period in which a schedule is active
+//   Days: days on which the window starts, for instance ["mon", "tue"], every day when empty
+//   From: start of the window in HH:MM
+//   To: end of the window in HH:MM, when To is before From the window ends the next day
+type Window struct {
+	Days []string `json:"days" description:"Days the window starts on, for instance mon"`
+	From string   `json:"from" description:"Start of the window in HH:MM"`
+	To   string   `json:"to" description:"End of the window in HH:MM"`
+}
+
+// window is a parsed Window, from and to are minutes since midnight
+type window struct {
+	days []bool
+	from int
+	to   int
+}
+
+// Schedule calculates the run times for given Settings and runs a task on them, a nil Schedule
+// is never active and has no run times
+type Schedule struct {
+	cron     *cronExpression
+	interval time.Duration
+	jitter   time.Duration
+	windows  []window
+	location *time.Location
+	nextRun  time.Time
+	mutex    sync.RWMutex
+}
+
+// CreateSchedule parses the given settings into a Schedule, defaultInterval is used
+// when the settings contain no cron expression or interval
+func CreateSchedule(settings Settings, defaultInterval time.Duration) (*Schedule, error) {
+	s := &Schedule{
+		interval: time.Second * settings.Interval,
+		jitter:   time.Second * settings.Jitter,
+		location: time.Local,
+	}
+
+	if s.interval <= 0 {
+		s.interval = defaultInterval
+	}
+
+	if len(settings.Cron) > 0 {
+		var err error
+		if s.cron, err = parseCron(settings.Cron); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(settings.TimeZone) > 0 {
+		var err error
+		if s.location, err = time.LoadLocation(settings.TimeZone); err != nil {
+			return nil, fmt.Errorf("Unknown time zone %s", settings.TimeZone)
+		}
+	}
+
+	for _, w := range settings.Windows {
+		pw, err := parseWindow(w)
+		if err != nil {
+			return nil, err
+		}
+
+		s.windows = append(s.windows, pw)
+	}
+
+	return s, nil
+}
+
+// Run calls task on every scheduled time until the context is done
+func (s *Schedule) Run(ctx context.Context, task func()) {
+	if s == nil {
+		<-ctx.Done()
+		return
+	}
+
+	for {
+		next := s.Next(time.Now())
+		if next.IsZero() {
+			s.setNextRun(next)
+			<-ctx.Done()
+			return
+		}
+
+		if s.jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+		}
+
+		s.setNextRun(next)
+		timer := time.NewTimer(next.Sub(time.Now()))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.setNextRun(time.Time{})
+			return
+		case <-timer.C:
+			task()
+		}
+	}
+}
+
+// NextRun returns the time the task will run next, a zero time is returned when
+// the schedule is not running or has no next run
+func (s *Schedule) NextRun() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.nextRun
+}
+
+// Active checks if the given time falls within one of the active windows
+func (s *Schedule) Active(t time.Time) bool {
+	if s == nil {
+		return false
+	}
+
+	if len(s.windows) == 0 {
+		return true
+	}
+
+	t = t.In(s.location)
+	minutes := t.Hour()*60 + t.Minute()
+	today := int(t.Weekday())
+	yesterday := (today + 6) % 7
+
+	for _, w := range s.windows {
+		if w.from <= w.to {
+			if w.days[today] && minutes >= w.from && minutes < w.to {
+				return true
+			}
+		} else if (w.days[today] && minutes >= w.from) || (w.days[yesterday] && minutes < w.to) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Next returns the first run time after the given time without jitter, a zero time is
+// returned when no run time can be found
+func (s *Schedule) Next(after time.Time) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+
+	after = after.In(s.location)
+	for i := 0; i < maxIterations; i++ {
+		var t time.Time
+		if s.cron != nil {
+			t = s.cron.next(after)
+		} else {
+			t = after.Add(s.interval)
+		}
+
+		if t.IsZero() || s.Active(t) {
+			return t
+		}
+
+		start := s.nextWindowStart(t)
+		if start.IsZero() {
+			return start
+		}
+
+		if s.cron == nil {
+			return start
+		}
+
+		after = start.Add(-time.Minute)
+	}
+
+	return time.Time{}
+}
+
+// nextWindowStart returns the first start of an active window after t
+func (s *Schedule) nextWindowStart(t time.Time) time.Time {
+	var first time.Time
+	for d := 0; d <= 7; d++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+d, 0, 0, 0, 0, s.location)
+		for _, w := range s.windows {
+			if !w.days[int(day.Weekday())] {
+				continue
+			}
+
+			start := time.Date(day.Year(), day.Month(), day.Day(), w.from/60, w.from%60, 0, 0, s.location)
+			if start.After(t) && (first.IsZero() || start.Before(first)) {
+				first = start
+			}
+		}
+
+		if !first.IsZero() {
+			return first
+		}
+	}
+
+	return first
+}
+
+func (s *Schedule) setNextRun(t time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.nextRun = t
+}
+
+// parseWindow parses the days and times of a Window
+func parseWindow(w Window) (window, error) {
+	pw := window{days: make([]bool, 7)}
+	if len(w.Days) == 0 {
+		for i := range pw.days {
+			pw.days[i] = true
+		}
+	}
+
+	for _, d := range w.Days {
+		day, ok := dayNames[strings.ToLower(d)]
+		if !ok {
+			return pw, fmt.Errorf("Unknown day %s in active window", d)
+		}
+
+		pw.days[day] = true
+	}
+
+	var err error
+	if pw.from, err = parseClock(w.From); err != nil {
+		return pw, err
+	}
+
+	if pw.to, err = parseClock(w.To); err != nil {
+		return pw, err
+	}
+
+	return pw, nil
+}
+
+// parseClock parses a HH:MM time into minutes since midnight, 24:00 can be used for the end of the day
+func parseClock(clock string) (int, error) {
+	if clock == "24:00" {
+		return 24 * 60, nil
+	}
+
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid time %s in active window, expected HH:MM", clock)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,142 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCreateScheduleErrors(t *testing.T) {
+	tests := []Settings{
+		{Cron: "61 * * * *"},
+		{TimeZone: "Nowhere/Town"},
+		{Windows: []Window{{From: "25:00", To: "06:00"}}},
+		{Windows: []Window{{From: "08:00", To: "8pm"}}},
+		{Windows: []Window{{Days: []string{"someday"}, From: "08:00", To: "17:00"}}},
+	}
+
+	for _, settings := range tests {
+		if _, err := CreateSchedule(settings, time.Minute); err == nil {
+			t.Errorf("CreateSchedule(%+v) should return an error", settings)
+		}
+	}
+}
+
+func TestActive(t *testing.T) {
+	tests := []struct {
+		windows  []Window
+		at       time.Time
+		expected bool
+	}{
+		// no windows, always active
+		{nil, date(time.UTC, 2026, 10, 19, 3, 0), true},
+		// window within a day, the end is not included
+		{[]Window{{From: "08:00", To: "17:00"}}, date(time.UTC, 2026, 10, 19, 7, 59), false},
+		{[]Window{{From: "08:00", To: "17:00"}}, date(time.UTC, 2026, 10, 19, 8, 0), true},
+		{[]Window{{From: "08:00", To: "17:00"}}, date(time.UTC, 2026, 10, 19, 17, 0), false},
+		{[]Window{{From: "00:00", To: "24:00"}}, date(time.UTC, 2026, 10, 19, 23, 59), true},
+		// window restricted to days
+		{[]Window{{Days: []string{"mon", "tue"}, From: "08:00", To: "17:00"}}, date(time.UTC, 2026, 10, 20, 12, 0), true},
+		{[]Window{{Days: []string{"mon", "tue"}, From: "08:00", To: "17:00"}}, date(time.UTC, 2026, 10, 21, 12, 0), false},
+		// window wrapping midnight belongs to the day it starts on
+		{[]Window{{Days: []string{"fri"}, From: "22:00", To: "06:00"}}, date(time.UTC, 2026, 10, 23, 21, 59), false},
+		{[]Window{{Days: []string{"fri"}, From: "22:00", To: "06:00"}}, date(time.UTC, 2026, 10, 23, 23, 0), true},
+		{[]Window{{Days: []string{"fri"}, From: "22:00", To: "06:00"}}, date(time.UTC, 2026, 10, 24, 5, 59), true},
+		{[]Window{{Days: []string{"fri"}, From: "22:00", To: "06:00"}}, date(time.UTC, 2026, 10, 24, 6, 0), false},
+		{[]Window{{Days: []string{"fri"}, From: "22:00", To: "06:00"}}, date(time.UTC, 2026, 10, 24, 23, 0), false},
+		{[]Window{{Days: []string{"fri"}, From: "22:00", To: "06:00"}}, date(time.UTC, 2026, 10, 23, 3, 0), false},
+		// one of multiple windows
+		{[]Window{{From: "06:00", To: "07:00"}, {From: "18:00", To: "19:00"}}, date(time.UTC, 2026, 10, 19, 18, 30), true},
+		{[]Window{{From: "06:00", To: "07:00"}, {From: "18:00", To: "19:00"}}, date(time.UTC, 2026, 10, 19, 12, 0), false},
+	}
+
+	for _, test := range tests {
+		s, err := CreateSchedule(Settings{Windows: test.windows, TimeZone: "UTC"}, time.Minute)
+		if err != nil {
+			t.Fatalf("CreateSchedule returned error: %v", err)
+		}
+
+		if got := s.Active(test.at); got != test.expected {
+			t.Errorf("Active(%v) with windows %+v = %v, expected %v", test.at, test.windows, got, test.expected)
+		}
+	}
+}
+
+func TestActiveTimeZone(t *testing.T) {
+	amsterdam := location(t, "Europe/Amsterdam")
+	s, err := CreateSchedule(Settings{Windows: []Window{{From: "08:00", To: "09:00"}}, TimeZone: "Europe/Amsterdam"}, time.Minute)
+	if err != nil {
+		t.Fatalf("CreateSchedule returned error: %v", err)
+	}
+
+	// 07:30 UTC is 08:30 in Amsterdam in winter and 09:30 in summer
+	if !s.Active(date(time.UTC, 2026, 1, 15, 7, 30)) {
+		t.Errorf("window should be active at 08:30 in %v", amsterdam)
+	}
+
+	if s.Active(date(time.UTC, 2026, 7, 15, 7, 30)) {
+		t.Errorf("window should not be active at 09:30 in %v", amsterdam)
+	}
+}
+
+func TestNext(t *testing.T) {
+	amsterdam := location(t, "Europe/Amsterdam")
+
+	tests := []struct {
+		settings Settings
+		after    time.Time
+		expected time.Time
+	}{
+		// the default interval is used without cron expression or interval
+		{Settings{TimeZone: "UTC"}, date(time.UTC, 2026, 10, 19, 10, 0), date(time.UTC, 2026, 10, 19, 10, 5)},
+		{Settings{Interval: 60, TimeZone: "UTC"}, date(time.UTC, 2026, 10, 19, 10, 0), date(time.UTC, 2026, 10, 19, 10, 1)},
+		// the cron expression takes precedence over the interval
+		{Settings{Cron: "0 * * * *", Interval: 60, TimeZone: "UTC"}, date(time.UTC, 2026, 10, 19, 10, 0), date(time.UTC, 2026, 10, 19, 11, 0)},
+		// an interval run outside the windows moves to the start of the next window
+		{Settings{Interval: 600, Windows: []Window{{From: "08:00", To: "17:00"}}, TimeZone: "UTC"},
+			date(time.UTC, 2026, 10, 19, 16, 45), date(time.UTC, 2026, 10, 19, 16, 55)},
+		{Settings{Interval: 600, Windows: []Window{{From: "08:00", To: "17:00"}}, TimeZone: "UTC"},
+			date(time.UTC, 2026, 10, 19, 16, 55), date(time.UTC, 2026, 10, 20, 8, 0)},
+		{Settings{Interval: 600, Windows: []Window{{Days: []string{"mon"}, From: "08:00", To: "17:00"}}, TimeZone: "UTC"},
+			date(time.UTC, 2026, 10, 19, 16, 55), date(time.UTC, 2026, 10, 26, 8, 0)},
+		// a cron run outside the windows moves to the first cron time within a window
+		{Settings{Cron: "*/20 * * * *", Windows: []Window{{Days: []string{"mon"}, From: "09:10", To: "12:00"}}, TimeZone: "UTC"},
+			date(time.UTC, 2026, 10, 18, 12, 0), date(time.UTC, 2026, 10, 19, 9, 20)},
+		// windows wrapping midnight
+		{Settings{Cron: "*/30 * * * *", Windows: []Window{{From: "22:00", To: "02:00"}}, TimeZone: "UTC"},
+			date(time.UTC, 2026, 10, 19, 1, 30), date(time.UTC, 2026, 10, 19, 22, 0)},
+		{Settings{Cron: "*/30 * * * *", Windows: []Window{{From: "22:00", To: "02:00"}}, TimeZone: "UTC"},
+			date(time.UTC, 2026, 10, 19, 23, 30), date(time.UTC, 2026, 10, 20, 0, 0)},
+		// the time zone applies to the cron expression and windows
+		{Settings{Cron: "0 9 * * *", TimeZone: "America/New_York"}, date(time.UTC, 2026, 10, 19, 12, 0), date(time.UTC, 2026, 10, 19, 13, 0)},
+		// a window on the day daylight saving time starts opens at 08:00 local time
+		{Settings{Interval: 3600, Windows: []Window{{From: "08:00", To: "09:00"}}, TimeZone: "Europe/Amsterdam"},
+			date(amsterdam, 2026, 3, 29, 0, 0), date(amsterdam, 2026, 3, 29, 8, 0)},
+		{Settings{Interval: 3600, Windows: []Window{{From: "08:00", To: "09:00"}}, TimeZone: "Europe/Amsterdam"},
+			date(amsterdam, 2026, 10, 25, 0, 0), date(amsterdam, 2026, 10, 25, 8, 0)},
+		// no window day ever matches the cron expression
+		{Settings{Cron: "0 12 * * sat", Windows: []Window{{Days: []string{"mon"}, From: "08:00", To: "17:00"}}, TimeZone: "UTC"},
+			date(time.UTC, 2026, 10, 19, 0, 0), time.Time{}},
+	}
+
+	for _, test := range tests {
+		s, err := CreateSchedule(test.settings, 5*time.Minute)
+		if err != nil {
+			t.Fatalf("CreateSchedule(%+v) returned error: %v", test.settings, err)
+		}
+
+		if got := s.Next(test.after); !got.Equal(test.expected) {
+			t.Errorf("Next(%v) with %+v = %v, expected %v", test.after, test.settings, got, test.expected)
+		}
+	}
+}
+
+func TestNilSchedule(t *testing.T) {
+	var s *Schedule
+	if s.Active(time.Now()) {
+		t.Error("a nil schedule should not be active")
+	}
+
+	if !s.Next(time.Now()).IsZero() || !s.NextRun().IsZero() {
+		t.Error("a nil schedule should not have a run time")
+	}
+}
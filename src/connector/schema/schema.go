@@ -0,0 +1,138 @@
+// Package schema generates JSON schemas from Go types, the schemas are used to document
+// the REST API and the settings of modules
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is a subset of JSON Schema as used by OpenAPI 3
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+}
+
+// FormatPassword is the format of string fields holding a secret, struct fields are marked as secret
+// using the tag secret:"true". Secrets are redacted when settings are returned by the REST API
+const FormatPassword = "password"
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Generate creates a schema for the type of the given value, struct fields are named by their
+// json tag, the optional description tag of a field is used as description and fields tagged
+// with secret:"true" get the format password
+func Generate(v interface{}) *Schema {
+	if v == nil {
+		return &Schema{}
+	}
+
+	return generateType(reflect.TypeOf(v))
+}
+
+// Ref creates a schema referencing a schema in the components of an OpenAPI document
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// TypeName returns the name of the type of the given value, pointers and slices are dereferenced
+func TypeName(v interface{}) string {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	return t.Name()
+}
+
+// IsArray checks if the given value is a slice or array
+func IsArray(v interface{}) bool {
+	k := reflect.TypeOf(v).Kind()
+	return k == reflect.Slice || k == reflect.Array
+}
+
+func generateType(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "integer"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return generateType(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: generateType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: generateType(t.Elem())}
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		addProperties(s, t)
+		return s
+	}
+
+	return &Schema{}
+}
+
+// addProperties adds the exported fields of a struct to the properties of the schema,
+// fields of embedded structs are added as if they were part of the struct itself
+func addProperties(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		if field.Anonymous && len(name) == 0 {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				addProperties(s, ft)
+				continue
+			}
+		}
+
+		if len(field.PkgPath) > 0 || name == "-" {
+			continue
+		}
+
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		fs := generateType(field.Type)
+		fs.Description = field.Tag.Get("description")
+		if field.Tag.Get("secret") == "true" {
+			fs.Format = FormatPassword
+		}
+
+		s.Properties[name] = fs
+	}
+}
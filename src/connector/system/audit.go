@@ -0,0 +1,188 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// defaultAuditRetention is the time audit events are kept when no retention is configured
+const defaultAuditRetention = 90 * 24 * time.Hour
+
+// GetAuditEvents retrieves the audit events matching the query, newest first
+func (sc *SensorThingsConnector) GetAuditEvents(query *models.AuditQuery) ([]*models.AuditEvent, error) {
+	events, err := sc.db.GetAuditEvents(query)
+	if err != nil {
+		return nil, connectorErrors.NewRequestInternalServerError(err)
+	}
+
+	return events, nil
+}
+
+// audit records a change of a connector made by the actor in ctx, before is nil for a created connector
+// and after is nil for a deleted connector. Failing to record an event is logged and does not undo the change
+func (sc *SensorThingsConnector) audit(ctx context.Context, action models.AuditAction, before, after *models.ConnectorDefinition) {
+	event := &models.AuditEvent{
+		Time:    time.Now().UTC(),
+		Action:  action,
+		Changes: sc.connectorDiff(before, after),
+	}
+
+	if actor := models.GetAuditActor(ctx); actor != nil {
+		event.Identity = actor.Identity
+		event.RemoteAddress = actor.RemoteAddress
+	}
+
+	if after != nil {
+		event.ConnectorID, event.ConnectorName = after.ID, after.Name
+	} else if before != nil {
+		event.ConnectorID, event.ConnectorName = before.ID, before.Name
+	}
+
+	retention := time.Duration(sc.auditConfig.RetentionDays) * 24 * time.Hour
+	if sc.auditConfig.RetentionDays == 0 {
+		retention = defaultAuditRetention
+	} else if retention < 0 {
+		retention = 0
+	}
+
+	if err := sc.db.InsertAuditEvent(event, retention, sc.auditConfig.MaxEvents); err != nil {
+		log.Printf("Unable to record audit event for connector %v: %v", event.ConnectorID, err.Error())
+	}
+}
+
+// connectorDefinition returns a copy of the definition of a connector, the copy does not change
+// when the connector is started or stopped
+func connectorDefinition(c models.Connector) *models.ConnectorDefinition {
+	def := c.(*models.ConnectorBase).GetDefinition()
+	return &def
+}
+
+// connectorDiff returns the fields that differ between two connector definitions, objects are compared
+// per field and lists of the same length per item. The values of a change are taken from the redacted
+// definitions so a changed secret is reported without its value
+func (sc *SensorThingsConnector) connectorDiff(before, after *models.ConnectorDefinition) []models.AuditChange {
+	changes := make([]models.AuditChange, 0)
+	redactedBefore := definitionValue(sc.redactDefinition(before))
+	redactedAfter := definitionValue(sc.redactDefinition(after))
+	diffValue(nil, definitionValue(before), definitionValue(after), func(path []string) {
+		changes = append(changes, models.AuditChange{
+			Field:  strings.Join(path, "/"),
+			Before: auditValue(valueAt(redactedBefore, path)),
+			After:  auditValue(valueAt(redactedAfter, path)),
+		})
+	})
+
+	return changes
+}
+
+// definitionValue returns a connector definition as decoded JSON, nil when there is no definition
+func definitionValue(def *models.ConnectorDefinition) interface{} {
+	if def == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(def)
+	if err != nil {
+		return nil
+	}
+
+	var v interface{}
+	json.Unmarshal(b, &v)
+	return v
+}
+
+// diffValue calls changed with the path of every value that differs between two decoded JSON values
+func diffValue(path []string, before, after interface{}, changed func(path []string)) {
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+
+	// the definition of a created or deleted connector is compared per field as well
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap || len(path) == 0 && (beforeIsMap || before == nil) && (afterIsMap || after == nil) {
+		for _, k := range sortedKeys(beforeMap, afterMap) {
+			diffValue(appendPath(path, k), beforeMap[k], afterMap[k], changed)
+		}
+
+		return
+	}
+
+	beforeList, beforeIsList := before.([]interface{})
+	afterList, afterIsList := after.([]interface{})
+	if beforeIsList && afterIsList && len(beforeList) == len(afterList) {
+		for i := range beforeList {
+			diffValue(appendPath(path, strconv.Itoa(i)), beforeList[i], afterList[i], changed)
+		}
+
+		return
+	}
+
+	changed(path)
+}
+
+// valueAt returns the value at a path in a decoded JSON value, nil when the path does not exist
+func valueAt(node interface{}, path []string) interface{} {
+	for _, p := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			node = n[p]
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i >= len(n) {
+				return nil
+			}
+
+			node = n[i]
+		default:
+			return nil
+		}
+	}
+
+	return node
+}
+
+// auditValue encodes a value for an audit change, nil is returned for a missing value
+func auditValue(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	return b
+}
+
+// sortedKeys returns the keys of both maps in alphabetical order
+func sortedKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// appendPath returns a new path with the field added to the given path
+func appendPath(path []string, field string) []string {
+	return append(path[:len(path):len(path)], field)
+}
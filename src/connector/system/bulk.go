@@ -0,0 +1,112 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// bulkWorkers is the maximum number of connectors started or stopped at the same time by a bulk request
+const bulkWorkers = 8
+
+// SetConnectorsState starts or stops all connectors selected by the selector, the state of every connector is
+// set separately so connectors that fail do not affect the others. Up to bulkWorkers connectors are started or
+// stopped concurrently, the results keep the order of the selection. Unknown ids and read-only connectors
+// are reported as failed in the result
+func (sc *SensorThingsConnector) SetConnectorsState(ctx context.Context, selector *models.ConnectorSelector, running bool) (*models.BulkResult, error) {
+	if selector.IsEmpty() {
+		return nil, connectorErrors.NewBadRequestError(errors.New("Select connectors using ids, module or labels"))
+	}
+
+	ids := sc.selectConnectors(selector)
+	results := make([]models.BulkItemResult, len(ids))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < bulkWorkers && w < len(ids); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = sc.setBulkItemState(ctx, ids[i], running)
+			}
+		}()
+	}
+
+	for i := range ids {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	result := &models.BulkResult{Results: results}
+	for _, item := range results {
+		if item.Success {
+			result.Succeeded++
+		} else {
+			result.Failed++
+		}
+	}
+
+	return result, nil
+}
+
+// setBulkItemState starts or stops a single connector of a bulk request
+func (sc *SensorThingsConnector) setBulkItemState(ctx context.Context, id string, running bool) models.BulkItemResult {
+	item := models.BulkItemResult{ID: id, Success: true}
+	if c, ok := sc.lookupConnector(id); ok {
+		item.Name = c.GetName()
+	}
+
+	if err := sc.SetConnectorState(ctx, id, running); err != nil {
+		item.Success = false
+		item.Error = errorContent(err)
+	}
+
+	return item
+}
+
+// selectConnectors returns the ids of the connectors selected by the selector, the given ids are returned
+// once in the given order including unknown ids. Connectors selected by module and labels are ordered by name
+func (sc *SensorThingsConnector) selectConnectors(selector *models.ConnectorSelector) []string {
+	ids := make([]string, 0)
+	if len(selector.IDs) > 0 {
+		seen := make(map[string]bool)
+		for _, id := range selector.IDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+
+		return ids
+	}
+
+	connectors, _ := sc.GetConnectors()
+	for _, c := range connectors {
+		if selector.Matches(c.(*models.ConnectorBase)) {
+			ids = append(ids, c.GetID())
+		}
+	}
+
+	return ids
+}
+
+// errorContent converts an error to the content of an error response, errors that are not an
+// APIError are reported as internal server error
+func errorContent(err error) *models.ErrorContent {
+	statusCode := http.StatusInternalServerError
+	if e, ok := err.(connectorErrors.APIError); ok {
+		statusCode = e.GetHTTPErrorStatusCode()
+	}
+
+	return &models.ErrorContent{
+		StatusText: http.StatusText(statusCode),
+		StatusCode: statusCode,
+		Message:    err.Error(),
+	}
+}
@@ -1,28 +1,63 @@
 package system
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"reflect"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/tebben/sensorthings-connector/src/connector/config"
 	"github.com/tebben/sensorthings-connector/src/connector/database"
 	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
+	"github.com/tebben/sensorthings-connector/src/connector/logging"
 	"github.com/tebben/sensorthings-connector/src/connector/models"
 	"github.com/tebben/sensorthings-connector/src/connector/mqtt"
 	"github.com/tebben/sensorthings-connector/src/connector/rest"
 )
 
+// connectorTestTimeout is the maximum time a module gets to complete a connector test
+const connectorTestTimeout = 10 * time.Second
+
 type SensorThingsConnector struct {
-	typeRegistry  map[string]reflect.Type
-	connectors    map[string]models.Connector
-	modules       []models.ConnectorModule
-	restEndpoints []models.ConnectorEndpoint
-	pubChannel    chan *models.PublishMessage
-	pubClient     mqtt.MqttPubClient
-	db            database.Database
-	dbLocation    string
+	typeRegistry        map[string]func() models.ConnectorModule
+	connectors          map[string]models.Connector
+	connectorsMutex     sync.RWMutex
+	connectorLocks      map[string]*connectorLock
+	connectorLocksMutex sync.Mutex
+	templates           map[string]*models.ConnectorTemplate
+	templatesMutex      sync.RWMutex
+	roles               map[string]*models.RoleAssignment
+	rolesMutex          sync.RWMutex
+	feeds               map[string]*models.LiveFeed
+	feedsMutex          sync.Mutex
+	metrics             map[string]*models.ConnectorMetrics
+	metricsMutex        sync.Mutex
+	logs                map[string]*logging.Buffer
+	logsMutex           sync.Mutex
+	logBufferSize       int
+	modules             []models.ConnectorModule
+	restEndpoints       []models.ConnectorEndpoint
+	pubChannel          chan *models.PublishMessage
+	pubClient           mqtt.MqttPubClient
+	db                  database.Database
+	dbLocation          string
+	files               models.ConnectorFilesConfig
+	auditConfig         models.AuditConfig
+	healthConfig        models.HealthConfig
+	encryption          models.EncryptionConfig
+}
+
+// connectorLock serialises the changes of a connector, refs counts the holders and waiters of the lock
+type connectorLock struct {
+	sync.Mutex
+	refs int
 }
 
 // CreateSystem initialises a new SensorThings System
@@ -31,21 +66,46 @@ func CreateSystem(config config.Config) models.System {
 	pubClient := mqtt.CreatePubClient(config.PubBroker.Host, config.PubClient.Qos, config.PubClient.ClientID, pubChan, config.PubBroker.Username, config.PubBroker.Password, config.PubClient.KeepAlive, config.PubClient.PingTimeOut)
 
 	return &SensorThingsConnector{
-		typeRegistry: make(map[string]reflect.Type, 0),
-		connectors:   make(map[string]models.Connector, 0),
-		pubChannel:   pubChan,
-		pubClient:    pubClient,
-		db:           database.Database{},
-		dbLocation:   config.Database,
+		typeRegistry:   make(map[string]func() models.ConnectorModule, 0),
+		connectors:     make(map[string]models.Connector, 0),
+		connectorLocks: make(map[string]*connectorLock, 0),
+		templates:      make(map[string]*models.ConnectorTemplate, 0),
+		roles:          make(map[string]*models.RoleAssignment, 0),
+		feeds:          make(map[string]*models.LiveFeed, 0),
+		metrics:        make(map[string]*models.ConnectorMetrics, 0),
+		logs:           make(map[string]*logging.Buffer, 0),
+		logBufferSize:  config.Log.BufferSize,
+		pubChannel:     pubChan,
+		pubClient:      pubClient,
+		db:             database.Database{},
+		dbLocation:     config.Database,
+		files:          config.ConnectorFiles,
+		auditConfig:    config.Audit,
+		healthConfig:   config.Health,
+		encryption:     config.Encryption,
 	}
 }
 
 // Start SensorThings connector, Start setups the modules and registers all module actions
 func (sc *SensorThingsConnector) Start() {
 	sc.restEndpoints = rest.CreateEndPoints()
+	sc.restEndpoints = append(sc.restEndpoints, rest.CreateModuleEndPoints(sc.modules, sc.restEndpoints)...)
 	sc.pubClient.Start()
+	// Open the database, unencrypted records are encrypted when a key is configured
+	key, err := database.LoadKey(sc.encryption)
+	if err != nil {
+		log.Fatal("encryption key error: ", err)
+	}
+
+	if err = sc.db.SetEncryptionKey(key); err != nil {
+		log.Fatal("encryption key error: ", err)
+	}
+
+	if err = sc.db.Open(sc.dbLocation); err != nil {
+		log.Fatal("database error: ", err)
+	}
+
 	// Load connectors from database
-	sc.db.Open(sc.dbLocation)
 	connectors, err := sc.db.GetConnectors()
 	if err != nil {
 		log.Printf("%v", err.Error())
@@ -53,27 +113,85 @@ func (sc *SensorThingsConnector) Start() {
 		// Setup connector
 		for idx, _ := range connectors {
 			con := connectors[idx]
+			if con.Revision == 0 {
+				con.Revision = 1
+			}
+
 			if err = sc.setupConnector(con); err != nil {
 				log.Printf("%v", err.Error())
 				continue
 			}
 
-			sc.connectors[con.GetID()] = con
-			con.Module.SettingsChanged(con.GetSettings())
-			if con.GetIsRunning() {
+			sc.storeConnector(con)
+			if err = con.Module.SettingsChanged(con.GetSettings()); err != nil {
+				log.Printf("Connector %v has invalid settings and is not started: %v", con.GetName(), err.Error())
+			} else if con.GetIsRunning() {
 				con.Start()
 			}
 
 			log.Printf("Connector loaded: %v", con.GetName())
 		}
 	}
+
+	// Load templates from database
+	templates, err := sc.db.GetTemplates()
+	if err != nil {
+		log.Printf("%v", err.Error())
+	} else {
+		for _, t := range templates {
+			sc.storeTemplate(t)
+		}
+	}
+
+	// Load role assignments from database
+	assignments, err := sc.db.GetRoleAssignments()
+	if err != nil {
+		log.Printf("%v", err.Error())
+	} else {
+		for _, a := range assignments {
+			// assignments from before the method was stored cannot be bound to an identity
+			if len(a.Method) == 0 {
+				log.Printf("Role assignment of %v has no authentication method and is removed, assign the role again", a.Identity)
+				if err := sc.db.DeleteRoleAssignment(a.Method, a.Identity); err != nil {
+					log.Printf("%v", err.Error())
+				}
+				continue
+			}
+
+			sc.roles[a.Key()] = a
+		}
+	}
+
+	// Reconcile connectors with the connector files
+	if len(sc.files.Directory) > 0 {
+		sc.reconcileConnectorFiles()
+		if sc.files.Watch {
+			go sc.watchConnectorFiles()
+		}
+	}
 }
 
-// AddModule add a new module to SensorThings Connector
-func (sc *SensorThingsConnector) AddModule(module models.ConnectorModule) {
+// AddModule add a new module to SensorThings Connector, modules implementing ConnectorModuleFactory
+// are instantiated using NewInstance, other modules are instantiated from their type using reflection.
+// A module with the name of an added module is not added and returns an error
+func (sc *SensorThingsConnector) AddModule(module models.ConnectorModule) error {
 	module.Setup()
+	if _, exists := sc.typeRegistry[module.GetName()]; exists {
+		return fmt.Errorf("Module %s already exists", module.GetName())
+	}
+
 	sc.modules = append(sc.modules, module)
-	sc.typeRegistry[module.GetName()] = reflect.TypeOf(module)
+
+	if factory, ok := module.(models.ConnectorModuleFactory); ok {
+		sc.typeRegistry[module.GetName()] = factory.NewInstance
+	} else {
+		t := reflect.TypeOf(module)
+		sc.typeRegistry[module.GetName()] = func() models.ConnectorModule {
+			return reflect.New(t.Elem()).Interface().(models.ConnectorModule)
+		}
+	}
+
+	return nil
 }
 
 // GetModules retrieves all current models added to SensorThings Connector
@@ -81,24 +199,28 @@ func (sc *SensorThingsConnector) GetModules() ([]models.ConnectorModule, error)
 	return sc.modules, nil
 }
 
-// GetConnectors retrieves all current created connectors
+// GetConnectors retrieves all current created connectors ordered by name and id
 func (sc *SensorThingsConnector) GetConnectors() ([]models.Connector, error) {
-	v := make([]models.Connector, 0, len(sc.connectors))
+	v := sc.listConnectors()
+	sort.Slice(v, func(i, j int) bool {
+		if v[i].GetName() != v[j].GetName() {
+			return v[i].GetName() < v[j].GetName()
+		}
 
-	for _, value := range sc.connectors {
-		v = append(v, value)
-	}
+		return v[i].GetID() < v[j].GetID()
+	})
 
 	return v, nil
 }
 
 // GetConnector retrieves a connector by id
 func (sc *SensorThingsConnector) GetConnector(id string) (models.Connector, error) {
-	if exist, err := sc.checkConnectorExist(id); !exist {
+	c, err := sc.findConnector(id)
+	if err != nil {
 		return nil, err
 	}
 
-	return sc.connectors[id], nil
+	return c, nil
 }
 
 // GetEndpoints retrieves all REST endpoints defined for SensorThings Connector including module endpoints
@@ -109,48 +231,164 @@ func (sc *SensorThingsConnector) GetEndpoints() []models.ConnectorEndpoint {
 	return eps
 }
 
-// CreateConnector create a new connector based on given information and adds it to the database
-func (sc *SensorThingsConnector) CreateConnector(connector *models.ConnectorBase) (models.Connector, error) {
+// CreateConnector create a new connector based on given information and adds it to the database,
+// the creation is recorded in the audit log with the actor from ctx
+func (sc *SensorThingsConnector) CreateConnector(ctx context.Context, connector *models.ConnectorBase) (models.Connector, error) {
 	connector.ID = RandomString(8)
-	if err := sc.db.InsertConnector(connector); err != nil {
-		return nil, connectorErrors.NewRequestInternalServerError(err)
+	connector.Source = ""
+	unlock := sc.lockConnector(connector.ID)
+	defer unlock()
+
+	return sc.addConnector(ctx, connector)
+}
+
+// addConnector sets up a connector with an id, adds it to the database and records the creation. The
+// connector is not added when its module does not exist or does not accept its settings or when there
+// already is a connector with the id. The caller holds the lock of the id
+func (sc *SensorThingsConnector) addConnector(ctx context.Context, connector *models.ConnectorBase) (models.Connector, error) {
+	if _, exists := sc.lookupConnector(connector.ID); exists {
+		return nil, connectorErrors.NewConflictError(fmt.Errorf("Connector %s already exists", connector.ID))
+	}
+
+	if err := sc.validateDefinition(connector.GetDefinition()); err != nil {
+		return nil, connectorErrors.NewBadRequestError(err)
 	}
 
 	if err := sc.setupConnector(connector); err != nil {
+		sc.releaseConnector(connector.ID)
+		return nil, connectorErrors.NewRequestInternalServerError(err)
+	}
+
+	if err := connector.GetModule().SettingsChanged(connector.GetSettings()); err != nil {
+		sc.releaseConnector(connector.ID)
+		return nil, connectorErrors.NewBadRequestError(err)
+	}
+
+	connector.Revision = 1
+	if err := sc.db.InsertConnector(connector); err != nil {
+		sc.releaseConnector(connector.ID)
 		return nil, connectorErrors.NewRequestInternalServerError(err)
 	}
 
-	sc.connectors[connector.ID] = connector
-	connector.Module.SettingsChanged(connector.GetSettings())
+	sc.storeConnector(connector)
+	sc.audit(ctx, models.AuditActionCreate, nil, connectorDefinition(connector))
 	log.Printf("Connector created: %v", connector.GetName())
 	return connector, nil
 }
 
 // SetConnectorState sets the running state for a given module, returns an error if
-// module not found
-func (sc *SensorThingsConnector) SetConnectorState(id string, running bool) error {
-	if exist, err := sc.checkConnectorExist(id); !exist {
+// module not found or the connector is read-only
+func (sc *SensorThingsConnector) SetConnectorState(ctx context.Context, id string, running bool) error {
+	unlock := sc.lockConnector(id)
+	defer unlock()
+
+	c, err := sc.writableConnector(id)
+	if err != nil {
 		return err
 	}
 
-	c := sc.connectors[id]
+	return sc.setConnectorState(ctx, c, running)
+}
+
+// setConnectorState starts or stops an existing connector, saves the running state and records the change
+func (sc *SensorThingsConnector) setConnectorState(ctx context.Context, c *models.ConnectorBase, running bool) error {
+	before := connectorDefinition(c)
+	logger := sc.connectorLogger(c)
+	action := models.AuditActionStart
 	if running {
 		c.Start()
+		logger.Infof("Connector started")
 	} else {
-		c.Stop()
+		action = models.AuditActionStop
+		if err := c.Stop(); err != nil {
+			logger.Errorf("%v", err.Error())
+		} else {
+			logger.Infof("Connector stopped")
+		}
+	}
+
+	if err := sc.db.SaveConnectorState(c.ID, running); err != nil {
+		return err
+	}
+
+	sc.audit(ctx, action, before, connectorDefinition(c))
+	return nil
+}
+
+// PatchConnector applies a JSON merge patch (RFC 7396) to a connector, fields that are not in the patch
+// keep their value and null removes a value. When revision is not 0 the connector is only changed if it
+// still has the given revision. The id, running state and revision can not be changed using a patch and
+// redacted secrets keep their stored value
+func (sc *SensorThingsConnector) PatchConnector(ctx context.Context, id string, patch json.RawMessage, revision int64) (models.Connector, error) {
+	unlock := sc.lockConnector(id)
+	defer unlock()
+
+	stored, err := sc.writableConnector(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkRevision(stored, revision); err != nil {
+		return nil, err
+	}
+
+	doc, err := json.Marshal(stored.GetDefinition())
+	if err != nil {
+		return nil, connectorErrors.NewRequestInternalServerError(err)
+	}
+
+	patched, err := mergePatch(doc, patch)
+	if err != nil {
+		return nil, connectorErrors.NewBadRequestError(errors.New("Unable to apply patch"))
+	}
+
+	connector := &models.ConnectorBase{}
+	if err := json.Unmarshal(patched, connector); err != nil {
+		return nil, connectorErrors.NewBadRequestError(errors.New("Unable to parse connector"))
+	}
+
+	if err := sc.restoreSecrets(stored, connector); err != nil {
+		return nil, err
 	}
 
-	return sc.db.SaveConnectorState(id, running)
+	connector.Source = ""
+	return sc.patchConnector(ctx, stored, connector)
 }
 
-// PatchConnector updates a given Connector, user is unable to change id
-func (sc *SensorThingsConnector) PatchConnector(id string, connector *models.ConnectorBase) (models.Connector, error) {
-	if exist, err := sc.checkConnectorExist(id); !exist {
+// ReplaceConnector replaces a connector with the given connector, when revision is not 0 the connector
+// is only replaced if it still has the given revision. The id and running state can not be changed and
+// redacted secrets keep their stored value
+func (sc *SensorThingsConnector) ReplaceConnector(ctx context.Context, id string, connector *models.ConnectorBase, revision int64) (models.Connector, error) {
+	unlock := sc.lockConnector(id)
+	defer unlock()
+
+	stored, err := sc.writableConnector(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkRevision(stored, revision); err != nil {
+		return nil, err
+	}
+
+	if err := sc.restoreSecrets(stored, connector); err != nil {
 		return nil, err
 	}
 
-	connector.ID = id
-	connector.Running = sc.connectors[id].GetIsRunning()
+	connector.Source = ""
+	return sc.patchConnector(ctx, stored, connector)
+}
+
+// patchConnector replaces an existing connector, the connector keeps its running state and gets the next
+// revision. The connector is only saved when the stored connector has the revision of the existing connector.
+// The change is recorded in the audit log, the caller holds the lock of the connector
+func (sc *SensorThingsConnector) patchConnector(ctx context.Context, existing *models.ConnectorBase, connector *models.ConnectorBase) (models.Connector, error) {
+	connector.ID = existing.ID
+	connector.Running = existing.GetIsRunning()
+	connector.Revision = existing.GetRevision() + 1
+	if _, ok := sc.typeRegistry[connector.ModuleName]; !ok {
+		return nil, connectorErrors.NewBadRequestError(fmt.Errorf("Module %s not found", connector.ModuleName))
+	}
 
 	if err := sc.setupConnector(connector); err != nil {
 		return connector, connectorErrors.NewRequestInternalServerError(err)
@@ -160,57 +398,659 @@ func (sc *SensorThingsConnector) PatchConnector(id string, connector *models.Con
 		return nil, connectorErrors.NewBadRequestError(err)
 	}
 
-	if err := sc.db.InsertConnector(connector); err != nil {
+	if err := sc.db.UpdateConnector(connector, existing.GetRevision()); err != nil {
+		if revisionErr, ok := err.(*database.RevisionError); ok {
+			return nil, connectorErrors.NewPreconditionFailedError(fmt.Errorf("Connector %s has been changed, the current revision is %d", existing.ID, revisionErr.Current))
+		}
+
 		return connector, connectorErrors.NewRequestInternalServerError(err)
 	}
 
-	sc.connectors[id].Stop()
-	sc.connectors[id] = connector
+	if err := existing.Stop(); err != nil {
+		log.Printf("%v", err.Error())
+	}
 
-	if connector.Running {
+	before := connectorDefinition(existing)
+	sc.storeConnector(connector)
+
+	if connector.GetIsRunning() {
 		connector.Start()
 	}
 
+	sc.audit(ctx, models.AuditActionUpdate, before, connectorDefinition(connector))
 	return connector, nil
 }
 
-// DeleteConnector stops the given connector if running and deletes it from the database
-func (sc *SensorThingsConnector) DeleteConnector(id string) error {
-	if exist, err := sc.checkConnectorExist(id); !exist {
+// CloneConnector creates a new connector by copying the connector with the given id, overrides is a
+// JSON merge patch which is applied to the copy, for instance to change the name or part of the settings.
+// The new connector is not started
+func (sc *SensorThingsConnector) CloneConnector(ctx context.Context, id string, overrides json.RawMessage) (models.Connector, error) {
+	source, err := sc.findConnector(id)
+	if err != nil {
+		return nil, err
+	}
+
+	clone := &models.ConnectorBase{
+		Name:        fmt.Sprintf("%s (copy)", source.GetName()),
+		Description: source.GetDescription(),
+		ModuleName:  source.GetModuleName(),
+		Settings:    append(json.RawMessage{}, source.GetSettings()...),
+		Labels:      copyLabels(source.Labels),
+	}
+
+	if len(overrides) > 0 {
+		doc, err := json.Marshal(clone)
+		if err != nil {
+			return nil, connectorErrors.NewRequestInternalServerError(err)
+		}
+
+		patched, err := mergePatch(doc, overrides)
+		if err != nil {
+			return nil, connectorErrors.NewBadRequestError(errors.New("Unable to apply overrides"))
+		}
+
+		clone = &models.ConnectorBase{}
+		if err := json.Unmarshal(patched, clone); err != nil {
+			return nil, connectorErrors.NewBadRequestError(errors.New("Unable to apply overrides"))
+		}
+
+		clone.Running = false
+		if err := sc.restoreSecrets(source, clone); err != nil {
+			return nil, err
+		}
+	}
+
+	return sc.CreateConnector(ctx, clone)
+}
+
+// copyLabels returns a copy of the labels of a connector so a copy can change them without changing the
+// original, nil for no labels
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+
+	return copied
+}
+
+// GetTemplates retrieves all connector templates ordered by name and id, the secrets in the
+// settings are redacted
+func (sc *SensorThingsConnector) GetTemplates() ([]*models.ConnectorTemplate, error) {
+	t := sc.sortedTemplates()
+	for i, template := range t {
+		t[i] = sc.redactTemplate(template)
+	}
+
+	return t, nil
+}
+
+// GetTemplate retrieves a connector template by id, the secrets in the settings are redacted
+func (sc *SensorThingsConnector) GetTemplate(id string) (*models.ConnectorTemplate, error) {
+	t, err := sc.findTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return sc.redactTemplate(t), nil
+}
+
+// findTemplate returns the stored template with the given id or a not found error
+func (sc *SensorThingsConnector) findTemplate(id string) (*models.ConnectorTemplate, error) {
+	t, ok := sc.lookupTemplate(id)
+	if !ok {
+		return nil, connectorErrors.NewRequestNotFound(fmt.Errorf("Template %s not found", id))
+	}
+
+	return t, nil
+}
+
+// sortedTemplates returns the stored templates ordered by name and id
+func (sc *SensorThingsConnector) sortedTemplates() []*models.ConnectorTemplate {
+	t := sc.listTemplates()
+	sort.Slice(t, func(i, j int) bool {
+		if t[i].Name != t[j].Name {
+			return t[i].Name < t[j].Name
+		}
+
+		return t[i].ID < t[j].ID
+	})
+
+	return t
+}
+
+// CreateTemplate checks if the module of a template exists and adds the template to the database,
+// the created template is returned with redacted secrets
+func (sc *SensorThingsConnector) CreateTemplate(template *models.ConnectorTemplate) (*models.ConnectorTemplate, error) {
+	if _, ok := sc.typeRegistry[template.ModuleName]; !ok {
+		return nil, connectorErrors.NewBadRequestError(fmt.Errorf("Module %s not found", template.ModuleName))
+	}
+
+	var settings interface{}
+	if err := json.Unmarshal(template.Settings, &settings); err != nil {
+		return nil, connectorErrors.NewBadRequestError(errors.New("Unable to parse template settings"))
+	}
+
+	template.ID = RandomString(8)
+	if err := sc.db.InsertTemplate(template); err != nil {
+		return nil, connectorErrors.NewRequestInternalServerError(err)
+	}
+
+	sc.storeTemplate(template)
+	log.Printf("Template created: %v", template.Name)
+	return sc.redactTemplate(template), nil
+}
+
+// DeleteTemplate deletes a connector template, connectors created from the template are not affected
+func (sc *SensorThingsConnector) DeleteTemplate(id string) error {
+	if _, err := sc.findTemplate(id); err != nil {
 		return err
 	}
 
-	if sc.connectors[id].GetIsRunning() {
-		sc.connectors[id].Stop()
+	sc.removeTemplate(id)
+	return sc.db.DeleteTemplate(id)
+}
+
+// CreateConnectorFromTemplate creates a new connector using the settings of a template filled
+// with the given variables
+func (sc *SensorThingsConnector) CreateConnectorFromTemplate(ctx context.Context, instance *models.TemplateInstance) (models.Connector, error) {
+	template, err := sc.findTemplate(instance.Template)
+	if err != nil {
+		return nil, connectorErrors.NewBadRequestError(err)
 	}
 
-	delete(sc.connectors, id)
+	settings, err := template.Instantiate(instance.Variables)
+	if err != nil {
+		return nil, connectorErrors.NewBadRequestError(err)
+	}
+
+	connector := &models.ConnectorBase{
+		Name:        instance.Name,
+		Description: instance.Description,
+		ModuleName:  template.ModuleName,
+		Settings:    settings,
+	}
+
+	if len(connector.Name) == 0 {
+		connector.Name = template.Name
+	}
+
+	return sc.CreateConnector(ctx, connector)
+}
+
+// GetRoleAssignments retrieves all role assignments ordered by identity and method
+func (sc *SensorThingsConnector) GetRoleAssignments() ([]*models.RoleAssignment, error) {
+	sc.rolesMutex.RLock()
+	defer sc.rolesMutex.RUnlock()
+
+	a := make([]*models.RoleAssignment, 0, len(sc.roles))
+	for _, value := range sc.roles {
+		a = append(a, value)
+	}
+
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].Identity != a[j].Identity {
+			return a[i].Identity < a[j].Identity
+		}
+
+		return a[i].Method < a[j].Method
+	})
+
+	return a, nil
+}
+
+// GetRoleAssignment retrieves the role assignment of an identity authenticated with method
+func (sc *SensorThingsConnector) GetRoleAssignment(method string, identity string) (*models.RoleAssignment, error) {
+	sc.rolesMutex.RLock()
+	defer sc.rolesMutex.RUnlock()
+
+	a, ok := sc.roles[models.RoleAssignmentKey(method, identity)]
+	if !ok || len(method) == 0 {
+		return nil, connectorErrors.NewRequestNotFound(fmt.Errorf("No role assigned to %s %s", method, identity))
+	}
+
+	return a, nil
+}
+
+// SetRoleAssignment assigns a role to an identity authenticated with the method of the assignment,
+// an existing assignment is replaced
+func (sc *SensorThingsConnector) SetRoleAssignment(assignment *models.RoleAssignment) (*models.RoleAssignment, error) {
+	if len(assignment.Identity) == 0 {
+		return nil, connectorErrors.NewBadRequestError(errors.New("Identity is required"))
+	}
+
+	if !models.IsAuthMethod(assignment.Method) {
+		return nil, connectorErrors.NewBadRequestError(fmt.Errorf("Unknown authentication method %s, use %s, %s, %s or %s",
+			assignment.Method, models.AuthMethodAPIKey, models.AuthMethodBasic, models.AuthMethodJWT, models.AuthMethodCertificate))
+	}
+
+	if !assignment.Role.IsValid() {
+		return nil, connectorErrors.NewBadRequestError(fmt.Errorf("Unknown role %s", assignment.Role))
+	}
+
+	sc.rolesMutex.Lock()
+	defer sc.rolesMutex.Unlock()
+
+	if err := sc.db.InsertRoleAssignment(assignment); err != nil {
+		return nil, connectorErrors.NewRequestInternalServerError(err)
+	}
+
+	sc.roles[assignment.Key()] = assignment
+	log.Printf("Role %v assigned to %v %v", assignment.Role, assignment.Method, assignment.Identity)
+	return assignment, nil
+}
+
+// DeleteRoleAssignment removes the role assignment of an identity authenticated with method, the identity
+// falls back to the role from the auth config
+func (sc *SensorThingsConnector) DeleteRoleAssignment(method string, identity string) error {
+	if _, err := sc.GetRoleAssignment(method, identity); err != nil {
+		return err
+	}
+
+	sc.rolesMutex.Lock()
+	defer sc.rolesMutex.Unlock()
+
+	delete(sc.roles, models.RoleAssignmentKey(method, identity))
+	return sc.db.DeleteRoleAssignment(method, identity)
+}
+
+// TestConnector runs a one-shot test on a new instance of the module used by the connector
+// with the given id, the running connector is not affected and nothing will be published
+func (sc *SensorThingsConnector) TestConnector(id string) (*models.ConnectorTestResult, error) {
+	stored, err := sc.findConnector(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return sc.testConnector(stored.Copy())
+}
+
+// TestConnectorSettings runs a one-shot test for a connector that is not saved, this can be
+// used to check the settings before creating or changing a connector. When the id of an existing
+// connector is given redacted secrets are replaced by the secrets of that connector, but only when
+// all other settings are equal to the stored settings so secrets can not be sent to another host
+func (sc *SensorThingsConnector) TestConnectorSettings(connector *models.ConnectorBase) (*models.ConnectorTestResult, error) {
+	if bytes.Contains(connector.Settings, []byte(models.RedactedValue)) {
+		stored, err := sc.findConnector(connector.ID)
+		if err != nil || stored.ModuleName != connector.ModuleName ||
+			!jsonEqual(sc.redactSettings(stored.ModuleName, stored.GetSettings()), sc.redactSettings(connector.ModuleName, connector.Settings)) {
+			return nil, connectorErrors.NewBadRequestError(errors.New("Redacted secrets can only be tested with the unchanged settings of an existing connector"))
+		}
+
+		if err := sc.restoreSecrets(stored, connector); err != nil {
+			return nil, err
+		}
+	}
+
+	return sc.testConnector(connector)
+}
+
+// DeleteConnector stops the given connector if running and deletes it from the database,
+// read-only connectors can not be deleted
+func (sc *SensorThingsConnector) DeleteConnector(ctx context.Context, id string) error {
+	unlock := sc.lockConnector(id)
+	defer unlock()
+
+	c, err := sc.writableConnector(id)
+	if err != nil {
+		return err
+	}
+
+	sc.deleteConnector(ctx, c)
+	return nil
+}
+
+// deleteConnector stops and deletes an existing connector, closes its live feed and log, removes its
+// metrics and records the deletion, the caller holds the lock of the connector
+func (sc *SensorThingsConnector) deleteConnector(ctx context.Context, c *models.ConnectorBase) {
+	id := c.ID
+	before := connectorDefinition(c)
+	if c.GetIsRunning() {
+		if err := c.Stop(); err != nil {
+			log.Printf("%v", err.Error())
+		}
+	}
+
+	sc.removeConnector(id)
 	sc.db.DeleteConnector(id)
+	sc.releaseConnector(id)
+	sc.audit(ctx, models.AuditActionDelete, before, nil)
+}
+
+// releaseConnector closes the live feed and log and removes the metrics of a connector that is deleted or
+// could not be added
+func (sc *SensorThingsConnector) releaseConnector(id string) {
+	sc.feedsMutex.Lock()
+	if feed, ok := sc.feeds[id]; ok {
+		feed.Close()
+		delete(sc.feeds, id)
+	}
+	sc.feedsMutex.Unlock()
+
+	sc.metricsMutex.Lock()
+	delete(sc.metrics, id)
+	sc.metricsMutex.Unlock()
+	models.DeleteConnectorMetrics(id)
+
+	sc.logsMutex.Lock()
+	if logs, ok := sc.logs[id]; ok {
+		logs.Close()
+		delete(sc.logs, id)
+	}
+	sc.logsMutex.Unlock()
+}
+
+// GetLiveFeed retrieves the live feed of a connector, the feed is kept when the connector
+// is changed and closed when the connector is deleted
+func (sc *SensorThingsConnector) GetLiveFeed(id string) (*models.LiveFeed, error) {
+	if _, err := sc.findConnector(id); err != nil {
+		return nil, err
+	}
+
+	return sc.liveFeed(id), nil
+}
+
+// liveFeed returns the live feed for the connector with the given id, the feed is created
+// when it does not exist yet
+func (sc *SensorThingsConnector) liveFeed(id string) *models.LiveFeed {
+	sc.feedsMutex.Lock()
+	defer sc.feedsMutex.Unlock()
+
+	feed, ok := sc.feeds[id]
+	if !ok {
+		feed = models.CreateLiveFeed()
+		sc.feeds[id] = feed
+	}
+
+	return feed
+}
+
+// GetConnectorStatus retrieves the lifecycle state and statistics of a connector
+func (sc *SensorThingsConnector) GetConnectorStatus(id string) (*models.ConnectorStatus, error) {
+	c, err := sc.findConnector(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GetStatus(), nil
+}
+
+// GetConnectorLogs retrieves the log of a connector, the log is kept when the connector is changed
+// and closed when the connector is deleted
+func (sc *SensorThingsConnector) GetConnectorLogs(id string) (*logging.Buffer, error) {
+	if _, err := sc.findConnector(id); err != nil {
+		return nil, err
+	}
+
+	return sc.connectorLogs(id), nil
+}
+
+// connectorLogs returns the log buffer for the connector with the given id, the buffer is created
+// when it does not exist yet
+func (sc *SensorThingsConnector) connectorLogs(id string) *logging.Buffer {
+	sc.logsMutex.Lock()
+	defer sc.logsMutex.Unlock()
+
+	logs, ok := sc.logs[id]
+	if !ok {
+		logs = logging.CreateBuffer(sc.logBufferSize)
+		sc.logs[id] = logs
+	}
+
+	return logs
+}
+
+// connectorLogger returns a logger which adds its entries to the log of the given connector
+func (sc *SensorThingsConnector) connectorLogger(connector *models.ConnectorBase) *logging.Logger {
+	return logging.CreateLogger(connector.ID, connector.GetModuleName(), sc.connectorLogs(connector.ID))
+}
+
+// connectorMetrics returns the metrics for the connector with the given id, the metrics are created when
+// they do not exist yet or when the module of the connector changed so statistics are kept when a connector
+// is changed
+func (sc *SensorThingsConnector) connectorMetrics(id string, module string) *models.ConnectorMetrics {
+	sc.metricsMutex.Lock()
+	defer sc.metricsMutex.Unlock()
+
+	cm, ok := sc.metrics[id]
+	if !ok || cm.GetModuleName() != module {
+		if ok {
+			models.DeleteConnectorMetrics(id)
+		}
+
+		cm = models.CreateConnectorMetrics(id, module)
+		sc.metrics[id] = cm
+	}
+
+	return cm
+}
+
+// lookupConnector returns the connector with the given id
+func (sc *SensorThingsConnector) lookupConnector(id string) (models.Connector, bool) {
+	sc.connectorsMutex.RLock()
+	defer sc.connectorsMutex.RUnlock()
+
+	c, ok := sc.connectors[id]
+	return c, ok
+}
+
+// listConnectors returns all connectors in no particular order
+func (sc *SensorThingsConnector) listConnectors() []models.Connector {
+	sc.connectorsMutex.RLock()
+	defer sc.connectorsMutex.RUnlock()
+
+	v := make([]models.Connector, 0, len(sc.connectors))
+	for _, value := range sc.connectors {
+		v = append(v, value)
+	}
+
+	return v
+}
+
+// storeConnector adds a connector or replaces the connector with the same id
+func (sc *SensorThingsConnector) storeConnector(connector models.Connector) {
+	sc.connectorsMutex.Lock()
+	defer sc.connectorsMutex.Unlock()
+
+	sc.connectors[connector.GetID()] = connector
+}
+
+// removeConnector removes the connector with the given id
+func (sc *SensorThingsConnector) removeConnector(id string) {
+	sc.connectorsMutex.Lock()
+	defer sc.connectorsMutex.Unlock()
+
+	delete(sc.connectors, id)
+}
+
+// lookupTemplate returns the template with the given id
+func (sc *SensorThingsConnector) lookupTemplate(id string) (*models.ConnectorTemplate, bool) {
+	sc.templatesMutex.RLock()
+	defer sc.templatesMutex.RUnlock()
+
+	t, ok := sc.templates[id]
+	return t, ok
+}
+
+// listTemplates returns all templates in no particular order
+func (sc *SensorThingsConnector) listTemplates() []*models.ConnectorTemplate {
+	sc.templatesMutex.RLock()
+	defer sc.templatesMutex.RUnlock()
+
+	t := make([]*models.ConnectorTemplate, 0, len(sc.templates))
+	for _, value := range sc.templates {
+		t = append(t, value)
+	}
+
+	return t
+}
+
+// storeTemplate adds a template or replaces the template with the same id
+func (sc *SensorThingsConnector) storeTemplate(template *models.ConnectorTemplate) {
+	sc.templatesMutex.Lock()
+	defer sc.templatesMutex.Unlock()
+
+	sc.templates[template.ID] = template
+}
+
+// removeTemplate removes the template with the given id
+func (sc *SensorThingsConnector) removeTemplate(id string) {
+	sc.templatesMutex.Lock()
+	defer sc.templatesMutex.Unlock()
+
+	delete(sc.templates, id)
+}
+
+// lockConnector locks the connector with the given id for a change and returns the function that unlocks
+// it. Changes of a connector, from checking its revision until it is replaced, are made one at a time while
+// other connectors can be changed at the same time
+func (sc *SensorThingsConnector) lockConnector(id string) func() {
+	sc.connectorLocksMutex.Lock()
+	l, ok := sc.connectorLocks[id]
+	if !ok {
+		l = &connectorLock{}
+		sc.connectorLocks[id] = l
+	}
+
+	l.refs++
+	sc.connectorLocksMutex.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		sc.connectorLocksMutex.Lock()
+		defer sc.connectorLocksMutex.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(sc.connectorLocks, id)
+		}
+	}
+}
+
+// findConnector returns the connector with the given id, a HTTP RequestNotFound is returned
+// when there is no such connector
+func (sc *SensorThingsConnector) findConnector(id string) (*models.ConnectorBase, error) {
+	c, ok := sc.lookupConnector(id)
+	if !ok {
+		return nil, connectorErrors.NewRequestNotFound(errors.New(fmt.Sprintf("Connector %s not found", id)))
+	}
+
+	return c.(*models.ConnectorBase), nil
+}
+
+// writableConnector returns the connector with the given id when it is not read-only,
+// a HTTP Conflict is returned for a connector that is managed by a file
+func (sc *SensorThingsConnector) writableConnector(id string) (*models.ConnectorBase, error) {
+	c, err := sc.findConnector(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.IsReadOnly() {
+		return nil, connectorErrors.NewConflictError(fmt.Errorf("Connector %s is read-only, it is managed by %s", id, c.Source))
+	}
+
+	return c, nil
+}
+
+// checkRevision checks if a connector has the expected revision, a revision of 0 matches every
+// revision. A HTTP PreconditionFailed is returned when the connector has been changed
+func checkRevision(c *models.ConnectorBase, revision int64) error {
+	if current := c.GetRevision(); revision != 0 && revision != current {
+		return connectorErrors.NewPreconditionFailedError(fmt.Errorf("Connector %s has been changed, the current revision is %d", c.ID, current))
+	}
 
 	return nil
 }
 
-// checkConnectorExist checks if there is a connector for the given id if not
-// a HTTP RequestNotFound is returned
-func (sc *SensorThingsConnector) checkConnectorExist(id string) (bool, error) {
-	if _, ok := sc.connectors[id]; !ok {
-		return false, connectorErrors.NewRequestNotFound(errors.New(fmt.Sprintf("Connector %s not found", id)))
+// testConnector instantiates the module for the given connector and runs the test, messages sent by
+// the module are collected into the result instead of being passed to the publish client. The context
+// of the test is cancelled on return so module goroutines that are still sending will exit
+func (sc *SensorThingsConnector) testConnector(connector *models.ConnectorBase) (*models.ConnectorTestResult, error) {
+	// without id the module is not given the live feed and metrics of a saved connector
+	connector.ID = ""
+	if err := sc.setupConnector(connector); err != nil {
+		return nil, connectorErrors.NewBadRequestError(err)
 	}
 
-	return true, nil
+	tester, ok := connector.GetModule().(models.ConnectorModuleTester)
+	if !ok {
+		return nil, connectorErrors.NewRequestNotImplemented(fmt.Errorf("Module %s does not support testing", connector.GetModuleName()))
+	}
+
+	if err := connector.GetModule().SettingsChanged(connector.GetSettings()); err != nil {
+		return nil, connectorErrors.NewBadRequestError(err)
+	}
+
+	testChannel := make(chan *models.PublishMessage)
+	connector.GetModule().SetPublishChannel(testChannel)
+	connector.GetModule().SetLiveFeed(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectorTestTimeout)
+	defer cancel()
+
+	// done is buffered so the test goroutine can finish after a timeout
+	done := make(chan []error, 1)
+	go func() {
+		done <- tester.Test(ctx)
+	}()
+
+	result := &models.ConnectorTestResult{
+		Observations: make([]*models.PublishMessage, 0),
+		Errors:       make([]string, 0),
+	}
+
+	for {
+		select {
+		case pm := <-testChannel:
+			result.Observations = append(result.Observations, pm)
+		case errs := <-done:
+			for _, err := range errs {
+				result.Errors = append(result.Errors, err.Error())
+			}
+
+			result.Success = len(result.Errors) == 0
+			return result, nil
+		case <-ctx.Done():
+			go drainTest(testChannel, done)
+			return nil, connectorErrors.NewErrorWithStatusCode(fmt.Errorf("Connector test did not complete within %v", connectorTestTimeout), http.StatusGatewayTimeout)
+		}
+	}
+}
+
+// drainTest receives the messages a module sends after its test timed out until the test returns,
+// so module goroutines that are still sending do not block forever
+func drainTest(testChannel chan *models.PublishMessage, done chan []error) {
+	for {
+		select {
+		case <-testChannel:
+		case <-done:
+			return
+		}
+	}
 }
 
 // setupConnector creates a working connector from ConnectorBase by searching for the used module
-// and instantiating the module using reflection, if the given module from ConnectorBase is not
-// present an error will return
+// and instantiating the module from the type registry, if the given module from ConnectorBase is not
+// present an error will return. Modules of saved connectors are given the live feed, metrics and logger of the connector
 func (sc *SensorThingsConnector) setupConnector(connector *models.ConnectorBase) error {
-	if t, ok := sc.typeRegistry[connector.GetModuleName()]; !ok {
+	if newModule, ok := sc.typeRegistry[connector.GetModuleName()]; !ok {
 		return errors.New(fmt.Sprintf("Error initialising %v, module: %v not found", connector.GetName(), connector.ModuleName))
 	} else {
-		newObjPtr := reflect.New(t.Elem())
-		mod := newObjPtr.Interface().(models.ConnectorModule)
+		mod := newModule()
 		mod.Setup()
 		mod.SetPublishChannel(sc.pubChannel)
+		if len(connector.ID) > 0 {
+			mod.SetLiveFeed(sc.liveFeed(connector.ID))
+			mod.SetMetrics(sc.connectorMetrics(connector.ID, connector.GetModuleName()))
+			mod.SetLogger(sc.connectorLogger(connector))
+		}
+
 		connector.Module = mod
 	}
 
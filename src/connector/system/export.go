@@ -0,0 +1,365 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+
+	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// Export creates a bundle holding all connectors and templates, when redact is true all
+// secrets in the settings are replaced by RedactedValue
+func (sc *SensorThingsConnector) Export(redact bool) (*models.ConfigBundle, error) {
+	connectors, _ := sc.GetConnectors()
+	bundle := &models.ConfigBundle{
+		Version:    models.ConfigBundleVersion,
+		Connectors: make([]models.ConnectorDefinition, 0, len(connectors)),
+	}
+
+	for _, c := range connectors {
+		def := c.(*models.ConnectorBase).GetDefinition()
+		if redact {
+			def.Settings = sc.redactSettings(def.ModuleName, def.Settings)
+		}
+
+		bundle.Connectors = append(bundle.Connectors, def)
+	}
+
+	for _, t := range sc.sortedTemplates() {
+		template := *t
+		if redact {
+			template = *sc.redactTemplate(t)
+		}
+
+		bundle.Templates = append(bundle.Templates, &template)
+	}
+
+	return bundle, nil
+}
+
+// Import applies a bundle created by Export, connectors and templates are matched by id. Items in the
+// bundle are created or changed, when replace is true items that are not in the bundle are deleted.
+// Redacted secrets keep their stored value and read-only connectors can not be changed. All connectors are validated before anything is changed,
+// when dryRun is true only the changes that would be made are reported. A change that fails does not stop the import, the
+// error is reported on the change in the result
+func (sc *SensorThingsConnector) Import(ctx context.Context, bundle *models.ConfigBundle, replace bool, dryRun bool) (*models.ImportResult, error) {
+	if bundle.Version != models.ConfigBundleVersion {
+		return nil, connectorErrors.NewBadRequestError(fmt.Errorf("Unsupported bundle version %d", bundle.Version))
+	}
+
+	result := &models.ImportResult{DryRun: dryRun, Connectors: newImportChanges(), Templates: newImportChanges()}
+	connectors, err := sc.planConnectorImport(bundle.Connectors, replace, &result.Connectors)
+	if err != nil {
+		return nil, connectorErrors.NewBadRequestError(err)
+	}
+
+	templates, err := sc.planTemplateImport(bundle.Templates, replace, &result.Templates)
+	if err != nil {
+		return nil, connectorErrors.NewBadRequestError(err)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	applyImportChanges(result, result.Connectors.Deleted, func(change models.ImportChange) error {
+		return sc.DeleteConnector(ctx, change.ID)
+	})
+
+	applyImportChanges(result, result.Connectors.Created, func(change models.ImportChange) error {
+		return sc.importConnector(ctx, connectors[change.ID].ToConnector())
+	})
+
+	applyImportChanges(result, result.Connectors.Changed, func(change models.ImportChange) error {
+		unlock := sc.lockConnector(change.ID)
+		defer unlock()
+
+		return sc.applyConnectorChange(ctx, connectors[change.ID].ToConnector(), change.Fields)
+	})
+
+	applyImportChanges(result, result.Templates.Deleted, func(change models.ImportChange) error {
+		return sc.DeleteTemplate(change.ID)
+	})
+
+	saveTemplate := func(change models.ImportChange) error {
+		if err := sc.db.InsertTemplate(templates[change.ID]); err != nil {
+			return connectorErrors.NewRequestInternalServerError(err)
+		}
+
+		sc.storeTemplate(templates[change.ID])
+		return nil
+	}
+
+	applyImportChanges(result, result.Templates.Created, saveTemplate)
+	applyImportChanges(result, result.Templates.Changed, saveTemplate)
+
+	log.Printf("Imported %d connectors and %d templates, %d changes failed", len(bundle.Connectors), len(bundle.Templates), result.Failed)
+	return result, nil
+}
+
+// applyImportChanges applies every change using apply, the error of a change that fails is set on the
+// change and counted in the result
+func applyImportChanges(result *models.ImportResult, changes []models.ImportChange, apply func(change models.ImportChange) error) {
+	for i := range changes {
+		if err := apply(changes[i]); err != nil {
+			changes[i].Error = errorContent(err)
+			result.Failed++
+		}
+	}
+}
+
+// importConnector adds a connector of a bundle and starts it when it is running in the bundle
+func (sc *SensorThingsConnector) importConnector(ctx context.Context, connector *models.ConnectorBase) error {
+	unlock := sc.lockConnector(connector.ID)
+	defer unlock()
+
+	con, err := sc.addConnector(ctx, connector)
+	if err != nil {
+		return err
+	}
+
+	if con.GetIsRunning() {
+		con.Start()
+	}
+
+	return nil
+}
+
+func newImportChanges() models.ImportChanges {
+	return models.ImportChanges{
+		Created: make([]models.ImportChange, 0),
+		Changed: make([]models.ImportChange, 0),
+		Deleted: make([]models.ImportChange, 0),
+	}
+}
+
+// planConnectorImport validates the connectors of a bundle and determines which connectors are created,
+// changed and deleted, the validated definitions are returned by id
+func (sc *SensorThingsConnector) planConnectorImport(definitions []models.ConnectorDefinition, replace bool, changes *models.ImportChanges) (map[string]models.ConnectorDefinition, error) {
+	planned := make(map[string]models.ConnectorDefinition)
+	for _, def := range definitions {
+		if len(def.ID) == 0 {
+			def.ID = RandomString(8)
+		}
+
+		if _, ok := planned[def.ID]; ok {
+			return nil, fmt.Errorf("Connector %s occurs more than once", def.ID)
+		}
+
+		var stored, redacted json.RawMessage
+		existing, exists := sc.lookupConnector(def.ID)
+		if exists {
+			stored = existing.GetSettings()
+			redacted = sc.redactSettings(existing.(*models.ConnectorBase).ModuleName, stored)
+		}
+
+		settings, ok := restoreRedacted(def.Settings, stored, redacted)
+		if !ok {
+			return nil, fmt.Errorf("Connector %s contains redacted secrets without a stored value or with changed settings beside them", def.Name)
+		}
+
+		def.Settings = settings
+		if err := sc.validateDefinition(def); err != nil {
+			return nil, fmt.Errorf("Connector %s: %v", def.Name, err)
+		}
+
+		planned[def.ID] = def
+		if !exists {
+			changes.Created = append(changes.Created, models.ImportChange{ID: def.ID, Name: def.Name})
+		} else if fields := connectorChanges(existing.(*models.ConnectorBase).GetDefinition(), def); len(fields) > 0 {
+			if base := existing.(*models.ConnectorBase); base.IsReadOnly() {
+				return nil, fmt.Errorf("Connector %s is read-only, it is managed by %s", def.Name, base.Source)
+			}
+
+			changes.Changed = append(changes.Changed, models.ImportChange{ID: def.ID, Name: def.Name, Fields: fields})
+		}
+	}
+
+	if replace {
+		for _, c := range sc.listConnectors() {
+			if _, ok := planned[c.GetID()]; !ok && !c.(*models.ConnectorBase).IsReadOnly() {
+				changes.Deleted = append(changes.Deleted, models.ImportChange{ID: c.GetID(), Name: c.GetName()})
+			}
+		}
+	}
+
+	sortChanges(changes)
+	return planned, nil
+}
+
+// planTemplateImport validates the templates of a bundle and determines which templates are created,
+// changed and deleted, the templates are returned by id
+func (sc *SensorThingsConnector) planTemplateImport(templates []*models.ConnectorTemplate, replace bool, changes *models.ImportChanges) (map[string]*models.ConnectorTemplate, error) {
+	planned := make(map[string]*models.ConnectorTemplate)
+	for _, t := range templates {
+		if len(t.ID) == 0 {
+			t.ID = RandomString(8)
+		}
+
+		if _, ok := planned[t.ID]; ok {
+			return nil, fmt.Errorf("Template %s occurs more than once", t.ID)
+		}
+
+		var stored, redacted json.RawMessage
+		existing, exists := sc.lookupTemplate(t.ID)
+		if exists {
+			stored = existing.Settings
+			redacted = sc.redactTemplate(existing).Settings
+		}
+
+		settings, ok := restoreRedacted(t.Settings, stored, redacted)
+		if !ok {
+			return nil, fmt.Errorf("Template %s contains redacted secrets without a stored value or with changed settings beside them", t.Name)
+		}
+
+		t.Settings = settings
+		if err := sc.validateTemplate(t); err != nil {
+			return nil, fmt.Errorf("Template %s: %v", t.Name, err)
+		}
+
+		planned[t.ID] = t
+		if !exists {
+			changes.Created = append(changes.Created, models.ImportChange{ID: t.ID, Name: t.Name})
+		} else if fields := templateChanges(existing, t); len(fields) > 0 {
+			changes.Changed = append(changes.Changed, models.ImportChange{ID: t.ID, Name: t.Name, Fields: fields})
+		}
+	}
+
+	if replace {
+		for _, t := range sc.listTemplates() {
+			if _, ok := planned[t.ID]; !ok {
+				changes.Deleted = append(changes.Deleted, models.ImportChange{ID: t.ID, Name: t.Name})
+			}
+		}
+	}
+
+	sortChanges(changes)
+	return planned, nil
+}
+
+// validateDefinition checks if the module of a connector exists and accepts the settings
+func (sc *SensorThingsConnector) validateDefinition(def models.ConnectorDefinition) error {
+	newModule, ok := sc.typeRegistry[def.ModuleName]
+	if !ok {
+		return fmt.Errorf("module %s not found", def.ModuleName)
+	}
+
+	module := newModule()
+	module.Setup()
+	return module.SettingsChanged(def.Settings)
+}
+
+// validateTemplate checks that the module of a template exists and its settings are JSON, when all variables
+// have a default value the settings filled with the defaults are checked by the module as well
+func (sc *SensorThingsConnector) validateTemplate(t *models.ConnectorTemplate) error {
+	if _, ok := sc.typeRegistry[t.ModuleName]; !ok {
+		return fmt.Errorf("module %s not found", t.ModuleName)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(t.Settings, &doc); err != nil {
+		return errors.New("unable to parse template settings")
+	}
+
+	// the value of a variable without default is only known when a connector is created from the template
+	settings, err := t.Instantiate(nil)
+	if err != nil {
+		return nil
+	}
+
+	return sc.validateDefinition(models.ConnectorDefinition{ModuleName: t.ModuleName, Settings: settings})
+}
+
+// applyConnectorChange replaces an existing connector with the given connector, the connector is only
+// restarted when more than its running state changed. The caller holds the lock of the connector
+func (sc *SensorThingsConnector) applyConnectorChange(ctx context.Context, connector *models.ConnectorBase, fields []string) error {
+	existing, err := sc.findConnector(connector.ID)
+	if err != nil {
+		return err
+	}
+
+	running := connector.Running
+	if len(fields) > 1 || fields[0] != "running" {
+		if _, err := sc.patchConnector(ctx, existing, connector); err != nil {
+			return err
+		}
+
+		existing = connector
+	}
+
+	if existing.GetIsRunning() != running {
+		return sc.setConnectorState(ctx, existing, running)
+	}
+
+	return nil
+}
+
+// connectorChanges returns the names of the fields that differ between two connector definitions
+func connectorChanges(a, b models.ConnectorDefinition) []string {
+	fields := make([]string, 0)
+	if a.Name != b.Name {
+		fields = append(fields, "name")
+	}
+
+	if a.Description != b.Description {
+		fields = append(fields, "description")
+	}
+
+	if a.ModuleName != b.ModuleName {
+		fields = append(fields, "module")
+	}
+
+	if a.Running != b.Running {
+		fields = append(fields, "running")
+	}
+
+	if !jsonEqual(a.Settings, b.Settings) {
+		fields = append(fields, "settings")
+	}
+
+	if (len(a.Labels) > 0 || len(b.Labels) > 0) && !reflect.DeepEqual(a.Labels, b.Labels) {
+		fields = append(fields, "labels")
+	}
+
+	return fields
+}
+
+// templateChanges returns the names of the fields that differ between two templates
+func templateChanges(a, b *models.ConnectorTemplate) []string {
+	fields := make([]string, 0)
+	if a.Name != b.Name {
+		fields = append(fields, "name")
+	}
+
+	if a.Description != b.Description {
+		fields = append(fields, "description")
+	}
+
+	if a.ModuleName != b.ModuleName {
+		fields = append(fields, "module")
+	}
+
+	if !jsonEqual(a.Settings, b.Settings) {
+		fields = append(fields, "settings")
+	}
+
+	va, _ := json.Marshal(a.Variables)
+	vb, _ := json.Marshal(b.Variables)
+	if (len(a.Variables) > 0 || len(b.Variables) > 0) && !jsonEqual(va, vb) {
+		fields = append(fields, "variables")
+	}
+
+	return fields
+}
+
+func sortChanges(changes *models.ImportChanges) {
+	for _, list := range [][]models.ImportChange{changes.Created, changes.Changed, changes.Deleted} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	}
+}
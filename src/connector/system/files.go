@@ -0,0 +1,134 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tebben/sensorthings-connector/src/connector/config"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// defaultConnectorFilesInterval is the interval in which the connector files are checked when no
+// interval is configured
+const defaultConnectorFilesInterval = 10 * time.Second
+
+// reconcileConnectorFiles creates, updates, starts, stops and deletes connectors to match the connector
+// files. Connectors that were created from a file which is removed are deleted, connectors of a file that
+// can not be read or is invalid are left untouched. Connectors created using the REST API are not affected
+// unless a file defines a connector with the same id, the connector is then managed by the file
+func (sc *SensorThingsConnector) reconcileConnectorFiles() {
+	files, err := config.ReadConnectorFiles(sc.files.Directory)
+	if err != nil {
+		log.Printf("Unable to read connector files: %v", err.Error())
+		return
+	}
+
+	defined := make(map[string]bool)
+	failed := make(map[string]bool)
+	for _, file := range files {
+		if file.Err == nil && defined[file.Definition.ID] {
+			file.Err = fmt.Errorf("connector %s is already defined by another file", file.Definition.ID)
+		}
+
+		if file.Err == nil {
+			file.Err = sc.applyConnectorFile(file.Path, file.Definition)
+		}
+
+		if file.Err != nil {
+			log.Printf("Connector file %s: %v", file.Path, file.Err.Error())
+			failed[file.Path] = true
+			continue
+		}
+
+		defined[file.Definition.ID] = true
+	}
+
+	for _, c := range sc.listConnectors() {
+		source := c.(*models.ConnectorBase).Source
+		if len(source) > 0 && !defined[c.GetID()] && !failed[source] {
+			sc.deleteFileConnector(c.GetID(), source)
+		}
+	}
+}
+
+// deleteFileConnector deletes the connector with the given id when it is still managed by the removed file
+func (sc *SensorThingsConnector) deleteFileConnector(id string, source string) {
+	unlock := sc.lockConnector(id)
+	defer unlock()
+
+	c, err := sc.findConnector(id)
+	if err != nil || c.Source != source {
+		return
+	}
+
+	sc.deleteConnector(fileContext(source), c)
+	log.Printf("Connector deleted: %v, %v was removed", c.GetName(), source)
+}
+
+// applyConnectorFile creates or updates the connector defined by a file and sets its running state
+func (sc *SensorThingsConnector) applyConnectorFile(path string, def models.ConnectorDefinition) error {
+	if err := sc.validateDefinition(def); err != nil {
+		return err
+	}
+
+	unlock := sc.lockConnector(def.ID)
+	defer unlock()
+
+	ctx := fileContext(path)
+	connector := def.ToConnector()
+	connector.Source = path
+
+	existing, exists := sc.lookupConnector(def.ID)
+	if !exists {
+		con, err := sc.addConnector(ctx, connector)
+		if err != nil {
+			return err
+		}
+
+		if con.GetIsRunning() {
+			con.Start()
+		}
+
+		return nil
+	}
+
+	fields := connectorChanges(existing.(*models.ConnectorBase).GetDefinition(), def)
+	if existing.(*models.ConnectorBase).Source != path {
+		fields = append(fields, "source")
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	log.Printf("Connector %v changed by %v: %v", def.Name, path, fields)
+	return sc.applyConnectorChange(ctx, connector, fields)
+}
+
+// fileContext returns the context for changes made by a connector file, the changes are recorded
+// in the audit log with file:<path> as identity
+func fileContext(path string) context.Context {
+	return models.WithAuditActor(context.Background(), &models.AuditActor{Identity: "file:" + path})
+}
+
+// watchConnectorFiles checks the connector files for changes and reconciles the connectors when
+// a file is added, changed or removed
+func (sc *SensorThingsConnector) watchConnectorFiles() {
+	interval := sc.files.Interval * time.Second
+	if interval <= 0 {
+		interval = defaultConnectorFilesInterval
+	}
+
+	state, _ := config.ConnectorFilesState(sc.files.Directory)
+	for range time.Tick(interval) {
+		current, err := config.ConnectorFilesState(sc.files.Directory)
+		if err != nil || current == state {
+			continue
+		}
+
+		state = current
+		sc.reconcileConnectorFiles()
+	}
+}
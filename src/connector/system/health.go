@@ -0,0 +1,123 @@
+package system
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+// GetReadiness checks if the database is open, the publish client is connected and the running connectors
+// are healthy, the configured thresholds decide which problems make the connector not ready
+func (sc *SensorThingsConnector) GetReadiness() *models.Readiness {
+	readiness := &models.Readiness{
+		Status:        models.HealthStatusOK,
+		Database:      sc.checkDatabase(),
+		PublishBroker: sc.checkPublishBroker(),
+		Connectors:    sc.checkConnectors(),
+	}
+
+	for _, status := range []models.HealthStatus{readiness.Database.Status, readiness.PublishBroker.Status, readiness.Connectors.Status} {
+		if status != models.HealthStatusOK {
+			readiness.Status = models.HealthStatusDegraded
+		}
+	}
+
+	return readiness
+}
+
+// checkDatabase checks if the database can be read
+func (sc *SensorThingsConnector) checkDatabase() models.HealthCheck {
+	if err := sc.db.Check(); err != nil {
+		return models.HealthCheck{Status: models.HealthStatusDegraded, Message: err.Error()}
+	}
+
+	return models.HealthCheck{Status: models.HealthStatusOK}
+}
+
+// checkPublishBroker checks if the publish client is connected, a lost connection is tolerated during
+// the connection grace period or when the publish broker is ignored
+func (sc *SensorThingsConnector) checkPublishBroker() models.HealthCheck {
+	connected, since := sc.pubClient.ConnectionState()
+	if connected {
+		return models.HealthCheck{Status: models.HealthStatusOK}
+	}
+
+	check := models.HealthCheck{
+		Status:  models.HealthStatusDegraded,
+		Message: fmt.Sprintf("Not connected to %s since %s", sc.pubClient.Host, since.UTC().Format(time.RFC3339)),
+	}
+
+	if sc.healthConfig.IgnorePublishBroker || time.Since(since) < sc.connectionGrace() {
+		check.Status = models.HealthStatusOK
+	}
+
+	return check
+}
+
+// checkConnectors checks the health of every running connector, the check is degraded when more than
+// the maximum number of unhealthy connectors is reached
+func (sc *SensorThingsConnector) checkConnectors() models.ConnectorsHealthCheck {
+	check := models.ConnectorsHealthCheck{Status: models.HealthStatusOK, Unhealthy: make([]*models.ConnectorHealth, 0)}
+	for _, c := range sc.listConnectors() {
+		connector := c.(*models.ConnectorBase)
+		status := connector.GetStatus()
+		if status.State == models.ConnectorStateStopped {
+			continue
+		}
+
+		check.Running++
+		if message := sc.connectorProblem(connector, status); len(message) > 0 {
+			check.Unhealthy = append(check.Unhealthy, &models.ConnectorHealth{
+				ID:      connector.ID,
+				Name:    connector.Name,
+				State:   status.State,
+				Message: message,
+			})
+		}
+	}
+
+	if len(check.Unhealthy) == 0 {
+		return check
+	}
+
+	sort.Slice(check.Unhealthy, func(i, j int) bool { return check.Unhealthy[i].ID < check.Unhealthy[j].ID })
+	check.Message = fmt.Sprintf("%d of %d running connectors are unhealthy", len(check.Unhealthy), check.Running)
+	if max := sc.healthConfig.MaxUnhealthyConnectors; max >= 0 && len(check.Unhealthy) > max {
+		check.Status = models.HealthStatusDegraded
+	}
+
+	return check
+}
+
+// connectorProblem returns why a running connector is unhealthy, an empty string is returned for a healthy connector
+func (sc *SensorThingsConnector) connectorProblem(connector *models.ConnectorBase, status *models.ConnectorStatus) string {
+	if status.State == models.ConnectorStateFailed {
+		return status.Failure.Message
+	}
+
+	if health, ok := connector.Module.(models.ConnectorModuleHealth); ok {
+		if err := health.CheckHealth(sc.connectionGrace()); err != nil {
+			return err.Error()
+		}
+	}
+
+	if sc.healthConfig.StaleSeconds > 0 {
+		last := *status.StartedAt
+		if status.LastObservation != nil && status.LastObservation.Time.After(last) {
+			last = status.LastObservation.Time
+		}
+
+		if time.Since(last) > time.Duration(sc.healthConfig.StaleSeconds)*time.Second {
+			return fmt.Sprintf("No observation published since %s", last.UTC().Format(time.RFC3339))
+		}
+	}
+
+	return ""
+}
+
+// connectionGrace returns the time a connection to a broker may be lost before it makes the connector not ready
+func (sc *SensorThingsConnector) connectionGrace() time.Duration {
+	return time.Duration(sc.healthConfig.ConnectionGraceSeconds) * time.Second
+}
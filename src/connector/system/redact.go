@@ -0,0 +1,161 @@
+package system
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	connectorErrors "github.com/tebben/sensorthings-connector/src/connector/errors"
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+	"github.com/tebben/sensorthings-connector/src/connector/schema"
+)
+
+// RedactConnector returns a copy of a connector with the secrets in its settings replaced by RedactedValue,
+// the copy is used to return a connector in the REST API
+func (sc *SensorThingsConnector) RedactConnector(c models.Connector) models.Connector {
+	base, ok := c.(*models.ConnectorBase)
+	if !ok {
+		return c
+	}
+
+	redacted := base.Copy()
+	redacted.Settings = sc.redactSettings(base.ModuleName, base.Settings)
+	return redacted
+}
+
+// redactSettings replaces the secrets in the settings of a module by RedactedValue, modules implementing
+// ConnectorModuleRedactor redact their own settings. For other modules the string fields with format password
+// in the settings schema and the fields named like a secret are redacted
+func (sc *SensorThingsConnector) redactSettings(moduleName string, settings json.RawMessage) json.RawMessage {
+	module := sc.getModule(moduleName)
+	if redactor, ok := module.(models.ConnectorModuleRedactor); ok {
+		return redactor.RedactSettings(settings)
+	}
+
+	var doc interface{}
+	if json.Unmarshal(settings, &doc) != nil {
+		return settings
+	}
+
+	if s, ok := module.(models.ConnectorModuleSettingsSchema); ok {
+		doc = redactSchemaValue(doc, s.GetSettingsSchema())
+	}
+
+	redacted, err := json.Marshal(redactValue(doc))
+	if err != nil {
+		return settings
+	}
+
+	return redacted
+}
+
+// redactDefinition returns a copy of a connector definition with redacted settings, nil for no definition
+func (sc *SensorThingsConnector) redactDefinition(def *models.ConnectorDefinition) *models.ConnectorDefinition {
+	if def == nil {
+		return nil
+	}
+
+	redacted := *def
+	redacted.Settings = sc.redactSettings(def.ModuleName, def.Settings)
+	return &redacted
+}
+
+// redactTemplate returns a copy of a template with the secrets in its settings replaced by RedactedValue,
+// a secret that consists of a single template variable is not a secret and is kept
+func (sc *SensorThingsConnector) redactTemplate(t *models.ConnectorTemplate) *models.ConnectorTemplate {
+	redacted := *t
+	redacted.Settings = sc.redactSettings(t.ModuleName, t.Settings)
+
+	var doc, original interface{}
+	if json.Unmarshal(redacted.Settings, &doc) != nil || json.Unmarshal(t.Settings, &original) != nil {
+		return &redacted
+	}
+
+	if settings, err := json.Marshal(keepTemplateVariables(doc, original)); err == nil {
+		redacted.Settings = settings
+	}
+
+	return &redacted
+}
+
+// restoreSecrets replaces the redacted secrets in the settings of a connector by the secrets of the stored
+// connector, this way a redacted connector can be sent back without losing its secrets. A secret is only
+// restored when the settings beside it are unchanged
+func (sc *SensorThingsConnector) restoreSecrets(stored *models.ConnectorBase, connector *models.ConnectorBase) error {
+	if !bytes.Contains(connector.Settings, []byte(models.RedactedValue)) {
+		return nil
+	}
+
+	settings, ok := restoreRedacted(connector.Settings, stored.GetSettings(), sc.redactSettings(stored.ModuleName, stored.GetSettings()))
+	if !ok {
+		return connectorErrors.NewBadRequestError(errors.New("Unable to restore a redacted secret, the connector has no secret at the same position or the settings beside it changed"))
+	}
+
+	connector.Settings = settings
+	return nil
+}
+
+// getModule returns the added module with the given name, nil when there is no such module
+func (sc *SensorThingsConnector) getModule(name string) models.ConnectorModule {
+	for _, m := range sc.modules {
+		if m.GetName() == name {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// redactSchemaValue replaces the non empty strings in a decoded JSON value which have format password
+// in the schema by RedactedValue
+func redactSchemaValue(node interface{}, s *schema.Schema) interface{} {
+	if s == nil {
+		return node
+	}
+
+	switch n := node.(type) {
+	case string:
+		if s.Format == schema.FormatPassword && len(n) > 0 {
+			return models.RedactedValue
+		}
+	case map[string]interface{}:
+		for k, v := range n {
+			if property, ok := s.Properties[k]; ok {
+				n[k] = redactSchemaValue(v, property)
+			} else {
+				n[k] = redactSchemaValue(v, s.AdditionalProperties)
+			}
+		}
+	case []interface{}:
+		for i, v := range n {
+			n[i] = redactSchemaValue(v, s.Items)
+		}
+	}
+
+	return node
+}
+
+// keepTemplateVariables puts back the template variables of the original settings that are replaced
+// by RedactedValue in a decoded JSON value
+func keepTemplateVariables(node interface{}, original interface{}) interface{} {
+	switch n := node.(type) {
+	case string:
+		if s, ok := original.(string); ok && n == models.RedactedValue && models.IsTemplateVariable(s) {
+			return s
+		}
+	case map[string]interface{}:
+		o, _ := original.(map[string]interface{})
+		for k, v := range n {
+			n[k] = keepTemplateVariables(v, o[k])
+		}
+	case []interface{}:
+		o, _ := original.([]interface{})
+		for i, v := range n {
+			if i < len(o) {
+				n[i] = keepTemplateVariables(v, o[i])
+			}
+		}
+	}
+
+	return node
+}
@@ -0,0 +1,35 @@
+package system
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
+)
+
+func TestRedactTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		expected string
+	}{
+		{"secret redacted", `{"host":"a","password":"secret"}`, `{"host":"a","password":"********"}`},
+		{"variable kept", `{"password":"${password}","token":"${a}${b}"}`, `{"password":"${password}","token":"********"}`},
+		{"variable in a string redacted", `{"password":"prefix-${password}"}`, `{"password":"********"}`},
+		{"nested variable kept", `{"brokers":[{"password":"${p}"},{"password":"x"}]}`, `{"brokers":[{"password":"${p}"},{"password":"********"}]}`},
+		{"settings that are not JSON", `{"password":`, `{"password":`},
+	}
+
+	sc := &SensorThingsConnector{}
+	for _, test := range tests {
+		template := &models.ConnectorTemplate{ID: "1", ModuleName: "MQTT", Settings: json.RawMessage(test.settings)}
+		redacted := sc.redactTemplate(template)
+		if !jsonEqual(redacted.Settings, []byte(test.expected)) {
+			t.Errorf("%s: redactTemplate = %s, expected %s", test.name, redacted.Settings, test.expected)
+		}
+
+		if string(template.Settings) != test.settings {
+			t.Errorf("%s: the settings of the template should not change", test.name)
+		}
+	}
+}
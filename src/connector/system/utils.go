@@ -1,8 +1,13 @@
 package system
 
 import (
+	"encoding/json"
 	"math/rand"
+	"reflect"
+	"strings"
 	"time"
+
+	"github.com/tebben/sensorthings-connector/src/connector/models"
 )
 
 var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
@@ -16,3 +21,233 @@ func RandomString(n int) string {
 	}
 	return string(b)
 }
+
+// mergePatch applies a JSON merge patch (RFC 7396) to a JSON document, members set to null
+// in the patch are removed and objects are merged recursively, all other values are replaced
+func mergePatch(document []byte, patch []byte) ([]byte, error) {
+	var doc, p interface{}
+	if len(document) > 0 {
+		if err := json.Unmarshal(document, &doc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergeValue(doc, p))
+}
+
+// mergeValue merges a decoded patch value into a decoded document value
+func mergeValue(doc interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	docObject, ok := doc.(map[string]interface{})
+	if !ok {
+		docObject = make(map[string]interface{})
+	}
+
+	for k, v := range patchObject {
+		if v == nil {
+			delete(docObject, k)
+		} else {
+			docObject[k] = mergeValue(docObject[k], v)
+		}
+	}
+
+	return docObject
+}
+
+// jsonEqual checks if two JSON documents hold the same values, documents that can not be
+// decoded are compared byte by byte
+func jsonEqual(a, b []byte) bool {
+	var da, db interface{}
+	if json.Unmarshal(a, &da) != nil || json.Unmarshal(b, &db) != nil {
+		return string(a) == string(b)
+	}
+
+	return reflect.DeepEqual(da, db)
+}
+
+// isSecretKey checks if the name of a settings field indicates that it holds a secret
+func isSecretKey(key string) bool {
+	k := strings.ToLower(key)
+	return strings.Contains(k, "password") || strings.Contains(k, "secret") || strings.Contains(k, "token") || k == "apikey"
+}
+
+// redactValue replaces the non empty string values of all fields named like a secret in a decoded JSON
+// value with RedactedValue
+func redactValue(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			if s, ok := v.(string); ok && isSecretKey(k) && len(s) > 0 {
+				n[k] = models.RedactedValue
+			} else {
+				n[k] = redactValue(v)
+			}
+		}
+	case []interface{}:
+		for i, v := range n {
+			n[i] = redactValue(v)
+		}
+	}
+
+	return node
+}
+
+// restoreRedacted replaces every RedactedValue in settings by the value at the same position in the stored
+// settings, redacted holds the stored settings with their secrets redacted. A redacted value in an object is
+// only restored when the fields beside it that are not secrets are unchanged, so a secret is not sent to
+// another host. The second return value is false when a redacted value could not be restored
+func restoreRedacted(settings json.RawMessage, stored json.RawMessage, redacted json.RawMessage) (json.RawMessage, bool) {
+	var doc, old, redactedOld interface{}
+	if json.Unmarshal(settings, &doc) != nil {
+		return settings, true
+	}
+
+	json.Unmarshal(stored, &old)
+	json.Unmarshal(redacted, &redactedOld)
+	restored, ok := restoreValue(doc, old, redactedOld)
+	b, err := json.Marshal(restored)
+	if err != nil {
+		return settings, ok
+	}
+
+	return b, ok
+}
+
+func restoreValue(node interface{}, old interface{}, redactedOld interface{}) (interface{}, bool) {
+	ok := true
+	switch n := node.(type) {
+	case string:
+		if n == models.RedactedValue {
+			if _, isString := old.(string); !isString {
+				return node, false
+			}
+
+			return old, true
+		}
+	case map[string]interface{}:
+		oldMap, _ := old.(map[string]interface{})
+		redactedMap, _ := redactedOld.(map[string]interface{})
+		if hasRedactedField(n) && !siblingsUnchanged(n, redactedMap) {
+			return node, false
+		}
+
+		for k, v := range n {
+			var restored bool
+			n[k], restored = restoreValue(v, oldMap[k], redactedMap[k])
+			ok = ok && restored
+		}
+	case []interface{}:
+		oldList, _ := old.([]interface{})
+		redactedList, _ := redactedOld.([]interface{})
+		for i, v := range n {
+			var oldValue, redactedValue interface{}
+			if i < len(oldList) {
+				oldValue = oldList[i]
+			}
+
+			if i < len(redactedList) {
+				redactedValue = redactedList[i]
+			}
+
+			var restored bool
+			n[i], restored = restoreValue(v, oldValue, redactedValue)
+			ok = ok && restored
+		}
+	}
+
+	return node, ok
+}
+
+// hasRedactedField checks if one of the fields of an object is RedactedValue
+func hasRedactedField(n map[string]interface{}) bool {
+	for _, v := range n {
+		if isRedacted(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// siblingsUnchanged checks if the fields of an object that are not secrets are equal to the fields of the
+// redacted stored object, fields that are redacted in either object or are named like a secret are skipped
+func siblingsUnchanged(n map[string]interface{}, redacted map[string]interface{}) bool {
+	for k := range mergeKeys(n, redacted) {
+		if isRedacted(n[k]) || isRedacted(redacted[k]) || isSecretKey(k) {
+			continue
+		}
+
+		if !equalIgnoringSecrets(n[k], redacted[k]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalIgnoringSecrets compares a decoded JSON value with a redacted stored value, positions that are
+// redacted in the stored value are equal to any value
+func equalIgnoringSecrets(value interface{}, redacted interface{}) bool {
+	if isRedacted(redacted) {
+		return true
+	}
+
+	switch r := redacted.(type) {
+	case map[string]interface{}:
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+
+		for k := range mergeKeys(v, r) {
+			if !equalIgnoringSecrets(v[k], r[k]) {
+				return false
+			}
+		}
+
+		return true
+	case []interface{}:
+		v, ok := value.([]interface{})
+		if !ok || len(v) != len(r) {
+			return false
+		}
+
+		for i := range r {
+			if !equalIgnoringSecrets(v[i], r[i]) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return reflect.DeepEqual(value, redacted)
+}
+
+// isRedacted checks if a decoded JSON value is RedactedValue
+func isRedacted(v interface{}) bool {
+	s, ok := v.(string)
+	return ok && s == models.RedactedValue
+}
+
+// mergeKeys returns the keys of both objects
+func mergeKeys(a map[string]interface{}, b map[string]interface{}) map[string]bool {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+
+	for k := range b {
+		keys[k] = true
+	}
+
+	return keys
+}
@@ -0,0 +1,113 @@
+package system
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestMergePatch uses the examples from appendix A of RFC 7396
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		document string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		// an empty document is patched as null
+		{``, `{"a":"b"}`, `{"a":"b"}`},
+	}
+
+	for _, test := range tests {
+		result, err := mergePatch([]byte(test.document), []byte(test.patch))
+		if err != nil {
+			t.Errorf("mergePatch(%s, %s) returned error: %v", test.document, test.patch, err)
+			continue
+		}
+
+		if !jsonEqual(result, []byte(test.expected)) {
+			t.Errorf("mergePatch(%s, %s) = %s, expected %s", test.document, test.patch, result, test.expected)
+		}
+	}
+}
+
+func TestMergePatchErrors(t *testing.T) {
+	tests := []struct {
+		document string
+		patch    string
+	}{
+		{`{"a":`, `{"a":"b"}`},
+		{`{"a":"b"}`, `{"a":`},
+		{`{"a":"b"}`, ``},
+	}
+
+	for _, test := range tests {
+		if _, err := mergePatch([]byte(test.document), []byte(test.patch)); err == nil {
+			t.Errorf("mergePatch(%s, %s) should return an error", test.document, test.patch)
+		}
+	}
+}
+
+func TestRestoreRedacted(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		stored   string
+		expected string
+		ok       bool
+	}{
+		{"without redacted values", `{"host":"b","password":"new"}`, `{"host":"a","password":"old"}`, `{"host":"b","password":"new"}`, true},
+		{"secret restored", `{"host":"a","password":"********"}`, `{"host":"a","password":"old"}`, `{"host":"a","password":"old"}`, true},
+		{"host beside the secret changed", `{"host":"b","password":"********"}`, `{"host":"a","password":"old"}`, `{"host":"b","password":"********"}`, false},
+		{"field beside the secret added", `{"host":"a","port":1,"password":"********"}`, `{"host":"a","password":"old"}`, `{"host":"a","port":1,"password":"********"}`, false},
+		{"other secret beside the secret changed", `{"host":"a","password":"********","token":"new"}`, `{"host":"a","password":"old","token":"old"}`,
+			`{"host":"a","password":"old","token":"new"}`, true},
+		{"nested secret restored", `{"auth":{"token":"********"}}`, `{"auth":{"token":"old"}}`, `{"auth":{"token":"old"}}`, true},
+		{"other object changed", `{"host":"b","auth":{"token":"********"}}`, `{"host":"a","auth":{"token":"old"}}`, `{"host":"b","auth":{"token":"old"}}`, true},
+		{"object with a secret beside the secret", `{"host":"a","password":"********","auth":{"token":"new"}}`, `{"host":"a","password":"old","auth":{"token":"old"}}`,
+			`{"host":"a","password":"old","auth":{"token":"new"}}`, true},
+		{"secrets restored by position",
+			`{"brokers":[{"host":"a","password":"********"},{"host":"c","password":"new"}]}`,
+			`{"brokers":[{"host":"a","password":"1"},{"host":"b","password":"2"}]}`,
+			`{"brokers":[{"host":"a","password":"1"},{"host":"c","password":"new"}]}`, true},
+		{"secrets moved to other hosts",
+			`{"brokers":[{"host":"b","password":"********"},{"host":"a","password":"********"}]}`,
+			`{"brokers":[{"host":"a","password":"1"},{"host":"b","password":"2"}]}`,
+			`{"brokers":[{"host":"b","password":"********"},{"host":"a","password":"********"}]}`, false},
+		{"secret in a list of strings", `["********","x"]`, `["old","y"]`, `["old","x"]`, true},
+		{"list longer than stored", `{"keys":["********","********"]}`, `{"keys":["old"]}`, `{"keys":["old","********"]}`, false},
+		{"no stored secret at the position", `{"password":"********","token":"********"}`, `{"password":"old"}`, `{"password":"old","token":"********"}`, false},
+		{"stored value is not a string", `{"password":"********"}`, `{"password":{"value":"old"}}`, `{"password":"********"}`, false},
+		{"stored value is null", `{"password":"********"}`, `{"password":null}`, `{"password":"********"}`, false},
+		{"no stored settings", `{"password":"********"}`, ``, `{"password":"********"}`, false},
+		{"settings that are not JSON", `{"password":`, `{"password":"old"}`, `{"password":`, true},
+	}
+
+	for _, test := range tests {
+		var stored interface{}
+		json.Unmarshal([]byte(test.stored), &stored)
+		redacted, _ := json.Marshal(redactValue(stored))
+
+		result, ok := restoreRedacted(json.RawMessage(test.settings), json.RawMessage(test.stored), redacted)
+		if ok != test.ok {
+			t.Errorf("%s: ok = %v, expected %v", test.name, ok, test.ok)
+		}
+
+		if !jsonEqual(result, []byte(test.expected)) {
+			t.Errorf("%s: restoreRedacted = %s, expected %s", test.name, result, test.expected)
+		}
+	}
+}
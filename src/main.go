@@ -2,11 +2,16 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 
+	"github.com/tebben/sensorthings-connector/src/connector/auth"
 	"github.com/tebben/sensorthings-connector/src/connector/config"
+	"github.com/tebben/sensorthings-connector/src/connector/database"
 	"github.com/tebben/sensorthings-connector/src/connector/http"
+	"github.com/tebben/sensorthings-connector/src/connector/logging"
 	"github.com/tebben/sensorthings-connector/src/connector/modules/beeclear"
+	"github.com/tebben/sensorthings-connector/src/connector/modules/external"
 	"github.com/tebben/sensorthings-connector/src/connector/modules/mqtt"
 	"github.com/tebben/sensorthings-connector/src/connector/modules/netatmo"
 	"github.com/tebben/sensorthings-connector/src/connector/system"
@@ -14,19 +19,68 @@ import (
 
 func main() {
 	cfgFlag := flag.String("config", "configs/sampleconfig.json", "path of the config file")
+	hashFlag := flag.String("hashpassword", "", "print the bcrypt hash of the given password for use in the auth config and exit")
+	generateKeyFlag := flag.Bool("generatekey", false, "print a new key for the encryption config and exit")
+	reencryptFlag := flag.String("reencrypt", "", "encrypt the database with the key in the given file and exit, the connector should not be running")
 	flag.Parse()
 	cfg := *cfgFlag
 
+	if len(*hashFlag) > 0 {
+		hash, err := auth.HashPassword(*hashFlag)
+		if err != nil {
+			log.Fatal("unable to hash password: ", err)
+		}
+
+		fmt.Println(hash)
+		return
+	}
+
+	if *generateKeyFlag {
+		key, err := database.GenerateKey()
+		if err != nil {
+			log.Fatal("unable to generate key: ", err)
+		}
+
+		fmt.Println(key)
+		return
+	}
+
 	c, err := config.GetConfig(cfg)
 	if err != nil {
 		log.Fatal("config read error: ", err)
 		return
 	}
 
+	if len(*reencryptFlag) > 0 {
+		reencrypt(c, *reencryptFlag)
+		return
+	}
+
 	start(c)
 }
 
 func start(c config.Config) {
+	level, err := logging.ParseLevel(c.Log.Level)
+	if err != nil {
+		log.Fatal("log config error: ", err)
+	}
+
+	format, err := logging.ParseFormat(c.Log.Format)
+	if err != nil {
+		log.Fatal("log config error: ", err)
+	}
+
+	logging.Configure(level, format)
+	a, err := auth.CreateAuth(c.Auth)
+	if err != nil {
+		log.Fatal("auth config error: ", err)
+		return
+	}
+
+	if c.Auth.ClientCertificate != nil && len(c.TLS.ClientCAFile) == 0 {
+		log.Fatal("auth config error: client certificate authentication requires the tls clientCAFile")
+	}
+
 	system := system.CreateSystem(c)
 
 	//---ADD MODULES HERE---//
@@ -35,8 +89,48 @@ func start(c config.Config) {
 	system.AddModule(&beeclear.BeeClearModule{})
 	//----------------------//
 
+	for _, em := range c.ExternalModules {
+		if len(em.Name) == 0 || len(em.Command) == 0 {
+			log.Fatal("external module config error: ", fmt.Errorf("external module %q requires a name and a command", em.Name))
+		}
+
+		if err := system.AddModule(external.CreateExternalModule(em)); err != nil {
+			log.Printf("External module %s skipped: %v", em.Name, err)
+		}
+	}
+
 	system.Start()
 
-	connectorServer := http.CreateServer(&system, c.HttpHost, system.GetEndpoints())
+	connectorServer := http.CreateServer(&system, c.HttpHost, system.GetEndpoints(), a, c.CORS, c.TLS)
 	connectorServer.Start()
 }
+
+// reencrypt decrypts the database using the key from the config and encrypts it with the key in keyFile,
+// the config has to be changed to the new key afterwards
+func reencrypt(c config.Config, keyFile string) {
+	key, err := database.LoadKey(c.Encryption)
+	if err != nil {
+		log.Fatal("encryption key error: ", err)
+	}
+
+	newKey, err := database.ReadKeyFile(keyFile)
+	if err != nil {
+		log.Fatal("new encryption key error: ", err)
+	}
+
+	db := database.Database{}
+	if err = db.SetEncryptionKey(key); err != nil {
+		log.Fatal("encryption key error: ", err)
+	}
+
+	if err = db.Open(c.Database); err != nil {
+		log.Fatal("database error: ", err)
+	}
+
+	defer db.Close()
+	if err = db.Reencrypt(newKey); err != nil {
+		log.Fatal("unable to re-encrypt the database: ", err)
+	}
+
+	log.Printf("Database encrypted with the key in %s, change the encryption config to use the new key", keyFile)
+}